@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Dudssource/shiny-cart/emulator"
+)
+
+// coverageCommand writes the coverage report of a code/data log (see emulator.CoverageReport)
+func coverageCommand(args []string) error {
+
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: shiny-cart coverage <cdl file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	cdl, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return emulator.CoverageReport(os.Stdout, cdl)
+}
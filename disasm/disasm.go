@@ -0,0 +1,200 @@
+// Package disasm decodes SM83 (Game Boy CPU) instructions, in RGBDS syntax
+// https://rgbds.gbdev.io/docs/gbz80.7
+package disasm
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// https://gbdev.io/pandocs/Memory_Map.html
+	ROM_BANK_SIZE  = 0x4000
+	ROM_BANK_START = 0x4000 // switchable bank (ROMX)
+
+	CB_PREFIX = 0xCB
+)
+
+// opcodes.json instruction metadata
+// https://gbdev.io/gb-opcodes/Opcodes.json
+//
+//go:embed opcodes.json
+var opcodesFile []byte
+
+type opcodeInfo struct {
+	Mnemonic string `json:"mnemonic"`
+	Bytes    int    `json:"bytes"`
+	Operands []struct {
+		Name      string `json:"name"`
+		Immediate bool   `json:"immediate"`
+		Increment bool   `json:"increment"`
+		Decrement bool   `json:"decrement"`
+	} `json:"operands"`
+}
+
+var (
+	opcodeInfoOnce sync.Once
+	unprefixedInfo [256]opcodeInfo
+	cbprefixedInfo [256]opcodeInfo
+)
+
+func loadOpcodeInfo() {
+	var opcodes struct {
+		Unprefixed map[string]opcodeInfo `json:"unprefixed"`
+		Cbprefixed map[string]opcodeInfo `json:"cbprefixed"`
+	}
+	if err := json.Unmarshal(opcodesFile, &opcodes); err != nil {
+		panic(err)
+	}
+	for opcode := range 256 {
+		key := fmt.Sprintf("0x%.2X", opcode)
+		unprefixedInfo[opcode] = opcodes.Unprefixed[key]
+		cbprefixedInfo[opcode] = opcodes.Cbprefixed[key]
+	}
+}
+
+// Instruction decoded instruction
+type Instruction struct {
+	Address  uint16
+	Bytes    []uint8
+	Mnemonic string   // e.g. LD, JR
+	Operands []string // e.g. NZ, $0150, [HL+], SP+$02
+	Target   int      // address referenced by an operand (jumps, calls, [a16], [a8]), -1 if none
+
+	target int // operand holding Target
+}
+
+// Decode decodes the instruction at address, read returns the bytes as mapped (e.g. the
+// current ROM bank)
+func Decode(read func(address uint16) uint8, address uint16) Instruction {
+
+	opcodeInfoOnce.Do(loadOpcodeInfo)
+
+	info := unprefixedInfo[read(address)]
+	if read(address) == CB_PREFIX {
+		info = cbprefixedInfo[read(address+1)]
+	}
+
+	i := Instruction{Address: address, Mnemonic: info.Mnemonic, Target: -1}
+	for n := range max(info.Bytes, 1) {
+		i.Bytes = append(i.Bytes, read(address+uint16(n)))
+	}
+
+	for n := 0; n < len(info.Operands); n++ {
+		op := info.Operands[n]
+
+		var text string
+		switch op.Name {
+		case "n8":
+			text = fmt.Sprintf("$%.2X", read(address+1))
+		case "n16":
+			text = fmt.Sprintf("$%.2X%.2X", read(address+2), read(address+1))
+		case "a16":
+			i.Target, i.target = int(read(address+2))<<8|int(read(address+1)), len(i.Operands)
+			text = fmt.Sprintf("$%.4X", i.Target)
+		case "a8":
+			i.Target, i.target = 0xFF00|int(read(address+1)), len(i.Operands)
+			text = fmt.Sprintf("$%.4X", i.Target)
+		case "e8":
+			offset := int8(read(address + 1))
+			if info.Mnemonic == "JR" {
+				i.Target, i.target = int(uint16(int(address)+2+int(offset))), len(i.Operands)
+				text = fmt.Sprintf("$%.4X", i.Target)
+			} else {
+				text = signedHex(offset)
+			}
+		case "SP":
+			// LD HL, SP + e8
+			text = op.Name
+			if op.Increment && n+1 < len(info.Operands) {
+				text += signedHex(int8(read(address + 1)))
+				n++
+			}
+		default:
+			text = op.Name
+			if op.Increment {
+				text += "+"
+			} else if op.Decrement {
+				text += "-"
+			}
+		}
+
+		if !op.Immediate {
+			text = "[" + text + "]"
+		}
+		i.Operands = append(i.Operands, text)
+	}
+
+	return i
+}
+
+// Size instruction length in bytes
+func (i Instruction) Size() int {
+	return len(i.Bytes)
+}
+
+// String the instruction text (e.g. LD A, [$FF44])
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format the instruction text, naming the target address with label (e.g. CALL Main), the
+// address is kept if it returns an empty string
+func (i Instruction) Format(label func(address uint16) string) string {
+
+	operands := i.Operands
+	if i.Target >= 0 && label != nil {
+		if name := label(uint16(i.Target)); name != "" {
+			operands = append([]string(nil), i.Operands...)
+			operands[i.target] = strings.Replace(operands[i.target], fmt.Sprintf("$%.4X", i.Target), name, 1)
+		}
+	}
+
+	if len(operands) == 0 {
+		return i.Mnemonic
+	}
+	return i.Mnemonic + " " + strings.Join(operands, ", ")
+}
+
+// Start finds an address a few instructions before pc whose decoding lands on pc, code can't
+// be decoded backwards
+func Start(read func(address uint16) uint8, pc uint16) uint16 {
+	for back := uint16(12); back > 0; back-- {
+		address := pc - back
+		for address < pc && address >= pc-back {
+			address += uint16(Decode(read, address).Size())
+		}
+		if address == pc {
+			return pc - back
+		}
+	}
+	return pc
+}
+
+// ROMReader reads the ROM as mapped by the CPU with the bank switched in at 4000-7FFF, the
+// bytes past the ROM (or the area) read as $FF
+func ROMReader(rom []uint8, bank int) func(address uint16) uint8 {
+	return func(address uint16) uint8 {
+		offset := int(address)
+		if address >= ROM_BANK_START+ROM_BANK_SIZE {
+			return 0xFF
+		}
+		if address >= ROM_BANK_START {
+			offset = bank*ROM_BANK_SIZE + int(address-ROM_BANK_START)
+		}
+		if offset >= len(rom) {
+			return 0xFF
+		}
+		return rom[offset]
+	}
+}
+
+func signedHex(n int8) string {
+	if n < 0 {
+		return fmt.Sprintf("-$%.2X", -int(n))
+	}
+	return fmt.Sprintf("+$%.2X", n)
+}
@@ -0,0 +1,65 @@
+package disasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+
+	for expected, code := range map[string][]uint8{
+		"NOP":            {0x00},
+		"LD A, $12":      {0x3E, 0x12},
+		"LD HL, $DEAD":   {0x21, 0xAD, 0xDE},
+		"CALL $0110":     {0xCD, 0x10, 0x01},
+		"LD [$C000], A":  {0xEA, 0x00, 0xC0},
+		"LD [$C000], SP": {0x08, 0x00, 0xC0},
+		"JR $0000":       {0x18, 0xFE},
+		"JR NC, $0012":   {0x30, 0x10},
+		"LDH A, [$FF44]": {0xF0, 0x44},
+		"LDH [C], A":     {0xE2},
+		"LD [HL+], A":    {0x22},
+		"LD A, [HL-]":    {0x3A},
+		"LD [HL], $FF":   {0x36, 0xFF},
+		"LD HL, SP-$02":  {0xF8, 0xFE},
+		"ADD SP, +$05":   {0xE8, 0x05},
+		"JP NZ, $1234":   {0xC2, 0x34, 0x12},
+		"RST $38":        {0xFF},
+		"SWAP A":         {0xCB, 0x37},
+		"BIT 7, [HL]":    {0xCB, 0x7E},
+	} {
+		i := Decode(func(address uint16) uint8 { return code[int(address)%len(code)] }, 0)
+		assert.Equal(t, expected, i.String())
+		assert.Equal(t, code, i.Bytes, expected)
+	}
+}
+
+func TestFormat(t *testing.T) {
+
+	labels := func(address uint16) string {
+		return map[uint16]string{0x4010: "Main.loop", 0xFF80: "hFrame"}[address]
+	}
+
+	// bank 2 mapped at 4000-7FFF
+	rom := make([]uint8, 3*ROM_BANK_SIZE)
+	copy(rom[2*ROM_BANK_SIZE+0x10:], []uint8{
+		0xF0, 0x80, // 4010 LDH A, [hFrame]
+		0x20, 0xFC, // 4012 JR NZ, Main.loop
+		0xC3, 0x00, 0x01, // 4014 JP $0100
+	})
+	read := ROMReader(rom, 2)
+
+	var text []string
+	for address := uint16(0x4010); address < 0x4017; {
+		i := Decode(read, address)
+		text = append(text, i.Format(labels))
+		address += uint16(i.Size())
+	}
+	assert.Equal(t, []string{"LDH A, [hFrame]", "JR NZ, Main.loop", "JP $0100"}, text)
+	assert.Equal(t, 0x4010, Decode(read, 0x4012).Target)
+	assert.Equal(t, uint8(0xFF), read(0x8000))
+
+	// up to 12 bytes back (NOPs), decoding lands on JP
+	assert.Equal(t, uint16(0x4008), Start(read, 0x4014))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Dudssource/shiny-cart/disasm"
+	"github.com/Dudssource/shiny-cart/emulator"
+)
+
+// disasmCommand disassembles the ROM banks of a ROM file, naming the addresses with its symbols
+func disasmCommand(args []string) error {
+
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: shiny-cart disasm [flags] <rom file>")
+		flags.PrintDefaults()
+	}
+	banks := flags.String("bank", "", "ROM `bank` or bank range, hexadecimal (e.g. 1, 0-3), all by default")
+	from := flags.String("from", "0", "First `address`, hexadecimal")
+	to := flags.String("to", "7FFF", "Last `address`, hexadecimal")
+	symFile := flags.String("sym", "", "Symbol `file`, <rom>.sym by default (if any)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	romFile := flags.Arg(0)
+
+	rom, err := os.ReadFile(romFile)
+	if err != nil {
+		return err
+	}
+
+	// banks and addresses
+	last := max(len(rom)-1, 0) / disasm.ROM_BANK_SIZE
+	first := 0
+	if *banks != "" {
+		b1, b2, isRange := strings.Cut(*banks, "-")
+		if first, err = parseHex(b1, last); err != nil {
+			return err
+		}
+		if !isRange {
+			b2 = b1
+		}
+		if last, err = parseHex(b2, last); err != nil {
+			return err
+		}
+	}
+	start, err := parseHex(*from, 0x7FFF)
+	if err != nil {
+		return err
+	}
+	end, err := parseHex(*to, 0x7FFF)
+	if err != nil {
+		return err
+	}
+
+	symbols, err := readSymbols(romFile, *symFile)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	for bank := first; bank <= last; bank++ {
+
+		// bank 0 is listed with bank 1 mapped at 4000-7FFF
+		area, mapped := 0, max(bank, 1)
+		if bank > 0 {
+			area = disasm.ROM_BANK_START
+		}
+		read := disasm.ROMReader(rom, mapped)
+		label := func(address uint16) string {
+			if address < disasm.ROM_BANK_START {
+				return symbols.Label(0, address)
+			}
+			return symbols.Label(mapped, address)
+		}
+
+		address, stop := max(area, start), min(area+disasm.ROM_BANK_SIZE-1, end)
+		if address > stop {
+			continue
+		}
+		fmt.Fprintf(w, "; bank $%.2X\n", bank)
+
+		for address <= stop {
+			// offsets (e.g. Main+$2) aren't labels
+			if name := label(uint16(address)); name != "" && !strings.Contains(name, "+") {
+				fmt.Fprintf(w, "%s:\n", name)
+			}
+			i := disasm.Decode(read, uint16(address))
+			fmt.Fprintf(w, "  %.2X:%.4X  % -8X  %s\n", bank, address, i.Bytes, i.Format(label))
+			address += i.Size()
+		}
+	}
+
+	return nil
+}
+
+// readSymbols reads the symbol file, or <rom>.sym if it exists
+func readSymbols(romFile, symFile string) (*emulator.Symbols, error) {
+
+	optional := symFile == ""
+	if optional {
+		symFile = strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".sym"
+	}
+
+	f, err := os.Open(symFile)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return emulator.ParseSymbols(f)
+}
+
+func parseHex(s string, limit int) (int, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "$"), "0x"), 16, 32)
+	if err != nil || int(n) > limit {
+		return 0, fmt.Errorf("invalid number %q (up to %X)", s, limit)
+	}
+	return int(n), nil
+}
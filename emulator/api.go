@@ -0,0 +1,212 @@
+package emulator
+
+import "time"
+
+// CpuRegisters snapshot of the CPU registers
+// https://gbdev.io/pandocs/CPU_Registers_and_Flags.html
+type CpuRegisters struct {
+	A, F   uint8
+	B, C   uint8
+	D, E   uint8
+	H, L   uint8
+	SP, PC uint16
+	IME    bool // interrupt master enable
+	Halted bool
+}
+
+// RunFrame emulates a single frame (CYCLES_PER_FRAME t-cycles), presenting it to the video sink
+func (g *GameBoy) RunFrame() error {
+	_, err := g.RunUntil(func(*GameBoy) bool { return true }, 1)
+	return err
+}
+
+// RunFrames runs the emulator for n frames (0 means until a STOP instruction).
+func (g *GameBoy) RunFrames(n int) error {
+	_, err := g.RunUntil(func(*GameBoy) bool { return false }, n)
+	return err
+}
+
+// RunUntil runs the emulator until cond is met (checked after every frame), up to
+// maxFrames frames (0 means no limit). Returns whether the condition was met.
+func (g *GameBoy) RunUntil(cond func(g *GameBoy) bool, maxFrames int) (bool, error) {
+
+	if !g.initialized {
+		if err := g.init(); err != nil {
+			return false, err
+		}
+	}
+
+	for frame := 0; maxFrames == 0 || frame < maxFrames; frame++ {
+
+		if g.c.stopped {
+			return false, nil
+		}
+
+		g.runFrame()
+
+		if cond(g) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Framebuffer returns a copy of the last rendered frame, each pixel is a shade (0-3)
+// after applying the DMG palettes (approximated from the colors in CGB mode)
+func (g *GameBoy) Framebuffer() [SCREEN_HEIGHT][SCREEN_WIDTH]Pixel {
+	return g.video.videoMemory
+}
+
+// ColorFramebuffer returns a copy of the last rendered frame in CGB mode or on the SGB models
+// (15-bit RGB), see CGB
+func (g *GameBoy) ColorFramebuffer() [SCREEN_HEIGHT][SCREEN_WIDTH]Color {
+	return g.video.colorMemory
+}
+
+// CGB reports if the cartridge runs in CGB mode (CGB cartridge on a CGB model), only valid after
+// the first frame
+func (g *GameBoy) CGB() bool {
+	return g.c.memory.cgb
+}
+
+// SGBFramebuffer returns a copy of the last rendered SGB frame (LCD and border), only
+// available on the SGB models (nil otherwise)
+func (g *GameBoy) SGBFramebuffer() *[SGB_SCREEN_HEIGHT][SGB_SCREEN_WIDTH]Color {
+	if g.c.memory.sgb == nil {
+		return nil
+	}
+	frame := *g.c.memory.sgb.frame(&g.video.colorMemory)
+	return &frame
+}
+
+// AudioSamples returns (and clears) the mixed audio samples captured since the
+// last call, left and right samples are interleaved. Only available in headless
+// mode (no audio sink), nil otherwise.
+func (g *GameBoy) AudioSamples() []float32 {
+	capture, ok := g.sound.sink.(*captureAudio)
+	if !ok {
+		return nil
+	}
+	samples := capture.samples
+	capture.samples = nil
+	return samples
+}
+
+// Serial returns (and clears) the bytes sent through the serial port (SB/SC) since the
+// last call, at most the latest SERIAL_BUFFER_SIZE, e.g. test ROMs (blargg) print their results there
+// https://gbdev.io/pandocs/Serial_Data_Transfer_(Link_Cable).html
+func (g *GameBoy) Serial() []uint8 {
+	serial := g.c.serial.sent
+	g.c.serial.sent = nil
+	return serial
+}
+
+// Frames returns the number of frames emulated so far
+func (g *GameBoy) Frames() int {
+	return g.frames
+}
+
+// SetButtons presses the buttons in the mask (and releases the others), on top of
+// the buttons pressed on the input source, until the next call
+func (g *GameBoy) SetButtons(buttons Button) {
+	g.joypad.buttons = buttons
+	g.joypad.sync(0)
+}
+
+// ReadMemory reads a byte from the address bus (as seen by the CPU, e.g. through the MBC)
+func (g *GameBoy) ReadMemory(address uint16) uint8 {
+	return g.c.memory.Read(Word(address))
+}
+
+// WriteMemory writes a byte to the address bus (as the CPU would, e.g. ROM writes select banks)
+func (g *GameBoy) WriteMemory(address uint16, value uint8) {
+	g.c.memory.Write(Word(address), value)
+}
+
+// Registers returns the current CPU registers
+func (g *GameBoy) Registers() CpuRegisters {
+	return g.c.registers()
+}
+
+// CodeDataLog returns how each ROM byte was accessed (see CDL_OPCODE), nil unless
+// Config.CodeDataLog is set
+func (g *GameBoy) CodeDataLog() []uint8 {
+	return g.c.memory.cdl
+}
+
+// SetSymbols replaces the labels shown by the debugger (Load reads <rom>.sym), the break
+// points already added keep their addresses
+func (g *GameBoy) SetSymbols(symbols *Symbols) {
+	g.c.debugger.symbols = symbols
+}
+
+// SoftBreakpoint returns the CPU registers at the first LD B,B instruction executed
+// since the last call, the convention used by test ROMs to signal the end of a test
+// https://github.com/Gekkio/mooneye-test-suite#passfail-reporting
+func (g *GameBoy) SoftBreakpoint() (CpuRegisters, bool) {
+	regs := g.c.softBreak
+	g.c.softBreak = nil
+	if regs == nil {
+		return CpuRegisters{}, false
+	}
+	return *regs, true
+}
+
+func (c *Cpu) registers() CpuRegisters {
+	return CpuRegisters{
+		A:      c.reg.r8(reg_a),
+		F:      c.reg.r8(reg_f),
+		B:      c.reg.r8(reg_b),
+		C:      c.reg.r8(reg_c),
+		D:      c.reg.r8(reg_d),
+		E:      c.reg.r8(reg_e),
+		H:      c.reg.r8(reg_h),
+		L:      c.reg.r8(reg_l),
+		SP:     uint16(c.sp),
+		PC:     uint16(c.pc),
+		IME:    c.ime != 0,
+		Halted: c.halted,
+	}
+}
+
+// Reset power cycles the console, the cartridge (ROM, battery-backed RAM and RTC),
+// the frontends and the serial device (link cable, printer) are kept
+func (g *GameBoy) Reset() error {
+
+	// the debugger (and its input), the trace log and the profile are kept
+	config := g.config
+	config.Debugger, config.Trace, config.Profile = nil, nil, nil
+	r := NewGameBoy(config)
+	r.config = g.config
+	r.c.debugger = g.c.debugger
+	r.c.profiler = g.c.profiler
+	r.c.memory.cdl = g.c.memory.cdl
+	if g.c.trace != nil {
+		r.c.trace, r.c.memory.stubLY = g.c.trace, true
+	}
+
+	if err := r.LoadROM(g.c.memory.rom); err != nil {
+		return err
+	}
+
+	if err := r.c.memory.mbc.restoreBattery(g.c.memory.mbc, time.Now()); err != nil {
+		return err
+	}
+
+	r.romFile = g.romFile
+	r.savFile = g.savFile
+
+	r.c.serial.device = g.c.serial.device
+
+	// frontends already initialized (window, audio device)
+	if g.initialized {
+		if err := r.powerUp(); err != nil {
+			return err
+		}
+		r.initialized = true
+	}
+
+	*g = *r
+	return nil
+}
@@ -0,0 +1,181 @@
+package emulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestROM writes a 32KiB ROM (no MBC) with the given program at the entry point
+func writeTestROM(t *testing.T, program ...uint8) string {
+	rom := make([]uint8, 0x8000)
+	copy(rom[CPU_START:], program)
+	file := filepath.Join(t.TempDir(), "test.gb")
+	assert.NoError(t, os.WriteFile(file, rom, 0644))
+	return file
+}
+
+func TestAPI(t *testing.T) {
+
+	t.Run("run frames", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x3E, 0x42, // LD A, 0x42
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0x18, 0xFE, // JR -2
+		)))
+
+		assert.NoError(t, g.RunFrames(10))
+		assert.Equal(t, 10, g.Frames())
+		assert.Equal(t, uint8(0x42), g.c.memory.Read(0xC000))
+		assert.NotEmpty(t, g.AudioSamples())
+		assert.Empty(t, g.AudioSamples())
+		assert.NoError(t, g.Close())
+	})
+
+	t.Run("run until", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x3C,             // INC A
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0x18, 0xFA, // JR -6
+		)))
+
+		met, err := g.RunUntil(func(g *GameBoy) bool {
+			return g.Frames() == 3
+		}, 100)
+		assert.NoError(t, err)
+		assert.True(t, met)
+		assert.Equal(t, 3, g.Frames())
+	})
+
+	t.Run("run frame", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t, 0x18, 0xFE))) // JR -2
+		assert.NoError(t, g.RunFrame())
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, 2, g.Frames())
+		assert.Equal(t, [SCREEN_HEIGHT][SCREEN_WIDTH]Pixel{}, g.Framebuffer())
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t, 0x18, 0xFE))) // JR -2
+		g.WriteMemory(0xC000, 0x42)
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0xC000))
+		assert.Equal(t, uint8(0x18), g.ReadMemory(0x0100))
+	})
+
+	t.Run("registers", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x06, 0x03, // LD B, 0x03
+			0x0E, 0x05, // LD C, 0x05
+			0x21, 0xEF, 0xBE, // LD HL, 0xBEEF
+			0x18, 0xFE, // JR -2
+		)))
+		assert.NoError(t, g.RunFrame())
+
+		regs := g.Registers()
+		assert.Equal(t, uint8(0x03), regs.B)
+		assert.Equal(t, uint8(0x05), regs.C)
+		assert.Equal(t, uint8(0xBE), regs.H)
+		assert.Equal(t, uint8(0xEF), regs.L)
+		assert.Equal(t, uint16(0xFFFE), regs.SP)
+		// JR -2 loop (the opcode may have already been fetched)
+		assert.Contains(t, []uint16{0x0107, 0x0108}, regs.PC)
+	})
+
+	t.Run("set buttons", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t, 0x18, 0xFE))) // JR -2
+		assert.NoError(t, g.RunFrame())
+
+		g.WriteMemory(0xFF00, 0x10) // select buttons
+		g.SetButtons(BUTTON_A | BUTTON_START)
+		assert.Equal(t, uint8(0x06), g.ReadMemory(0xFF00)&0x0F)
+		assert.NotZero(t, g.ReadMemory(uint16(INTERRUPT_FLAG))&0x10)
+
+		// kept across frames
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, uint8(0x06), g.ReadMemory(0xFF00)&0x0F)
+
+		g.SetButtons(0)
+		assert.Equal(t, uint8(0x0F), g.ReadMemory(0xFF00)&0x0F)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		rom := make([]uint8, 0x8000)
+		copy(rom[CPU_START:], []uint8{
+			0x3E, 0x0A, // LD A, 0x0A
+			0xEA, 0x00, 0x00, // LD [0x0000], A (enable RAM)
+			0x3E, 0x42, // LD A, 0x42
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0xEA, 0x00, 0xA0, // LD [0xA000], A
+			0x18, 0xFE, // JR -2
+		})
+		rom[CARTRIDGE_HEADER_TYPE] = MBC1_RAM_BATTERY
+		rom[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0xC000))
+
+		assert.NoError(t, g.Reset())
+		assert.Equal(t, 0, g.Frames())
+		assert.Equal(t, uint16(CPU_START), g.Registers().PC)
+		assert.Equal(t, uint8(0x00), g.ReadMemory(0xC000))
+
+		// battery-backed RAM survives
+		g.WriteMemory(0x0000, 0x0A)
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0xA000))
+	})
+
+	t.Run("soft breakpoint", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x06, 0x03, // LD B, 0x03
+			0x40,       // LD B, B
+			0x06, 0x04, // LD B, 0x04
+			0x40,       // LD B, B
+			0x18, 0xFE, // JR -2
+		)))
+
+		_, ok := g.SoftBreakpoint()
+		assert.False(t, ok)
+
+		assert.NoError(t, g.RunFrame())
+		regs, ok := g.SoftBreakpoint()
+		assert.True(t, ok)
+		assert.Equal(t, uint8(0x03), regs.B)
+
+		// cleared
+		_, ok = g.SoftBreakpoint()
+		assert.False(t, ok)
+	})
+
+	t.Run("serial", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x3E, 'O', // LD A, 'O'
+			0xE0, 0x01, // LDH [SB], A
+			0x3E, 0x81, // LD A, 0x81 (start, internal clock)
+			0xE0, 0x02, // LDH [SC], A
+			0xF0, 0x02, // LDH A, [SC]
+			0x87,       // ADD A, A (bit 7 into carry)
+			0x38, 0xFB, // JR C, -5 (wait for the transfer)
+			0x3E, 'K', // LD A, 'K'
+			0xE0, 0x01, // LDH [SB], A
+			0x3E, 0x81, // LD A, 0x81
+			0xE0, 0x02, // LDH [SC], A
+			0x18, 0xFE, // JR -2
+		)))
+
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, "OK", string(g.Serial()))
+		assert.Empty(t, g.Serial())
+	})
+}
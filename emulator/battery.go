@@ -0,0 +1,143 @@
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MBC2 has a built-in 512x4 bits RAM, the cartridge header reports no RAM at all
+	// https://gbdev.io/pandocs/MBC2.html#a000a1ff--built-in-ram
+	MBC2_RAM_SIZE = 512
+
+	// flush battery RAM every 10s (60 FPS) if it has changed
+	BATTERY_FLUSH_FRAMES = 600
+)
+
+// batteryFile returns the save file location for a ROM file (game.gb -> game.sav)
+func batteryFile(romFile string) string {
+	return strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".sav"
+}
+
+// batterySize returns the number of external RAM bytes persisted, sized from the
+// cartridge header so .sav files are interchangeable with other emulators
+// https://gbdev.io/pandocs/The_Cartridge_Header.html#0149--ram-size
+func (m *Mbc) batterySize() int {
+	if _, ok := m.controller.(*mbc2); ok {
+		return MBC2_RAM_SIZE
+	}
+	return min(ramSizeMap1[m.mem[CARTRIDGE_HEADER_RAM_SIZE]]*1024, len(m.controller.RAM()))
+}
+
+// rtc returns the MBC3 controller when the cartridge has a real-time clock
+func (m *Mbc) rtc() *mbc3 {
+	if b, ok := m.controller.(*mbc3); ok && b.rtcSupport {
+		return b
+	}
+	return nil
+}
+
+// hasBattery reports if the cartridge external RAM (or RTC) must be persisted
+func (m *Mbc) hasBattery() bool {
+	return m.initialized() && m.controller.Battery() && (m.batterySize() > 0 || m.rtc() != nil)
+}
+
+// battery returns the save file contents, battery RAM followed by the RTC footer (if any)
+func (m *Mbc) battery() []uint8 {
+	data := bytes.Clone(m.controller.RAM()[:m.batterySize()])
+	if rtc := m.rtc(); rtc != nil {
+		data = append(data, rtc.saveRTC(time.Now())...)
+	}
+	return data
+}
+
+// batteryState the save file contents without the RTC timestamp, which differs on every flush
+func (m *Mbc) batteryState(data []uint8) []uint8 {
+	if m.rtc() != nil && len(data) >= m.batterySize()+RTC_FOOTER_SIZE {
+		return data[:len(data)-RTC_FOOTER_SIZE+RTC_FOOTER_TIMESTAMP]
+	}
+	return data
+}
+
+// loadBattery restores the external RAM from the save file, a missing file is not an error
+func (m *Mbc) loadBattery(file string) error {
+
+	if !m.hasBattery() {
+		return nil
+	}
+
+	size := m.batterySize()
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No battery file %s found\n", file)
+		m.saved = m.battery()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	copy(m.controller.RAM()[:size], data)
+
+	// RTC footer, the RAM is kept when it isn't understood
+	if rtc := m.rtc(); rtc != nil && len(data) > size {
+		if err := rtc.loadRTC(data[size:], time.Now()); err != nil {
+			log.Printf("Ignoring the RTC footer of %s : %s\n", file, err.Error())
+		}
+	}
+	m.saved = m.battery()
+
+	log.Printf("Loaded battery RAM from %s (size=%d)\n", file, len(data))
+	return nil
+}
+
+// saveBattery writes the external RAM into the save file, only if it (or the RTC) has changed since
+// the last flush
+func (m *Mbc) saveBattery(file string) error {
+
+	if !m.hasBattery() {
+		return nil
+	}
+
+	data := m.battery()
+	if bytes.Equal(m.batteryState(data), m.batteryState(m.saved)) {
+		return nil
+	}
+
+	// write to a temporary file first, so a crash never leaves a truncated save behind
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	m.saved = data
+
+	log.Printf("Saved battery RAM to %s (size=%d)\n", file, len(data))
+	return nil
+}
+
+// restoreBattery copies the battery-backed RAM and RTC from the same cartridge (used on reset)
+func (m *Mbc) restoreBattery(from *Mbc, now time.Time) error {
+
+	if !m.hasBattery() || !from.hasBattery() {
+		return nil
+	}
+
+	copy(m.controller.RAM(), from.controller.RAM())
+
+	if rtc := m.rtc(); rtc != nil && from.rtc() != nil {
+		if err := rtc.loadRTC(from.rtc().saveRTC(now), now); err != nil {
+			return err
+		}
+	}
+	m.saved = from.saved
+	return nil
+}
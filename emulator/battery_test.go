@@ -0,0 +1,115 @@
+package emulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBattery(t *testing.T) {
+
+	t.Run("save file name", func(t *testing.T) {
+		assert.Equal(t, "roms/game.sav", batteryFile("roms/game.gb"))
+		assert.Equal(t, "game.sav", batteryFile("game"))
+	})
+
+	t.Run("sized from header", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+		m := &Mbc{controller: &mbc1{batterySupport: true}, mem: mem}
+		assert.Equal(t, 8192, m.batterySize())
+
+		m = &Mbc{controller: &mbc2{batterySupport: true}, mem: mem}
+		assert.Equal(t, MBC2_RAM_SIZE, m.batterySize())
+	})
+
+	t.Run("no battery", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+		m := &Mbc{controller: &mbc1{ramSupport: true}, mem: mem}
+		file := filepath.Join(t.TempDir(), "game.sav")
+		m.controller.RAM()[0] = 0x42
+		assert.NoError(t, m.saveBattery(file))
+		assert.NoFileExists(t, file)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x03
+		file := filepath.Join(t.TempDir(), "game.sav")
+
+		m := &Mbc{controller: &mbc5{ramSupport: true, batterySupport: true}, mem: mem}
+		assert.NoError(t, m.loadBattery(file))
+
+		// untouched RAM is not flushed
+		assert.NoError(t, m.saveBattery(file))
+		assert.NoFileExists(t, file)
+
+		m.controller.RAM()[0x0] = 0x42
+		m.controller.RAM()[0x7FFF] = 0x24
+		assert.NoError(t, m.saveBattery(file))
+
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Len(t, data, 32768)
+
+		m = &Mbc{controller: &mbc5{ramSupport: true, batterySupport: true}, mem: mem}
+		assert.NoError(t, m.loadBattery(file))
+		assert.Equal(t, uint8(0x42), m.controller.RAM()[0x0])
+		assert.Equal(t, uint8(0x24), m.controller.RAM()[0x7FFF])
+	})
+
+	t.Run("rtc footer", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+		file := filepath.Join(t.TempDir(), "game.sav")
+
+		rtc := newRTC()
+		rtc.ramSupport = true
+		rtc.rtcRegisters[RTC_M] = 42
+		m := &Mbc{controller: rtc, mem: mem}
+		assert.NoError(t, m.saveBattery(file))
+
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Len(t, data, 8192+RTC_FOOTER_SIZE)
+
+		rtc = newRTC()
+		m = &Mbc{controller: rtc, mem: mem}
+		assert.NoError(t, m.loadBattery(file))
+		assert.Equal(t, uint8(42), rtc.rtcRegisters[RTC_M])
+	})
+	t.Run("rtc timestamp alone is not flushed", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+		file := filepath.Join(t.TempDir(), "game.sav")
+
+		rtc := newRTC()
+		rtc.ramSupport = true
+		m := &Mbc{controller: rtc, mem: mem}
+		m.saved = append(m.battery()[:8192+RTC_FOOTER_TIMESTAMP], make([]uint8, 8)...)
+		assert.NoError(t, m.saveBattery(file))
+		assert.NoFileExists(t, file)
+
+		rtc.rtcRegisters[RTC_S] = 1
+		assert.NoError(t, m.saveBattery(file))
+		assert.FileExists(t, file)
+	})
+
+	t.Run("unknown rtc footer keeps the ram", func(t *testing.T) {
+		mem := make(memoryArea, 0x8000)
+		mem[CARTRIDGE_HEADER_RAM_SIZE] = 0x02
+		file := filepath.Join(t.TempDir(), "game.sav")
+
+		data := make([]uint8, 8192+12)
+		data[0x10] = 0x42
+		assert.NoError(t, os.WriteFile(file, data, 0644))
+
+		rtc := newRTC()
+		m := &Mbc{controller: rtc, mem: mem}
+		assert.NoError(t, m.loadBattery(file))
+		assert.Equal(t, uint8(0x42), rtc.RAM()[0x10])
+	})
+}
@@ -0,0 +1,116 @@
+package emulator
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// blargg's test ROMs are not distributed with the repository, copy them (keeping the
+	// suite folders, e.g. cpu_instrs/individual/01-special.gb) into this folder
+	// https://github.com/retrio/gb-test-roms
+	BLARGG_DIR = "../test-roms/blargg"
+
+	// cpu_instrs (all tests) takes ~55 emulated seconds
+	BLARGG_TIMEOUT_CYCLES = CLOCK_SPEED * 120
+
+	// tests without serial output write their results to the cartridge RAM
+	// https://github.com/retrio/gb-test-roms/blob/master/dmg_sound/readme.txt
+	BLARGG_RAM_STATUS    = 0xA000
+	BLARGG_RAM_SIGNATURE = 0xA001
+	BLARGG_RAM_TEXT      = 0xA004
+	BLARGG_RAM_RUNNING   = 0x80
+)
+
+var blarggSuites = []string{"cpu_instrs", "instr_timing", "mem_timing", "halt_bug", "dmg_sound"}
+
+// blarggOutput returns the test output, printed on the serial port or written to the cartridge RAM
+func blarggOutput(g *GameBoy, serial *strings.Builder) (string, bool) {
+
+	serial.Write(g.Serial())
+	if text := serial.String(); strings.Contains(text, "Passed") || strings.Contains(text, "Failed") {
+		return text, true
+	}
+
+	signature := []uint8{g.ReadMemory(BLARGG_RAM_SIGNATURE), g.ReadMemory(BLARGG_RAM_SIGNATURE + 1), g.ReadMemory(BLARGG_RAM_SIGNATURE + 2)}
+	if !bytes.Equal(signature, []uint8{0xDE, 0xB0, 0x61}) || g.ReadMemory(BLARGG_RAM_STATUS) == BLARGG_RAM_RUNNING {
+		return serial.String(), false
+	}
+
+	var text strings.Builder
+	for address := uint16(BLARGG_RAM_TEXT); address < 0xC000; address++ {
+		v := g.ReadMemory(address)
+		if v == 0 {
+			break
+		}
+		text.WriteByte(v)
+	}
+	return text.String(), true
+}
+
+func TestBlargg(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("blargg test ROMs skipped in short mode")
+	}
+
+	if _, err := os.Stat(BLARGG_DIR); err != nil {
+		t.Skipf("blargg test ROMs not found: %s", err.Error())
+	}
+
+	for _, suite := range blarggSuites {
+
+		var roms []string
+		_ = filepath.WalkDir(BLARGG_DIR, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(file) != ".gb" {
+				return nil
+			}
+			rel, _ := filepath.Rel(BLARGG_DIR, file)
+			if strings.HasPrefix(filepath.ToSlash(rel), suite) {
+				roms = append(roms, file)
+			}
+			return nil
+		})
+
+		t.Run(suite, func(t *testing.T) {
+
+			if len(roms) == 0 {
+				t.Skipf("no %s ROMs found in %s", suite, BLARGG_DIR)
+			}
+
+			for _, rom := range roms {
+				name, _ := filepath.Rel(BLARGG_DIR, rom)
+				t.Run(strings.TrimSuffix(filepath.ToSlash(name), ".gb"), func(t *testing.T) {
+					t.Parallel()
+
+					g := NewGameBoy(Config{Silent: true})
+					if !assert.NoError(t, g.Load(rom)) {
+						return
+					}
+
+					var (
+						serial strings.Builder
+						output string
+					)
+
+					met, err := g.RunUntil(func(g *GameBoy) bool {
+						var done bool
+						output, done = blarggOutput(g, &serial)
+						return done
+					}, BLARGG_TIMEOUT_CYCLES/CYCLES_PER_FRAME)
+
+					assert.NoError(t, err)
+					assert.True(t, met, "timeout, output:\n%s", output)
+					assert.NotContains(t, output, "Failed", output)
+					t.Log(output)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBootROM stores 0x42 at 0xC000 then disables itself at 0x00FC, as the DMG boot ROM does
+func testBootROM() []uint8 {
+	boot := make([]uint8, BOOT_ROM_SIZE)
+	copy(boot, []uint8{
+		0x31, 0xFE, 0xFF, // LD SP, 0xFFFE
+		0x3E, 0x42, // LD A, 0x42
+		0xEA, 0x00, 0xC0, // LD [0xC000], A
+		0xC3, 0xFC, 0x00, // JP 0x00FC
+	})
+	copy(boot[0xFC:], []uint8{
+		0x3E, 0x01, // LD A, 1
+		0xE0, 0x50, // LDH [0x50], A (disable boot ROM)
+	})
+	return boot
+}
+
+func TestBootROM(t *testing.T) {
+
+	rom := make([]uint8, 0x8000)
+	rom[0x0000] = 0xAA
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x24, // LD A, 0x24
+		0xEA, 0x01, 0xC0, // LD [0xC001], A
+		0x18, 0xFE, // JR -2
+	})
+
+	t.Run("runs before the cartridge", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, BootROM: testBootROM()})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.Equal(t, uint8(0x31), g.ReadMemory(0x0000))
+		assert.Equal(t, uint8(0x3E), g.ReadMemory(uint16(CPU_START)))
+
+		assert.NoError(t, g.init())
+		assert.Equal(t, uint16(0x0000), g.Registers().PC)
+
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0xC000))
+		assert.Equal(t, uint8(0x24), g.ReadMemory(0xC001))
+
+		// unmapped, the cartridge is visible again
+		assert.Equal(t, uint8(0xAA), g.ReadMemory(0x0000))
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(PORT_BOOT_ROM_DISABLE))
+	})
+
+	t.Run("can not be mapped again", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, BootROM: testBootROM()})
+		assert.NoError(t, g.LoadROM(rom))
+		g.WriteMemory(PORT_BOOT_ROM_DISABLE, 0x1)
+		g.WriteMemory(PORT_BOOT_ROM_DISABLE, 0x0)
+		assert.Equal(t, uint8(0xAA), g.ReadMemory(0x0000))
+	})
+
+	t.Run("mapped again on reset", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, BootROM: testBootROM()})
+		assert.NoError(t, g.LoadROM(rom))
+		g.WriteMemory(PORT_BOOT_ROM_DISABLE, 0x1)
+		assert.NoError(t, g.Reset())
+		assert.Equal(t, uint8(0x31), g.ReadMemory(0x0000))
+	})
+
+	t.Run("save state", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, BootROM: testBootROM()})
+		assert.NoError(t, g.LoadROM(rom))
+
+		var buf bytes.Buffer
+		assert.NoError(t, g.SaveState(&buf))
+		g.WriteMemory(PORT_BOOT_ROM_DISABLE, 0x1)
+		assert.NoError(t, g.LoadState(&buf))
+		assert.Equal(t, uint8(0x31), g.ReadMemory(0x0000))
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, BootROM: make([]uint8, 0x800)})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.ErrorContains(t, g.RunFrame(), "invalid boot ROM size")
+	})
+}
+
+func TestPowerUp(t *testing.T) {
+
+	powerUp := func(model Mode, checksum uint8) *GameBoy {
+		rom := make([]uint8, 0x8000)
+		rom[CARTRIDGE_HEADER_CHECKSUM] = checksum
+		g := NewGameBoy(Config{Silent: true, Model: model})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.NoError(t, g.powerUp())
+		return g
+	}
+
+	t.Run("dmg", func(t *testing.T) {
+		g := powerUp(DMG, 0x00)
+		assert.Equal(t, CpuRegisters{A: 0x01, F: 0x80, C: 0x13, E: 0xD8, H: 0x01, L: 0x4D, SP: 0xFFFE, PC: 0x0100}, g.Registers())
+		assert.Equal(t, uint8(0xAB), g.ReadMemory(uint16(PORT_DIV)))
+		assert.Equal(t, uint8(0xB0), powerUp("", 0x1D).Registers().F)
+	})
+
+	t.Run("mgb", func(t *testing.T) {
+		assert.Equal(t, uint8(0xFF), powerUp(MGB, 0x00).Registers().A)
+	})
+
+	t.Run("dmg0", func(t *testing.T) {
+		g := powerUp(DMG0, 0x00)
+		assert.Equal(t, CpuRegisters{A: 0x01, B: 0xFF, C: 0x13, E: 0xC1, H: 0x84, L: 0x03, SP: 0xFFFE, PC: 0x0100}, g.Registers())
+		assert.Equal(t, uint8(0x18), g.ReadMemory(uint16(PORT_DIV)))
+		assert.Equal(t, uint8(0x80), g.ReadMemory(LCD_REGISTER)&0xF8)
+		assert.Equal(t, uint8(145), g.ReadMemory(LY_REGISTER)) // VBlank, the PPU is ahead (see powerUpPPU)
+	})
+
+	t.Run("sgb", func(t *testing.T) {
+		g := powerUp(SGB2, 0x00)
+		assert.Equal(t, CpuRegisters{A: 0xFF, C: 0x14, H: 0xC0, L: 0x60, SP: 0xFFFE, PC: 0x0100}, g.Registers())
+		assert.Equal(t, uint8(0xF0), g.ReadMemory(NR52))
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(uint16(PORT_JOYPAD)))
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(0xFF2A))
+
+		// the header is sent to the SNES, a M-cycle longer for each 0 bit
+		div := g.timer.counter
+		rom := make([]uint8, 0x8000)
+		rom[SGB_HEADER_END] = 0xFF
+		g = NewGameBoy(Config{Silent: true, Model: SGB})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.NoError(t, g.powerUp())
+		assert.Equal(t, div-8*4, g.timer.counter)
+	})
+
+	t.Run("cgb", func(t *testing.T) {
+		g := powerUp(CGB, 0x00)
+		assert.Equal(t, CpuRegisters{A: 0x11, F: 0x80, E: 0x08, L: 0x7C, SP: 0xFFFE, PC: 0x0100}, g.Registers())
+		assert.Equal(t, uint8(0x01), powerUp(AGB, 0x00).Registers().B)
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, Model: "GBA"})
+		assert.ErrorContains(t, g.powerUp(), "unknown hardware model")
+	})
+}
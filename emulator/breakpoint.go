@@ -0,0 +1,234 @@
+package emulator
+
+import (
+	"fmt"
+	"strings"
+)
+
+type breakKind int
+
+// break point kinds, see parseBreakPoint
+const (
+	breakAddress breakKind = iota
+	breakCondition
+	breakOperation
+	breakRead
+	breakWrite
+	breakAccess
+	breakInterrupt
+)
+
+// interrupt names (IF/IE bits)
+// https://gbdev.io/pandocs/Interrupt_Sources.html
+var interruptNames = []string{"VBLANK", "STAT", "TIMER", "SERIAL", "JOYPAD"}
+
+// ioRegisters IO register names accepted by the break points
+// https://gbdev.io/pandocs/Hardware_Reg_List.html
+var ioRegisters = map[string]Word{
+	"P1": 0xFF00, "JOYP": 0xFF00, "SB": 0xFF01, "SC": 0xFF02,
+	"DIV": 0xFF04, "TIMA": 0xFF05, "TMA": 0xFF06, "TAC": 0xFF07, "IF": 0xFF0F,
+	"NR10": 0xFF10, "NR11": 0xFF11, "NR12": 0xFF12, "NR13": 0xFF13, "NR14": 0xFF14,
+	"NR21": 0xFF16, "NR22": 0xFF17, "NR23": 0xFF18, "NR24": 0xFF19,
+	"NR30": 0xFF1A, "NR31": 0xFF1B, "NR32": 0xFF1C, "NR33": 0xFF1D, "NR34": 0xFF1E,
+	"NR41": 0xFF20, "NR42": 0xFF21, "NR43": 0xFF22, "NR44": 0xFF23,
+	"NR50": 0xFF24, "NR51": 0xFF25, "NR52": 0xFF26,
+	"LCDC": 0xFF40, "STAT": 0xFF41, "SCY": 0xFF42, "SCX": 0xFF43, "LY": 0xFF44, "LYC": 0xFF45,
+	"DMA": 0xFF46, "BGP": 0xFF47, "OBP0": 0xFF48, "OBP1": 0xFF49, "WY": 0xFF4A, "WX": 0xFF4B,
+	"KEY1": 0xFF4D, "VBK": 0xFF4F, "BANK": 0xFF50,
+	"HDMA1": 0xFF51, "HDMA2": 0xFF52, "HDMA3": 0xFF53, "HDMA4": 0xFF54, "HDMA5": 0xFF55,
+	"RP": 0xFF56, "BCPS": 0xFF68, "BCPD": 0xFF69, "OCPS": 0xFF6A, "OCPD": 0xFF6B,
+	"SVBK": 0xFF70, "IE": 0xFFFF,
+}
+
+// breakPoint persistent break point, stops every time it's hit (once the ignored hits are
+// exhausted) and its condition, if any, holds
+type breakPoint struct {
+	spec       string // as entered
+	kind       breakKind
+	bank       int  // -1 matches any bank
+	start, end Word // address or range (watch points)
+	operation  string
+	interrupts uint8 // IF bits
+	cond       expr  // nil always holds
+	ignore     int   // hits ignored before stopping
+	hits       int
+	gdb        bool // added by the GDB client, removed once detached
+}
+
+// parseBreakPoint parses a break point, optionally followed by "if <expr>" and "ignore <n>":
+//
+//	[bank:]addr                 instruction address or label (e.g. 150, 01:4000, Main.loop)
+//	<expr>                      condition checked before every instruction (e.g. PC=150 && A==3)
+//	read|write|access <range>   watch point, range is [bank:]addr, [bank:]addr-addr or an IO register name
+//	io <register>               IO register writes (e.g. io LCDC, io FF40)
+//	irq [name...]               interrupts serviced (VBLANK, STAT, TIMER, SERIAL, JOYPAD), all by default
+//	OPN=<name>                  operation name (e.g. OPN=ret)
+func parseBreakPoint(spec string, symbols *Symbols) (*breakPoint, error) {
+
+	spec = strings.TrimSpace(spec)
+	b := &breakPoint{spec: spec, bank: -1}
+	s := spec
+
+	if head, n, ok := strings.Cut(s, " ignore "); ok {
+		ignore, err := parseNumber(strings.TrimSpace(n))
+		if err != nil || ignore < 0 {
+			return nil, fmt.Errorf("invalid ignore count %q", n)
+		}
+		b.ignore, s = ignore, head
+	}
+
+	if head, cond, ok := strings.Cut(s, " if "); ok {
+		e, err := compileExpr(cond)
+		if err != nil {
+			return nil, err
+		}
+		b.cond, s = e, head
+	}
+
+	keyword, args, _ := strings.Cut(strings.TrimSpace(s), " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(keyword) {
+	case "read", "write", "access", "io":
+		b.kind = map[string]breakKind{"read": breakRead, "write": breakWrite, "access": breakAccess, "io": breakWrite}[strings.ToLower(keyword)]
+		bank, start, end, err := parseRange(args, symbols)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(keyword, "io") && !ioAddress(start) {
+			return nil, fmt.Errorf("not an IO register %q", args)
+		}
+		b.bank, b.start, b.end = bank, start, end
+		return b, nil
+	case "irq":
+		b.kind = breakInterrupt
+		if args == "" {
+			b.interrupts = 0x1F
+			return b, nil
+		}
+		for _, name := range strings.Fields(args) {
+			i := indexFold(interruptNames, name)
+			if i < 0 {
+				return nil, fmt.Errorf("unknown interrupt %q", name)
+			}
+			b.interrupts |= 1 << i
+		}
+		return b, nil
+	}
+
+	if operation, ok := strings.CutPrefix(s, "OPN="); ok {
+		b.kind, b.operation = breakOperation, strings.TrimSpace(operation)
+		return b, nil
+	}
+
+	if bank, address, err := parseLocation(s, symbols); err == nil {
+		b.kind, b.bank, b.start, b.end = breakAddress, bank, address, address
+		return b, nil
+	}
+
+	e, err := compileExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	b.kind = breakCondition
+	if b.cond != nil {
+		cond := b.cond
+		b.cond = func(c *Cpu) int { return boolValue(e(c) != 0 && cond(c) != 0) }
+	} else {
+		b.cond = e
+	}
+	return b, nil
+}
+
+// parseLocation [bank:]addr, an IO register or a label, the bank is -1 if not given
+func parseLocation(s string, symbols *Symbols) (int, Word, error) {
+
+	bank := -1
+	if b, address, ok := strings.Cut(s, ":"); ok {
+		n, err := parseNumber(strings.TrimSpace(b))
+		if err != nil {
+			return 0, 0, err
+		}
+		bank, s = n, address
+	}
+
+	s = strings.TrimSpace(s)
+	if address, ok := ioRegisters[strings.ToUpper(s)]; ok {
+		return bank, address, nil
+	}
+
+	// labels win over hexadecimal numbers with the same name (e.g. Add)
+	if b, address, ok := symbols.lookup(s); ok {
+		if bank < 0 {
+			bank = b
+		}
+		return bank, address, nil
+	}
+
+	n, err := parseNumber(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 0 || n > 0xFFFF {
+		return 0, 0, fmt.Errorf("invalid address %q", s)
+	}
+	return bank, Word(n), nil
+}
+
+// parseRange [bank:]addr or [bank:]addr-addr
+func parseRange(s string, symbols *Symbols) (int, Word, Word, error) {
+
+	first, last, isRange := strings.Cut(s, "-")
+
+	bank, start, err := parseLocation(first, symbols)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !isRange {
+		return bank, start, start, nil
+	}
+
+	_, end, err := parseLocation(last, symbols)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if end < start {
+		return 0, 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return bank, start, end, nil
+}
+
+func ioAddress(address Word) bool {
+	return address >= 0xFF00 && address <= 0xFF7F || address == INTERRUPT_ENABLE
+}
+
+func indexFold(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matches reports if the break point holds, counting the hit
+func (b *breakPoint) matches(c *Cpu) bool {
+	if b.cond != nil && b.cond(c) == 0 {
+		return false
+	}
+	b.hits++
+	return b.hits > b.ignore
+}
+
+// watches reports if the memory access is watched
+func (b *breakPoint) watches(m *Memory, address Word, write bool) bool {
+	switch {
+	case b.kind == breakRead && write, b.kind == breakWrite && !write:
+		return false
+	case b.kind != breakRead && b.kind != breakWrite && b.kind != breakAccess:
+		return false
+	case address < b.start || address > b.end:
+		return false
+	}
+	return b.bank < 0 || m.bank(address) == b.bank
+}
@@ -0,0 +1,132 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// code/data log flags, one byte per ROM byte
+const (
+	CDL_OPCODE  = 0x01 // fetched as the first byte of an instruction
+	CDL_OPERAND = 0x02 // fetched as an instruction operand (or the CB opcode)
+	CDL_DATA    = 0x04 // read by an instruction
+
+	// coverage map bytes per character
+	CDL_MAP_BLOCK = 64
+)
+
+// cdlFile returns the code/data log location for a ROM file (game.gb -> game.cdl)
+func cdlFile(romFile string) string {
+	return strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".cdl"
+}
+
+// loadCDL merges the code/data log of the previous runs, if any
+func loadCDL(file string, cdl []uint8) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) != len(cdl) {
+		return fmt.Errorf("code/data log %s size %d doesn't match the ROM size %d", file, len(data), len(cdl))
+	}
+	for i, flags := range data {
+		cdl[i] |= flags
+	}
+	return nil
+}
+
+// logROM flags the ROM byte mapped at address, through the cartridge MBC
+func (m *Memory) logROM(address Word, flags uint8) {
+
+	if m.cdl == nil || address > ROM_BANK_NN_END || m.bootROM != nil && address < BOOT_ROM_SIZE {
+		return
+	}
+
+	offset := int(address)
+	if m.mbc.initialized() {
+		offset = m.mbc.controller.ROMOffset(m.rom, address)
+	}
+	if offset < len(m.cdl) {
+		m.cdl[offset] |= flags
+	}
+}
+
+// CoverageReport writes the percentage of each ROM bank executed (opcodes and operands) or
+// read as data, followed by a map of the bank (see CDL_MAP_BLOCK):
+//
+//	'.' not accessed, 'C' code, 'D' data, 'M' both
+func CoverageReport(w io.Writer, cdl []uint8) error {
+
+	var total, covered int
+	for bank := 0; bank*ROM_BANK_SIZE < len(cdl); bank++ {
+
+		data := cdl[bank*ROM_BANK_SIZE : min((bank+1)*ROM_BANK_SIZE, len(cdl))]
+
+		var code, read, any int
+		var m strings.Builder
+		for i, flags := range data {
+			if flags&(CDL_OPCODE|CDL_OPERAND) > 0 {
+				code++
+			}
+			if flags&CDL_DATA > 0 {
+				read++
+			}
+			if flags > 0 {
+				any++
+			}
+
+			if i%CDL_MAP_BLOCK > 0 {
+				continue
+			}
+			var block uint8
+			for _, flags := range data[i:min(i+CDL_MAP_BLOCK, len(data))] {
+				block |= flags
+			}
+			isCode, isData := block&(CDL_OPCODE|CDL_OPERAND) > 0, block&CDL_DATA > 0
+			switch {
+			case isCode && isData:
+				m.WriteByte('M')
+			case isCode:
+				m.WriteByte('C')
+			case isData:
+				m.WriteByte('D')
+			default:
+				m.WriteByte('.')
+			}
+		}
+		total += len(data)
+		covered += any
+
+		if _, err := fmt.Fprintf(w, "bank $%.2X: %5.1f%% (code %5.1f%%, data %5.1f%%)\n", bank,
+			percent(any, len(data)), percent(code, len(data)), percent(read, len(data))); err != nil {
+			return err
+		}
+		area := ROM_BANK_NN_START
+		if bank == 0 {
+			area = ROM_BANK_00_START
+		}
+		text := m.String()
+		for row := 0; row < len(text); row += 64 {
+			if _, err := fmt.Fprintf(w, "  $%.4X %s\n", int(area)+row*CDL_MAP_BLOCK, text[row:min(row+64, len(text))]); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "total: %.1f%% of %d bytes\n", percent(covered, total), total)
+	return err
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
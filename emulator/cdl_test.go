@@ -0,0 +1,63 @@
+package emulator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeDataLog(t *testing.T) {
+
+	// MBC1, 64 KiB, reads from bank 2
+	rom := make([]uint8, 4*ROM_BANK_SIZE)
+	rom[CARTRIDGE_HEADER_TYPE], rom[CARTRIDGE_HEADER_ROM_SIZE] = 0x01, 0x01
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x02, // 0100 LD A, $02
+		0xEA, 0x00, 0x20, // 0102 LD [$2000], A
+		0xFA, 0x05, 0x40, // 0105 LD A, [$4005]
+		0xCB, 0x37, // 0108 SWAP A
+		0x18, 0xFE, // 010A JR -2
+	})
+
+	file := filepath.Join(t.TempDir(), "cdl.gb")
+	assert.NoError(t, os.WriteFile(file, rom, 0644))
+
+	g := NewGameBoy(Config{Silent: true, CodeDataLog: true})
+	assert.NoError(t, g.Load(file))
+	assert.NoError(t, g.RunFrames(1))
+	assert.NoError(t, g.Close())
+
+	cdl := g.CodeDataLog()
+	assert.Equal(t, []uint8{
+		CDL_OPCODE, CDL_OPERAND,
+		CDL_OPCODE, CDL_OPERAND, CDL_OPERAND,
+		CDL_OPCODE, CDL_OPERAND, CDL_OPERAND,
+		CDL_OPCODE, CDL_OPERAND,
+		CDL_OPCODE, CDL_OPERAND,
+		0,
+	}, cdl[CPU_START:CPU_START+13])
+	assert.Equal(t, uint8(CDL_DATA), cdl[2*ROM_BANK_SIZE+5])
+	assert.Equal(t, uint8(0), cdl[ROM_BANK_SIZE+5])
+
+	// persisted and merged by the next runs
+	saved, err := os.ReadFile(cdlFile(file))
+	assert.NoError(t, err)
+	assert.Equal(t, cdl, saved)
+
+	g = NewGameBoy(Config{Silent: true, CodeDataLog: true})
+	assert.NoError(t, g.Load(file))
+	assert.Equal(t, cdl, g.CodeDataLog())
+
+	var out bytes.Buffer
+	assert.NoError(t, CoverageReport(&out, cdl))
+	report := out.String()
+	assert.Contains(t, report, "bank $00:   0.1% (code   0.1%, data   0.0%)\n  $0000 ....C...")
+	assert.Contains(t, report, "bank $01:   0.0% (code   0.0%, data   0.0%)\n")
+	assert.Contains(t, report, "bank $02:   0.0% (code   0.0%, data   0.0%)\n  $4000 D...")
+	assert.Contains(t, report, "total: 0.0% of 65536 bytes\n")
+	assert.Equal(t, 4*(1+4)+1, strings.Count(report, "\n"))
+}
@@ -0,0 +1,361 @@
+package emulator
+
+import "image/color"
+
+// https://gbdev.io/pandocs/CGB_Registers.html
+const (
+	PORT_KEY1  = 0xFF4D // prepare speed switch
+	PORT_VBK   = 0xFF4F // VRAM bank
+	PORT_HDMA1 = 0xFF51 // source, high
+	PORT_HDMA2 = 0xFF52 // source, low
+	PORT_HDMA3 = 0xFF53 // destination, high
+	PORT_HDMA4 = 0xFF54 // destination, low
+	PORT_HDMA5 = 0xFF55 // length/mode/start
+	PORT_BCPS  = 0xFF68 // background palette index
+	PORT_BCPD  = 0xFF69 // background palette data
+	PORT_OCPS  = 0xFF6A // object palette index
+	PORT_OCPD  = 0xFF6B // object palette data
+	PORT_SVBK  = 0xFF70 // WRAM bank
+
+	// https://gbdev.io/pandocs/Memory_Map.html#memory-map
+	WRAM_BANK_NN_START = Word(0xD000)
+	WRAM_BANK_NN_END   = Word(0xDFFF)
+
+	VRAM_BANK_SIZE = 0x2000
+	WRAM_BANK_SIZE = 0x1000
+	WRAM_BANKS     = 8
+
+	// 8 palettes of 4 colors, 2 bytes per color
+	PALETTE_RAM_SIZE = 64
+)
+
+// Color CGB 15-bit RGB color, as stored in the palette RAM (bits 0-4 red, 5-9 green, 10-14 blue)
+// https://gbdev.io/pandocs/Palettes.html#lcd-color-palettes-cgb-only
+type Color uint16
+
+// RGBA converts the color to 8 bits per channel
+func (c Color) RGBA() color.RGBA {
+	scale := func(v Color) uint8 {
+		v &= 0x1F
+		return uint8(v<<3 | v>>2)
+	}
+	return color.RGBA{R: scale(c), G: scale(c >> 5), B: scale(c >> 10), A: 0xFF}
+}
+
+// shade approximates the color as a DMG shade (0-3), used by the grayscale outputs
+func (c Color) shade() Pixel {
+	r, g, b := int(c&0x1F), int((c>>5)&0x1F), int((c>>10)&0x1F)
+	luminance := (r*3 + g*6 + b) / 10
+	return Pixel(3 - luminance*4/32)
+}
+
+// hdma VRAM DMA transfer in progress
+// https://gbdev.io/pandocs/CGB_Registers.html#lcd-vram-dma-transfers
+type hdma struct {
+	source      Word
+	destination Word
+	blocks      int // remaining 16-byte blocks
+	active      bool
+}
+
+// cgbModel reports if the model runs CGB cartridges in CGB mode
+func cgbModel(mode Mode) bool {
+	return mode == CGB || mode == AGB || mode == AGS
+}
+
+// enableCGB switches the memory to CGB mode (banked VRAM/WRAM and the CGB registers)
+func (m *Memory) enableCGB() {
+	m.cgb = true
+
+	// the boot ROM initializes the background palettes to white
+	for i := range m.bgPalette {
+		m.bgPalette[i] = 0xFF
+	}
+}
+
+// doubleSpeed reports if the CPU runs at double speed (KEY1 bit 7)
+func (m *Memory) doubleSpeed() bool {
+	return m.cgb && m.mem[PORT_KEY1]&0x80 > 0
+}
+
+// switchSpeed toggles the CPU speed if it was prepared through KEY1, used by STOP
+func (m *Memory) switchSpeed() bool {
+	if !m.cgb || m.mem[PORT_KEY1]&0x1 == 0 {
+		return false
+	}
+	m.mem[PORT_KEY1] = (m.mem[PORT_KEY1] ^ 0x80) & 0x80
+	return true
+}
+
+// wramOffset offset of the address into the switchable WRAM banks (SVBK, bank 0 selects bank 1)
+func (m *Memory) wramOffset(address Word) int {
+	bank := int(m.mem[PORT_SVBK] & 0x7)
+	if bank == 0 {
+		bank = 1
+	}
+	return (bank-1)*WRAM_BANK_SIZE + int(address-WRAM_BANK_NN_START)
+}
+
+// vram reads from a VRAM bank, regardless of VBK (used by the PPU)
+func (m *Memory) vram(bank uint8, address Word) uint8 {
+	if bank == 1 && m.cgb {
+		return m.vram1[address-VRAM_START]
+	}
+	return m.mem[address]
+}
+
+// readCGB reads the banked areas and CGB registers, returns false if not handled
+func (m *Memory) readCGB(address Word) (uint8, bool) {
+
+	switch {
+	case address >= VRAM_START && address <= VRAM_END && m.mem[PORT_VBK]&0x1 > 0:
+		return m.vram1[address-VRAM_START], true
+	case address >= WRAM_BANK_NN_START && address <= WRAM_BANK_NN_END:
+		return m.wram[m.wramOffset(address)], true
+	}
+
+	switch address {
+	case PORT_KEY1:
+		return m.mem[address] | 0x7E, true
+	case PORT_VBK:
+		return m.mem[address] | 0xFE, true
+	case PORT_HDMA1, PORT_HDMA2, PORT_HDMA3, PORT_HDMA4:
+		return 0xFF, true
+	case PORT_HDMA5:
+		// remaining blocks - 1, bit 7 set when no transfer is active
+		if !m.hdma.active {
+			return 0xFF, true
+		}
+		return uint8(m.hdma.blocks-1) & 0x7F, true
+	case PORT_BCPS, PORT_OCPS:
+		return m.mem[address] | 0x40, true
+	case PORT_BCPD:
+		return m.bgPalette[m.mem[PORT_BCPS]&0x3F], true
+	case PORT_OCPD:
+		return m.objPalette[m.mem[PORT_OCPS]&0x3F], true
+	case PORT_SVBK:
+		return m.mem[address] | 0xF8, true
+	}
+
+	return 0, false
+}
+
+// writeCGB writes the banked areas and CGB registers, returns false if not handled
+func (m *Memory) writeCGB(address Word, value uint8) bool {
+
+	switch {
+	case address >= VRAM_START && address <= VRAM_END && m.mem[PORT_VBK]&0x1 > 0:
+		m.vram1[address-VRAM_START] = value
+		return true
+	case address >= WRAM_BANK_NN_START && address <= WRAM_BANK_NN_END:
+		m.wram[m.wramOffset(address)] = value
+		return true
+	}
+
+	switch address {
+	case PORT_KEY1:
+		// only the prepare bit is writable
+		m.mem[address] = (m.mem[address] & 0x80) | (value & 0x1)
+	case PORT_VBK:
+		m.mem[address] = value & 0x1
+	case PORT_HDMA5:
+		m.startHDMA(value)
+	case PORT_BCPS, PORT_OCPS:
+		m.mem[address] = value & 0xBF
+	case PORT_BCPD:
+		writePalette(&m.bgPalette, &m.mem[PORT_BCPS], value)
+	case PORT_OCPD:
+		writePalette(&m.objPalette, &m.mem[PORT_OCPS], value)
+	case PORT_SVBK:
+		m.mem[address] = value & 0x7
+	default:
+		return false
+	}
+
+	return true
+}
+
+// writePalette writes into the palette RAM at the index register, auto incrementing it (bit 7)
+// https://gbdev.io/pandocs/Palettes.html#ff68--bcpsbgpi-cgb-mode-only-background-color-palette-specification--background-palette-index
+func writePalette(palette *[PALETTE_RAM_SIZE]uint8, spec *uint8, value uint8) {
+	index := *spec & 0x3F
+	palette[index] = value
+	if *spec&0x80 > 0 {
+		*spec = 0x80 | ((index + 1) & 0x3F)
+	}
+}
+
+// startHDMA starts a general purpose (bit 7 = 0) or HBlank (bit 7 = 1) VRAM DMA transfer
+func (m *Memory) startHDMA(value uint8) {
+
+	// writing bit 7 = 0 during a HBlank transfer stops it
+	if m.hdma.active && value&0x80 == 0 {
+		m.hdma.active = false
+		return
+	}
+
+	m.hdma.source = NewWord(m.mem[PORT_HDMA1], m.mem[PORT_HDMA2]) & 0xFFF0
+	m.hdma.destination = VRAM_START + (NewWord(m.mem[PORT_HDMA3], m.mem[PORT_HDMA4]) & 0x1FF0)
+	m.hdma.blocks = int(value&0x7F) + 1
+
+	if value&0x80 > 0 {
+		m.hdma.active = true
+		return
+	}
+
+	// general purpose DMA, copied at once (the CPU is halted during the transfer)
+	for m.hdma.blocks > 0 {
+		m.copyHDMABlock()
+	}
+}
+
+// hblankDMA copies the next block of a HBlank transfer, called when the PPU enters the HBlank
+func (m *Memory) hblankDMA() {
+	if m.cgb && m.hdma.active {
+		m.copyHDMABlock()
+	}
+}
+
+func (m *Memory) copyHDMABlock() {
+	for i := Word(0); i < 16; i++ {
+		// the destination wraps inside the VRAM
+		m.Write(VRAM_START+((m.hdma.destination+i-VRAM_START)&(VRAM_BANK_SIZE-1)), m.Read(m.hdma.source+i))
+	}
+	m.hdma.source += 16
+	m.hdma.destination += 16
+	m.hdma.blocks--
+	if m.hdma.blocks == 0 {
+		m.hdma.active = false
+	}
+}
+
+// bgColor color of a background palette (0-7) entry (0-3)
+func (m *Memory) bgColor(palette, pixel uint8) Color {
+	i := palette*8 + pixel*2
+	return Color(uint16(m.bgPalette[i])|uint16(m.bgPalette[i+1])<<8) & 0x7FFF
+}
+
+// objColor color of an object palette (0-7) entry (1-3)
+func (m *Memory) objColor(palette, pixel uint8) Color {
+	i := palette*8 + pixel*2
+	return Color(uint16(m.objPalette[i])|uint16(m.objPalette[i+1])<<8) & 0x7FFF
+}
+
+// tileAddress tile data address, LCDC bit 4 selects the 0x8000 (unsigned) or 0x9000 (signed) addressing
+func tileAddress(tileNumber, mode uint8) Word {
+	if mode == 1 {
+		return 0x8000 + Word(tileNumber)*16
+	}
+	return Word(0x9000 + int(int8(tileNumber))*16)
+}
+
+// tilePixel returns the color index (0-3) of the pixel in the tile row (already flipped)
+func (v *Video) tilePixel(bank uint8, address Word, row, col int) uint8 {
+	l1 := v.mem.vram(bank, address+Word(2*row))
+	l2 := v.mem.vram(bank, address+Word(2*row)+1)
+	bit := 7 - col
+	return ((l2>>bit)&0x1)<<1 | (l1>>bit)&0x1
+}
+
+// cgbMapPixel returns the color index and the attributes (VRAM bank 1) of the pixel at x, y of the tile map
+// https://gbdev.io/pandocs/Tile_Maps.html#bg-map-attributes-cgb-mode-only
+func (v *Video) cgbMapPixel(tileMap Word, x, y int) (uint8, uint8) {
+
+	offset := Word(((x / 8) & 0x1F) + 32*((y/8)&0x1F))
+	tileNumber := v.mem.vram(0, tileMap+offset)
+	attrs := v.mem.vram(1, tileMap+offset)
+
+	row := y % 8
+	if attrs&0x40 > 0 {
+		row = 7 - row
+	}
+
+	col := x % 8
+	if attrs&0x20 > 0 {
+		col = 7 - col
+	}
+
+	mode := (v.mem.Read(LCDC_REGISTER) & 0x10) >> 4
+	return v.tilePixel((attrs&0x8)>>3, tileAddress(tileNumber, mode), row, col), attrs
+}
+
+// cgbObjPixel returns the color index of the object pixel at x, y
+func (v *Video) cgbObjPixel(o Sprite, x, y int) uint8 {
+
+	height := int(v.height())
+
+	// 8x16 objects ignore the tile index bit 0
+	tile := o.tile
+	if height == 16 {
+		tile &= 0xFE
+	}
+
+	row := (y - int(o.yPos)) % height
+	if o.flags&0x40 > 0 {
+		row = height - 1 - row
+	}
+
+	col := (x - int(o.xPos)) % 8
+	if o.flags&0x20 > 0 {
+		col = 7 - col
+	}
+
+	return v.tilePixel((o.flags&0x8)>>3, tileAddress(tile, 1), row, col)
+}
+
+// renderCGB renders the pixel at the current scan position in CGB mode
+func (v *Video) renderCGB() {
+
+	lcdc := v.mem.Read(LCDC_REGISTER)
+	x := v.scancolumn
+	y := v.scanline
+
+	// background, always drawn (LCDC bit 0 is the BG/window master priority)
+	bgMap := Word(VRAM_BACKGROUND_START)
+	if lcdc&0x8 > 0 {
+		bgMap = VRAM_WINDOW_START
+	}
+
+	scy := int(v.mem.Read(0xFF42))
+	scx := int(v.mem.Read(0xFF43))
+	pixel, attrs := v.cgbMapPixel(bgMap, (x+scx)&0xFF, (y+scy)&0xFF)
+
+	// window
+	wy := int(v.mem.Read(0xFF4A))
+	wx := int(v.mem.Read(0xFF4B)) - 7 // the window starts off screen below 7
+	if lcdc&0x20 > 0 && wy <= y && x >= wx {
+		winMap := Word(VRAM_BACKGROUND_START)
+		if lcdc&0x40 > 0 {
+			winMap = VRAM_WINDOW_START
+		}
+		pixel, attrs = v.cgbMapPixel(winMap, x-wx, v.windowLine)
+		v.windowDrawn = true
+	}
+
+	color := v.mem.bgColor(attrs&0x7, pixel)
+
+	// objects, in OAM order
+	if lcdc&0x2 > 0 {
+		for _, o := range v.buffer {
+
+			if x < int(o.xPos) || int(o.xPos)+8 <= x {
+				continue
+			}
+
+			objPx := v.cgbObjPixel(o, x, y)
+			if objPx == 0 {
+				continue
+			}
+
+			// BG colors 1-3 are drawn over the object if the BG attributes or the object ask for it,
+			// unless the BG/window master priority is off
+			if lcdc&0x1 == 0 || pixel == 0 || (attrs&0x80 == 0 && o.flags&0x80 == 0) {
+				color = v.mem.objColor(o.flags&0x7, objPx)
+			}
+			break
+		}
+	}
+
+	v.colorMemory[y][x] = color
+	v.videoMemory[y][x] = color.shade()
+}
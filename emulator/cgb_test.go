@@ -0,0 +1,215 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCGB returns a CGB powered up with a CGB cartridge running the program
+func newCGB(t *testing.T, program ...uint8) *GameBoy {
+	rom := make([]uint8, 0x8000)
+	rom[CARTRIDGE_HEADER_CGB_FLAG] = 0x80
+	copy(rom[CPU_START:], program)
+
+	g := NewGameBoy(Config{Silent: true, Model: CGB})
+	assert.NoError(t, g.LoadROM(rom))
+	assert.NoError(t, g.init())
+	return g
+}
+
+func TestCGB(t *testing.T) {
+
+	t.Run("dmg model", func(t *testing.T) {
+		rom := make([]uint8, 0x8000)
+		rom[CARTRIDGE_HEADER_CGB_FLAG] = 0x80
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(rom))
+		assert.NoError(t, g.init())
+		assert.False(t, g.CGB())
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(PORT_VBK))
+	})
+
+	t.Run("vram banks", func(t *testing.T) {
+		g := newCGB(t)
+		assert.True(t, g.CGB())
+		g.WriteMemory(0x8000, 0x11)
+		g.WriteMemory(PORT_VBK, 0x1)
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(PORT_VBK))
+		assert.Equal(t, uint8(0x00), g.ReadMemory(0x8000))
+		g.WriteMemory(0x8000, 0x22)
+		g.WriteMemory(PORT_VBK, 0x0)
+		assert.Equal(t, uint8(0x11), g.ReadMemory(0x8000))
+		assert.Equal(t, uint8(0x22), g.c.memory.vram(1, 0x8000))
+	})
+
+	t.Run("wram banks", func(t *testing.T) {
+		g := newCGB(t)
+		for bank := uint8(0); bank < WRAM_BANKS; bank++ {
+			g.WriteMemory(PORT_SVBK, bank)
+			g.WriteMemory(0xD000, 0x10+bank)
+		}
+		g.WriteMemory(PORT_SVBK, 0x3)
+		assert.Equal(t, uint8(0x13), g.ReadMemory(0xD000))
+		assert.Equal(t, uint8(0xFB), g.ReadMemory(PORT_SVBK))
+
+		// bank 0 selects bank 1
+		g.WriteMemory(PORT_SVBK, 0x0)
+		assert.Equal(t, uint8(0x11), g.ReadMemory(0xD000))
+	})
+
+	t.Run("palette auto increment", func(t *testing.T) {
+		g := newCGB(t)
+		g.WriteMemory(PORT_BCPS, 0x80|0x8)
+		g.WriteMemory(PORT_BCPD, 0x1F)
+		g.WriteMemory(PORT_BCPD, 0x00)
+		assert.Equal(t, uint8(0xCA), g.ReadMemory(PORT_BCPS))
+		assert.Equal(t, Color(0x001F), g.c.memory.bgColor(1, 0))
+
+		g.WriteMemory(PORT_OCPS, 0x3F)
+		g.WriteMemory(PORT_OCPD, 0x7C)
+		g.WriteMemory(PORT_OCPD, 0x55)
+		assert.Equal(t, uint8(0x7F), g.ReadMemory(PORT_OCPS))
+		assert.Equal(t, uint8(0x55), g.ReadMemory(PORT_OCPD))
+	})
+
+	t.Run("general purpose dma", func(t *testing.T) {
+		g := newCGB(t)
+		for i := range uint16(32) {
+			g.WriteMemory(0xC000+i, uint8(i))
+		}
+		g.WriteMemory(PORT_VBK, 0x1)
+		g.WriteMemory(PORT_HDMA1, 0xC0)
+		g.WriteMemory(PORT_HDMA2, 0x00)
+		g.WriteMemory(PORT_HDMA3, 0x01)
+		g.WriteMemory(PORT_HDMA4, 0x00)
+		g.WriteMemory(PORT_HDMA5, 0x01) // 2 blocks
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(PORT_HDMA5))
+		assert.Equal(t, uint8(31), g.c.memory.vram(1, 0x811F))
+	})
+
+	t.Run("hblank dma", func(t *testing.T) {
+		g := newCGB(t)
+		g.WriteMemory(0xC010, 0x42)
+		g.WriteMemory(PORT_HDMA1, 0xC0)
+		g.WriteMemory(PORT_HDMA2, 0x00)
+		g.WriteMemory(PORT_HDMA3, 0x00)
+		g.WriteMemory(PORT_HDMA4, 0x00)
+		g.WriteMemory(PORT_HDMA5, 0x82) // 3 blocks
+		assert.Equal(t, uint8(0x02), g.ReadMemory(PORT_HDMA5))
+
+		g.c.memory.hblankDMA()
+		assert.Equal(t, uint8(0x01), g.ReadMemory(PORT_HDMA5))
+		g.c.memory.hblankDMA()
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0x8010))
+
+		// stopped
+		g.WriteMemory(PORT_HDMA5, 0x00)
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(PORT_HDMA5))
+	})
+
+	t.Run("speed switch", func(t *testing.T) {
+		g := newCGB(t,
+			0x3E, 0x01, // LD A, 1
+			0xE0, 0x4D, // LDH [KEY1], A
+			0x10, 0x00, // STOP
+			0x3E, 0x42, // LD A, 0x42
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0x18, 0xFE, // JR -2
+		)
+		assert.NoError(t, g.RunFrame())
+		assert.True(t, g.c.memory.doubleSpeed())
+		assert.Equal(t, uint8(0xFE), g.ReadMemory(PORT_KEY1))
+		assert.Equal(t, uint8(0x42), g.ReadMemory(0xC000))
+	})
+
+	t.Run("render", func(t *testing.T) {
+		g := newCGB(t)
+
+		// tile 1 (VRAM bank 1), color 1 on every pixel
+		g.WriteMemory(PORT_VBK, 0x1)
+		for i := range uint16(8) {
+			g.WriteMemory(0x8010+i*2, 0xFF)
+		}
+		// BG attributes, palette 2, tile from bank 1
+		g.WriteMemory(0x9800, 0x08|0x2)
+		g.WriteMemory(PORT_VBK, 0x0)
+		g.WriteMemory(0x9800, 0x01)
+
+		// palette 2 color 1 red
+		g.WriteMemory(PORT_BCPS, 0x80|0x12)
+		g.WriteMemory(PORT_BCPD, 0x1F)
+		g.WriteMemory(PORT_BCPD, 0x00)
+
+		g.WriteMemory(LCDC_REGISTER, 0x91)
+		g.WriteMemory(0xFF42, 0x00)
+		g.WriteMemory(0xFF43, 0x00)
+		g.video.scanline = 0
+		g.video.scancolumn = 0
+		g.video.renderCGB()
+
+		assert.Equal(t, Color(0x001F), g.video.colorMemory[0][0])
+		assert.Equal(t, Color(0x001F).RGBA(), g.ColorScreenshot().RGBAAt(0, 0))
+	})
+	t.Run("window left edge", func(t *testing.T) {
+		g := newCGB(t)
+
+		// window tile 1, color 1 on every pixel, palette 2 color 1 red
+		for i := range uint16(8) {
+			g.WriteMemory(0x8010+i*2, 0xFF)
+		}
+		g.WriteMemory(0x9C00, 0x01)
+		g.WriteMemory(PORT_VBK, 0x1)
+		g.WriteMemory(0x9C00, 0x2)
+		g.WriteMemory(PORT_VBK, 0x0)
+		g.WriteMemory(PORT_BCPS, 0x80|0x12)
+		g.WriteMemory(PORT_BCPD, 0x1F)
+		g.WriteMemory(PORT_BCPD, 0x00)
+
+		// window at 0x9C00, WX below 7 (shifted left)
+		g.WriteMemory(LCDC_REGISTER, 0x91|0x20|0x40)
+		g.WriteMemory(0xFF4A, 0)
+		g.WriteMemory(0xFF4B, 3)
+		g.video.scanline = 0
+		g.video.scancolumn = 0
+		g.video.renderCGB()
+
+		assert.Equal(t, Color(0x001F), g.video.colorMemory[0][0])
+	})
+
+	t.Run("window line counter", func(t *testing.T) {
+		g := newCGB(t)
+
+		// window tile 1, row 0 color 1 (red) and row 1 color 2 (green), palette 2
+		g.WriteMemory(0x8010, 0xFF)
+		g.WriteMemory(0x8013, 0xFF)
+		g.WriteMemory(0x9C00, 0x01)
+		g.WriteMemory(PORT_VBK, 0x1)
+		g.WriteMemory(0x9C00, 0x2)
+		g.WriteMemory(PORT_VBK, 0x0)
+		g.WriteMemory(PORT_BCPS, 0x80|0x12)
+		for _, b := range []uint8{0x1F, 0x00, 0xE0, 0x03} {
+			g.WriteMemory(PORT_BCPD, b)
+		}
+
+		g.WriteMemory(0xFF4A, 0)
+		g.WriteMemory(0xFF4B, 7)
+		g.video.windowLine = 0
+		g.video.scancolumn = 0
+		render := func(y int, lcdc uint8) {
+			g.WriteMemory(LCDC_REGISTER, lcdc)
+			g.video.scanline = y
+			g.video.renderCGB()
+			g.video.nextWindowLine()
+		}
+
+		// the window is hidden on line 1, line 2 draws the window row 1
+		render(0, 0x91|0x20|0x40)
+		render(1, 0x91|0x40)
+		render(2, 0x91|0x20|0x40)
+
+		assert.Equal(t, Color(0x001F), g.video.colorMemory[0][0])
+		assert.Equal(t, Color(0x03E0), g.video.colorMemory[2][0])
+		assert.Equal(t, 2, g.video.windowLine)
+	})
+}
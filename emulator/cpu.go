@@ -1,20 +1,11 @@
 package emulator
 
 import (
-	_ "embed"
-	"encoding/json"
-	"fmt"
+	"bufio"
 	"log"
 	"runtime/debug"
-	"strconv"
-	"strings"
-
-	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-//go:embed opcodes.json
-var opcodesFile []byte
-
 type Mode string
 
 const (
@@ -24,13 +15,9 @@ const (
 	CPU_START = Word(0x0100)
 )
 
+// hardware models, see Config.Model
 const (
-	STEP_QUIT = iota
-	STEP_RESUME
-	STEP_NEXT
-)
-
-const (
+	DMG0 Mode = "DMG0"
 	DMG  Mode = "DMG"
 	MGB  Mode = "MGB"
 	SGB  Mode = "SGB"
@@ -40,11 +27,8 @@ const (
 	AGS  Mode = "AGS"
 )
 
-// Opcodes used for debugging purposes
-type Opcodes struct {
-	Unprefixed map[string]json.RawMessage `json:"unprefixed"`
-	Cbprefixed map[string]json.RawMessage `json:"cbprefixed"`
-}
+// Models supported hardware models
+var Models = []Mode{DMG0, DMG, MGB, SGB, SGB2, CGB, AGB, AGS}
 
 type Cpu struct {
 	memory *Memory // 8-bit address bus
@@ -61,74 +45,157 @@ type Cpu struct {
 
 	requiredCycles int
 
-	scheduledSerial int
 	scheduledOAMDma int
 	oamDmaSource    int
 
+	// hardware model
+	mode Mode
+
 	// general purpose register pairs
 	reg Registers
 
 	haltBug bool
 	halted  bool
 
-	debug       bool
-	step        bool
-	profiling   bool
-	stopped     bool
-	breakPoints string
-	cbprefixed  bool
-	silent      bool
-	opcodes     *Opcodes
+	debug      bool
+	step       bool
+	profiling  bool
+	stopped    bool
+	cbprefixed bool
+	silent     bool
+	softBreak  *CpuRegisters // registers at the first LD B,B since the last GameBoy.SoftBreakpoint
+	serial     *SerialPort
+	debugger   *Debugger
+	trace      *bufio.Writer // gameboy-doctor log (see Config.Trace)
+	profiler   *Profiler     // guest code profile (see Config.Profile)
 }
 
 func (c *Cpu) fetch() uint8 {
-	// read from memory
+	return c.fetchAs(CDL_OPERAND)
+}
+
+// fetchOpcode fetches the first byte of an instruction
+func (c *Cpu) fetchOpcode() uint8 {
+	return c.fetchAs(CDL_OPCODE)
+}
+
+func (c *Cpu) fetchAs(flags uint8) uint8 {
+	// read from memory, operands aren't watched nor logged as data
+	watching, logging := c.memory.watching, c.memory.logging
+	c.memory.watching, c.memory.logging = false, false
 	data := c.memory.Read(c.pc)
+	c.memory.watching, c.memory.logging = watching, logging
+	c.memory.logROM(c.pc, flags)
 	c.previousPC = c.pc
 	c.pc++
 	return data
 }
 
 func (c *Cpu) setup(mode Mode) {
+
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#014d--header-checksum
+	checksum := c.memory.Read(CARTRIDGE_HEADER_CHECKSUM)
+
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#0143--cgb-flag
+	cgbCartridge := c.memory.Read(CARTRIDGE_HEADER_CGB_FLAG)&0x80 > 0
+
+	// https://gbdev.io/pandocs/Power_Up_Sequence.html#cpu-registers
 	switch mode {
-	case DMG:
+	case DMG0:
+		c.reg.w8(reg_a, 0x01)
 		c.reg.w_flag(0x0)
+		c.reg.w16(reg_bc, 0xFF13)
+		c.reg.w16(reg_de, 0x00C1)
+		c.reg.w16(reg_hl, 0x8403)
+	case DMG, MGB:
 		c.reg.w8(reg_a, 0x01)
-		c.reg.w8(reg_f, 0xB0)
+		if mode == MGB {
+			c.reg.w8(reg_a, 0xFF)
+		}
+		// carry and half-carry are set unless the header checksum is 0x00
+		if checksum == 0 {
+			c.reg.w_flag(z_flag)
+		} else {
+			c.reg.w_flag(z_flag | h_flag | c_flag)
+		}
 		c.reg.w16(reg_bc, 0x0013)
 		c.reg.w16(reg_de, 0x00D8)
 		c.reg.w16(reg_hl, 0x014D)
-		c.sp = 0xFFFE
-		c.pc = CPU_START
-
-		// https://gbdev.io/pandocs/Power_Up_Sequence.html#hardware-registers
-		c.memory.Write(LCDC_REGISTER, 0x91)
-		c.memory.Write(LCD_REGISTER, 0x85)
-		c.memory.Write(INTERRUPT_FLAG, 0xE1)
-		c.memory.Write(PORT_SERIAL_TRANSFER_SC, 0x7E)
-		c.memory.Write(PORT_SERIAL_TRANSFER_SB, 0x00)
-		c.memory.mem[PORT_JOYPAD] = 0xCF // must bypass write method
-		c.memory.mem[NR10] = 0x80
-		c.memory.mem[NR11] = 0xBF
-		c.memory.mem[NR12] = 0xF3
-		c.memory.mem[NR13] = 0xFF
-		c.memory.mem[NR14] = 0xBF
-		c.memory.mem[NR21] = 0x3F
-		c.memory.mem[NR22] = 0x00
-		c.memory.mem[NR23] = 0xFF
-		c.memory.mem[NR24] = 0xBf
-		c.memory.mem[NR30] = 0x7F
-		c.memory.mem[NR31] = 0xFF
-		c.memory.mem[NR32] = 0x9F
-		c.memory.mem[NR33] = 0xFF
-		c.memory.mem[NR34] = 0xBF
-		c.memory.mem[NR41] = 0xFF
-		c.memory.mem[NR42] = 0x00
-		c.memory.mem[NR43] = 0x00
-		c.memory.mem[NR44] = 0xBF
-		c.memory.mem[NR50] = 0x77
-		c.memory.mem[NR51] = 0xF3
-		c.memory.mem[NR52] = 0xF1
+	case SGB, SGB2:
+		c.reg.w8(reg_a, 0x01)
+		if mode == SGB2 {
+			c.reg.w8(reg_a, 0xFF)
+		}
+		c.reg.w_flag(0x0)
+		c.reg.w16(reg_bc, 0x0014)
+		c.reg.w16(reg_de, 0x0000)
+		c.reg.w16(reg_hl, 0xC060)
+	case CGB, AGB, AGS:
+		c.reg.w8(reg_a, 0x11)
+		c.reg.w_flag(z_flag)
+		c.reg.w16(reg_bc, 0x0000)
+		if mode != CGB {
+			// the AGB boot ROM ends with INC B
+			c.reg.w_flag(0x0)
+			c.reg.w16(reg_bc, 0x0100)
+		}
+		// DMG cartridges (compatibility mode), B/HL also depend on the licensee and title on hardware
+		if cgbCartridge {
+			c.reg.w16(reg_de, 0xFF56)
+			c.reg.w16(reg_hl, 0x000D)
+		} else {
+			c.reg.w16(reg_de, 0x0008)
+			c.reg.w16(reg_hl, 0x007C)
+		}
+	}
+
+	c.sp = 0xFFFE
+	c.pc = CPU_START
+
+	// https://gbdev.io/pandocs/Power_Up_Sequence.html#hardware-registers
+	c.memory.Write(LCDC_REGISTER, 0x91)
+	c.memory.Write(LCD_REGISTER, 0x85)
+	c.memory.Write(INTERRUPT_FLAG, 0xE1)
+	c.memory.Write(PORT_SERIAL_TRANSFER_SC, 0x7E)
+	c.memory.Write(PORT_SERIAL_TRANSFER_SB, 0x00)
+	c.memory.Write(BGP_REGISTER, 0xFC)
+	c.memory.mem[PORT_JOYPAD] = 0xCF // must bypass write method
+	c.memory.mem[PORT_OAM_DMA_CONTROL] = 0xFF
+	c.memory.mem[NR10] = 0x80
+	c.memory.mem[NR11] = 0xBF
+	c.memory.mem[NR12] = 0xF3
+	c.memory.mem[NR13] = 0xFF
+	c.memory.mem[NR14] = 0xBF
+	c.memory.mem[NR21] = 0x3F
+	c.memory.mem[NR22] = 0x00
+	c.memory.mem[NR23] = 0xFF
+	c.memory.mem[NR24] = 0xBf
+	c.memory.mem[NR30] = 0x7F
+	c.memory.mem[NR31] = 0xFF
+	c.memory.mem[NR32] = 0x9F
+	c.memory.mem[NR33] = 0xFF
+	c.memory.mem[NR34] = 0xBF
+	c.memory.mem[NR41] = 0xFF
+	c.memory.mem[NR42] = 0x00
+	c.memory.mem[NR43] = 0x00
+	c.memory.mem[NR44] = 0xBF
+	c.memory.mem[NR50] = 0x77
+	c.memory.mem[NR51] = 0xF3
+	c.memory.mem[NR52] = 0xF1
+
+	switch mode {
+	case DMG0:
+		c.memory.Write(LCD_REGISTER, 0x81)
+	case SGB, SGB2:
+		// no boot sound, channel 1 is off
+		c.memory.mem[NR52] = 0xF0
+		if c.memory.sound != nil {
+			c.memory.sound.disableSCH1 = true
+		}
+		c.memory.mem[PORT_JOYPAD] = 0xFF // no line selected, the packets are sent
+	case CGB, AGB, AGS:
+		c.memory.Write(PORT_SERIAL_TRANSFER_SC, 0x7F)
+		c.memory.mem[PORT_OAM_DMA_CONTROL] = 0x00
 	}
 }
 
@@ -584,6 +651,13 @@ func (c *Cpu) interruptRequested() bool {
 		log.Printf("INTERRUPT ACKNOWLEDGED IFLAG=%.8b IENABLE=%.8b\n", iflag, ienable)
 	}
 
+	// debugger interrupt break points, profiler handler frame
+	serviced := (c.memory.Read(INTERRUPT_FLAG) ^ iflag) & 0x1F
+	c.debugger.interrupt(c, serviced)
+	if c.profiler != nil {
+		c.profiler.interrupt(c, serviced)
+	}
+
 	// acknowledge
 	c.memory.Write(INTERRUPT_FLAG, iflag)
 
@@ -602,35 +676,8 @@ func (c *Cpu) sync(cycle int) {
 		}
 	}()
 
-	sb := c.memory.Read(PORT_SERIAL_TRANSFER_SB)
-	sc := c.memory.Read(PORT_SERIAL_TRANSFER_SC)
-
-	if !c.halted && sc&0x80 > 0 && sc&0x1 > 0 { // transfer enabled AND clock master
-
-		modulo := 80 // 262144 Hz
-		if sc&0x2 > 0 {
-			modulo = 16
-		}
-
-		if cycle%modulo == 0 {
-			if c.scheduledSerial == 0 {
-				log.Printf("RECEIVED %d (0x%.8X) ROM SERIAL (PC=0x%.8X)\n", sb, sb, c.pc)
-				c.scheduledSerial = 8
-			}
-
-			if c.scheduledSerial > 0 {
-				c.memory.Write(PORT_SERIAL_TRANSFER_SB, sb<<1) // incoming data
-				c.scheduledSerial--
-			}
-
-			if c.scheduledSerial == 0 {
-				c.memory.Write(PORT_SERIAL_TRANSFER_SB, 0x0)     // clear SB
-				c.memory.Write(PORT_SERIAL_TRANSFER_SC, sc&0x7F) // clear bit 7
-				// request SERIAL interruption
-				c.memory.Write(INTERRUPT_FLAG, c.memory.Read(INTERRUPT_FLAG)|0x8)
-			}
-		}
-	}
+	// serial port (link cable), runs while halted
+	c.serial.sync()
 
 	if !c.halted && c.scheduledOAMDma >= 0 && !c.memory.dma {
 		if c.scheduledOAMDma < 160 {
@@ -654,6 +701,10 @@ func (c *Cpu) sync(cycle int) {
 		c.halted = false
 	}
 
+	if c.halted && c.profiler != nil {
+		c.profiler.halted(c)
+	}
+
 	// if no opcode was read cycles is 0 (first cycle) or 1 (parallel fetch)
 	if !c.halted && c.opcode == 0 && c.remainingCycles <= 1 {
 
@@ -667,7 +718,7 @@ func (c *Cpu) sync(cycle int) {
 		}
 
 		// fetch opcode from memory
-		c.opcode = c.fetch()
+		c.opcode = c.fetchOpcode()
 
 		// https://gbdev.io/pandocs/halt.html#halt-bug
 		if c.haltBug {
@@ -696,85 +747,69 @@ func (c *Cpu) sync(cycle int) {
 		is, operation := c.decode(uint8(c.opcode))
 
 		if c.debug || operation == "unknown nop" {
-			if c.cbprefixed {
-				op, ok := c.opcodes.Cbprefixed[fmt.Sprintf("0x%.2X", c.opcode)]
-				if ok {
-					log.Printf("CB %s", string(op))
-				}
-			} else {
-				op, ok := c.opcodes.Unprefixed[fmt.Sprintf("0x%.2X", c.opcode)]
-				if ok {
-					log.Printf("%s", string(op))
-				}
-			}
+			log.Printf("%s\n", c.disassemble(c.instructionAddress()))
 			if operation == "unknown nop" {
 				c.step = true
 			}
 		}
 
-		if c.shouldStep(c.opcode, operation) {
-			var sb strings.Builder
-			sb.WriteString("STEP BEFORE\n")
-			sb.WriteString("*********************************\n")
-
-			sb.WriteString(fmt.Sprintf("\tOP (val=0x%X bit=%.8b name=%s) \n\tPC=0x%X\n\tSP=0x%X\n\tIME=%d\n\tPREV_PC=0x%X\n", c.opcode, c.opcode, operation, c.pc-1, c.sp, c.ime, c.previousPC))
-
-			sb.WriteString(fmt.Sprintf("\tREG_B=0x%X\n\tREG_C=0x%X\n\tREG_D=0x%X\n\tREG_E=0x%X\n\tREG_H=0x%X\n\tREG_L=0x%X\n\tREG_A=0x%X\n\tREG_F=0x%X\n", c.reg.r8(reg_b), c.reg.r8(reg_c), c.reg.r8(reg_d), c.reg.r8(reg_e), c.reg.r8(reg_h), c.reg.r8(reg_l), c.reg.r8(reg_a), c.reg.r8(reg_f)))
-
-			sb.WriteString(fmt.Sprintf("\tREG_BC=0x%X\n\tREG_DE=0x%X\n\tREG_HL=0x%X\n\tREG_SP=0x%X\n", c.reg.r16(reg_bc), c.reg.r16(reg_de), c.reg.r16(reg_hl), c.sp))
+		// debugger, stops before the instruction
+		if c.debugger.shouldBreak(c, operation) || c.step {
+			c.debugger.prompt(c)
+			if c.stopped {
+				return
+			}
 
-			sb.WriteString(fmt.Sprintf("\tZ_FLAG=%d\n\tN_FLAG=%d\n\tC_FLAG=%d\n\tH_FLAG=%d\n", c.reg.r_flags()&z_flag, c.reg.r_flags()&n_flag, c.reg.r_flags()&c_flag, c.reg.r_flags()&h_flag))
+			// PC changed by the debugger, decodes the instruction there instead
+			if jump := c.debugger.jump; jump != nil {
+				c.debugger.jump = nil
+				c.pc = *jump
+				c.opcode = c.fetchOpcode()
+				is, operation = c.decode(c.opcode)
+			}
+		}
 
-			sb.WriteString("*********************************\n")
+		if c.trace != nil {
+			c.traceInstruction()
+		}
 
-			log.Print(sb.String())
+		// execute, the watch points only see the memory accessed by the instruction
+		pc, sp := c.instructionAddress(), c.sp
+		c.memory.watching, c.memory.logging, c.memory.tracking = c.debugger.watching(), c.memory.cdl != nil, c.memory.written != nil
+		is(c, c.opcode)
+		c.memory.watching, c.memory.logging, c.memory.tracking = false, false, false
 
-			switch c.waitStep() {
-			case STEP_QUIT:
-				c.stopped = true
-				return
-			case STEP_RESUME:
-				c.step = false
-			}
+		if c.profiler != nil {
+			c.profiler.instruction(c, pc, sp)
 		}
 
-		// execute
-		is(c, c.opcode)
+		// LD B,B software breakpoint, used by test ROMs (e.g. mooneye) to signal the end of the test
+		if c.opcode == 0x40 && !c.cbprefixed && c.softBreak == nil {
+			regs := c.registers()
+			c.softBreak = &regs
+		}
 
 		// how many cycles for instruction
 		c.remainingCycles = c.requiredCycles
 
-		if c.shouldStep(c.opcode, operation) {
-			var sb strings.Builder
-			sb.WriteString("STEP AFTER\n")
-			sb.WriteString("*********************************\n")
-
-			sb.WriteString(fmt.Sprintf("\tOP (val=0x%X bit=%.8b name=%s) \n\tPC=0x%X\n\tSP=0x%X\n\tIME=%d\n\tPREV_PC=0x%X\n", c.opcode, c.opcode, operation, c.pc, c.sp, c.ime, c.previousPC))
-
-			sb.WriteString(fmt.Sprintf("\tREG_B=0x%X\n\tREG_C=0x%X\n\tREG_D=0x%X\n\tREG_E=0x%X\n\tREG_H=0x%X\n\tREG_L=0x%X\n\tREG_A=0x%X\n\tREG_F=0x%X\n", c.reg.r8(reg_b), c.reg.r8(reg_c), c.reg.r8(reg_d), c.reg.r8(reg_e), c.reg.r8(reg_h), c.reg.r8(reg_l), c.reg.r8(reg_a), c.reg.r8(reg_f)))
-
-			sb.WriteString(fmt.Sprintf("\tREG_BC=0x%X\n\tREG_DE=0x%X\n\tREG_HL=0x%X\n\tREG_SP=0x%X\n", c.reg.r16(reg_bc), c.reg.r16(reg_de), c.reg.r16(reg_hl), c.sp))
-
-			sb.WriteString(fmt.Sprintf("\tZ_FLAG=%d\n\tN_FLAG=%d\n\tC_FLAG=%d\n\tH_FLAG=%d\n", c.reg.r_flags()&z_flag, c.reg.r_flags()&n_flag, c.reg.r_flags()&c_flag, c.reg.r_flags()&h_flag))
-
-			sb.WriteString("*********************************\n")
-
-			log.Print(sb.String())
-
-			switch c.waitStep() {
-			case STEP_QUIT:
-				return
-			case STEP_RESUME:
-				c.step = false
+		if !c.silent {
+			var label string
+			if l := c.debugger.label(c, c.debugger.pc); l != "" {
+				label = " LABEL=" + l
 			}
-		} else if !c.silent {
-			log.Printf("OP (val=0x%X bit=%.8b name=%s) CYCLE=%d REMAINING=%d PC=0x%X SP=0x%X IME=%d HL=0x%X\n", c.opcode, c.opcode, operation, cycle, c.remainingCycles, c.pc-1, c.sp, c.ime, c.reg.r16(reg_hl))
+			log.Printf("OP (val=0x%X bit=%.8b name=%s) CYCLE=%d REMAINING=%d PC=0x%X SP=0x%X IME=%d HL=0x%X%s\n", c.opcode, c.opcode, operation, cycle, c.remainingCycles, c.pc-1, c.sp, c.ime, c.reg.r16(reg_hl), label)
 		}
 
 		if operation == "stop" {
-			log.Println("STOP INSTRUCTION RECEIVED")
-			c.stopped = true
-			return
+			// CGB speed switch (KEY1), skips the STOP operand
+			if c.memory.switchSpeed() {
+				log.Printf("SPEED SWITCH double=%t\n", c.memory.doubleSpeed())
+				c.pc++
+			} else {
+				log.Println("STOP INSTRUCTION RECEIVED")
+				c.stopped = true
+				return
+			}
 		}
 
 		if c.remainingCycles == 1 {
@@ -785,7 +820,7 @@ func (c *Cpu) sync(cycle int) {
 			}
 
 			// fetch opcode from memory
-			c.opcode = c.fetch()
+			c.opcode = c.fetchOpcode()
 
 		} else {
 			// reset opcode
@@ -813,90 +848,13 @@ func (c *Cpu) sync(cycle int) {
 
 func (c *Cpu) init() error {
 
-	// init classic game-boy
-	c.setup(DMG)
-
-	var opcodes Opcodes
-	if err := json.Unmarshal(opcodesFile, &opcodes); err != nil {
-		return err
-	}
-	c.opcodes = &opcodes
-	return nil
-}
-
-func (c *Cpu) shouldStep(opcode uint8, operation string) bool {
-
-	if c.step {
-		return true
-	}
-
-	bg := strings.TrimSpace(c.breakPoints)
-	if !c.step && bg == "" {
-		return false
-	}
-
-	for _, instruction := range strings.Split(bg, ";") {
-
-		parts := strings.SplitN(instruction, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		switch parts[0] {
-		case "PC":
-			n, err := strconv.ParseInt(parts[1], 16, 32)
-			if err != nil {
-				log.Printf("Invalid instruction filter syntax : %s\n", err.Error())
-			}
-			match := c.pc-1 == Word(n)
-			if match {
-				c.breakPoints = strings.Replace(c.breakPoints, instruction, "", 1)
-				c.step = true
-				c.memory.Write(0xFFFF, 1)
-			}
-			return match
-		case "OPC":
-			n, err := strconv.ParseInt(parts[1], 16, 32)
-			if err != nil {
-				log.Printf("Invalid instruction filter syntax : %s\n", err.Error())
-			}
-			match := opcode == uint8(n)
-			if match {
-				c.breakPoints = strings.Replace(c.breakPoints, instruction, "", 1)
-				c.step = true
-			}
-			return match
-		case "OPN":
-			match := strings.EqualFold(operation, parts[1])
-			if match {
-				c.breakPoints = strings.Replace(c.breakPoints, instruction, "", 1)
-				c.step = true
-			}
-			return match
-		}
+	if c.memory.bootROM != nil {
+		// power on, the boot ROM (from 0x0000) initializes the hardware registers
+		c.memory.mem[PORT_JOYPAD] = 0xCF // must bypass write method
+	} else {
+		// skip the boot ROM, registers as left by the model boot ROM
+		c.setup(c.mode)
 	}
 
-	return false
-}
-
-func (c *Cpu) waitStep() int {
-	for {
-
-		key := rl.GetKeyPressed()
-		if key == 0 {
-			continue
-		}
-
-		switch key {
-		case rl.KeyD:
-			c.debug = !c.debug
-		case rl.KeyEscape:
-		case rl.KeyQ:
-			return STEP_QUIT
-		case rl.KeyN:
-			return STEP_NEXT
-		case rl.KeyR:
-			return STEP_RESUME
-		}
-	}
+	return nil
 }
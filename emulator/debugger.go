@@ -0,0 +1,572 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Dudssource/shiny-cart/disasm"
+)
+
+const debuggerHelp = `commands (addresses, counts and values are hexadecimal, #10 for decimal, an empty line repeats the last command):
+  s, step [n]          execute n instructions (default 1)
+  n, next              step over calls (CALL, RST)
+  finish, out          run until the current routine returns
+  c, continue          resume the execution
+  until, runto <addr>  run until PC reaches addr (addresses can be labels)
+  r, regs              show the registers
+  x, mem <addr> [len]  hexdump memory (default 64 bytes), bank:addr for a ROM/RAM bank
+  poke <addr> <byte..> change memory, ROM/RAM bytes are patched (bank:addr for a bank)
+  d, disasm [addr] [n] disassemble n instructions (default around PC)
+  b, break <spec>      add a break point, kept until cleared:
+                         [bank:]addr            instruction address or label (e.g. 150, 01:4000, Main)
+                         <expr>                 condition (e.g. PC=150 && A==3)
+                         read|write|access <r>  watch point, [bank:]addr[-addr] or IO register
+                         io <register>          IO register writes (e.g. io LCDC)
+                         irq [name...]          interrupts (VBLANK, STAT, TIMER, SERIAL, JOYPAD)
+                         OPN=<name>             operation name (e.g. OPN=ret)
+                       followed by "if <expr>" and "ignore <n>" (hits ignored)
+  clear <n>            remove the break point n
+  bl, breaks           list the break points and their hits
+  w, watch <expr>      show the expression on every stop (e.g. [HL], A + 1, ZF)
+  unwatch <n>          remove the watch expression n
+  p, print <expr>      evaluate an expression
+  log                  toggle the instruction log (debug mode)
+  q, quit              stop the emulator
+  h, help              this help
+`
+
+// Debugger command-line debugger, stops before the instruction at PC on the step mode, break
+// points and on any line read while running (e.g. pressing Enter on the terminal), then reads
+// the commands until one resumes the execution
+type Debugger struct {
+	lines chan string // read in background, closed on EOF
+	out   io.Writer
+	last  string // repeated by an empty line
+
+	breakPoints []*breakPoint
+	watches     []watch
+	symbols     *Symbols // labels (see ParseSymbols), nil shows the plain addresses
+	pc          Word     // instruction being executed
+	jump        *Word    // PC changed while stopped, the instruction there is decoded on resume
+	watchHit    string   // watch point that stopped the execution, as reported to GDB (e.g. watch:c000;)
+
+	// GDB remote serial protocol (see ListenGDB)
+	gdbListener net.Listener
+	gdbClients  chan *gdbClient
+	gdb         *gdbClient // attached client, serves the stops instead of the prompt
+
+	// resume conditions
+	steps   int   // instructions left before stopping (step)
+	until   *Word // temporary break point (next, until)
+	stepOut bool  // stop once SP is above outSP (finish)
+	outSP   Word
+}
+
+type watch struct {
+	text string
+	e    expr
+}
+
+// NewDebugger reads the commands from in (nil disables the prompt, stops just resume) and writes
+// to out (os.Stdout if nil)
+func NewDebugger(in io.Reader, out io.Writer) *Debugger {
+	if out == nil {
+		out = os.Stdout
+	}
+	d := &Debugger{out: out}
+	if in != nil {
+		d.lines = make(chan string)
+		go func() {
+			defer close(d.lines)
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				d.lines <- scanner.Text()
+			}
+		}()
+	}
+	return d
+}
+
+// instructionAddress address of the instruction about to be executed (its opcode is fetched
+// and decoded, the CB prefix fetches a second byte)
+func (c *Cpu) instructionAddress() Word {
+	if c.cbprefixed {
+		return c.pc - 2
+	}
+	return c.pc - 1
+}
+
+// interrupted reports if a line was entered or a GDB client attached or interrupted while
+// running, checked once per frame
+func (d *Debugger) interrupted() bool {
+	if d.pollGDB() {
+		return true
+	}
+	select {
+	case _, ok := <-d.lines:
+		if !ok {
+			d.lines = nil
+		}
+		return ok
+	default:
+		return false
+	}
+}
+
+// addBreakPoint parses and adds a break point (see parseBreakPoint), returning its number
+func (d *Debugger) addBreakPoint(spec string) (int, error) {
+	b, err := parseBreakPoint(spec, d.symbols)
+	if err != nil {
+		return 0, err
+	}
+	d.breakPoints = append(d.breakPoints, b)
+	return len(d.breakPoints), nil
+}
+
+// watching reports if there are watch points, memory accesses are only checked then
+func (d *Debugger) watching() bool {
+	for _, b := range d.breakPoints {
+		if b.kind == breakRead || b.kind == breakWrite || b.kind == breakAccess {
+			return true
+		}
+	}
+	return false
+}
+
+// access checks the watch points on each memory access of the instruction, which completes
+// before stopping
+func (d *Debugger) access(c *Cpu, address Word, value uint8, write bool) {
+
+	// the conditions may read memory too
+	c.memory.watching = false
+	defer func() { c.memory.watching = true }()
+
+	for i, b := range d.breakPoints {
+		if !b.watches(c.memory, address, write) || !b.matches(c) {
+			continue
+		}
+		access := "read"
+		if write {
+			access = "write"
+		}
+		fmt.Fprintf(d.out, "Break point %d: %s [$%.4X] = $%.2X at PC=%s\n", i+1, access, address, value, d.location(c, d.pc))
+		d.watchHit = fmt.Sprintf("%s:%x;", map[breakKind]string{breakRead: "rwatch", breakWrite: "watch", breakAccess: "awatch"}[b.kind], address)
+		c.step = true
+	}
+}
+
+// interrupt checks the interrupt break points, stopping at the handler
+func (d *Debugger) interrupt(c *Cpu, serviced uint8) {
+	for i, b := range d.breakPoints {
+		if b.kind != breakInterrupt || b.interrupts&serviced == 0 || !b.matches(c) {
+			continue
+		}
+		for bit, name := range interruptNames {
+			if serviced&(1<<bit) > 0 {
+				fmt.Fprintf(d.out, "Break point %d: %s interrupt from PC=%s\n", i+1, name, d.location(c, c.previousPC))
+			}
+		}
+		c.step = true
+	}
+}
+
+// shouldBreak checks the break points and the resume conditions, before every instruction
+func (d *Debugger) shouldBreak(c *Cpu, operation string) bool {
+
+	pc := c.instructionAddress()
+	d.pc = pc
+
+	if d.steps > 0 {
+		if d.steps--; d.steps == 0 {
+			return true
+		}
+	}
+
+	if d.until != nil && *d.until == pc {
+		return true
+	}
+
+	if d.stepOut && c.sp > d.outSP {
+		return true
+	}
+
+	for i, b := range d.breakPoints {
+		switch {
+		case b.kind == breakAddress && b.start == pc && (b.bank < 0 || c.memory.bank(pc) == b.bank):
+		case b.kind == breakCondition:
+		case b.kind == breakOperation && strings.EqualFold(b.operation, operation):
+		default:
+			continue
+		}
+		if b.matches(c) {
+			fmt.Fprintf(d.out, "Break point %d at %s\n", i+1, d.location(c, pc))
+			return true
+		}
+	}
+
+	return false
+}
+
+// prompt stops before the instruction at PC, reading commands until one resumes the execution
+func (d *Debugger) prompt(c *Cpu) {
+
+	c.step = false
+	d.steps, d.until, d.stepOut = 0, nil, false
+
+	if d.gdb != nil {
+		d.serveGDB(c)
+		return
+	}
+	d.watchHit = ""
+
+	if d.lines == nil {
+		log.Printf("BREAK AT PC=0x%.4X (no debugger input, resuming)\n", c.instructionAddress())
+		return
+	}
+
+	d.where(c)
+
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+
+		line, ok := <-d.lines
+		if !ok {
+			// EOF, keeps running without the debugger
+			d.lines = nil
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = d.last
+		}
+		d.last = line
+
+		if d.command(c, line) {
+			return
+		}
+	}
+}
+
+// where shows the instruction about to be executed and the watch expressions
+func (d *Debugger) where(c *Cpu) {
+	pc := c.instructionAddress()
+	fmt.Fprintf(d.out, "%s: %s\n", d.location(c, pc), d.format(c, c.disassemble(pc)))
+	for i, w := range d.watches {
+		v := w.e(c)
+		fmt.Fprintf(d.out, "  %d: %s = $%.2X (%d)\n", i+1, w.text, v, v)
+	}
+}
+
+// command runs a debugger command, returning true if it resumes the execution
+func (d *Debugger) command(c *Cpu, line string) bool {
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	args := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	pc := c.instructionAddress()
+
+	switch strings.ToLower(fields[0]) {
+	case "s", "step":
+		d.steps = 1
+		if len(fields) > 1 {
+			n, err := parseNumber(fields[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(d.out, "invalid count %q\n", fields[1])
+				return false
+			}
+			d.steps = n
+		}
+		return true
+	case "n", "next":
+		opcode := c.memory.Read(pc)
+		if isCall(opcode) {
+			next := pc + Word(c.disassemble(pc).Size())
+			d.until = &next
+		} else {
+			d.steps = 1
+		}
+		return true
+	case "finish", "out":
+		d.stepOut = true
+		d.outSP = c.sp
+		return true
+	case "c", "continue":
+		return true
+	case "until", "runto":
+		address, ok := d.address(c, args)
+		if !ok {
+			return false
+		}
+		d.until = &address
+		return true
+	case "r", "regs":
+		d.registers(c)
+	case "x", "mem":
+		d.hexdump(c, fields[1:])
+	case "poke":
+		d.poke(c, fields[1:])
+	case "d", "disasm":
+		d.disasm(c, fields[1:])
+	case "b", "break":
+		n, err := d.addBreakPoint(args)
+		if err != nil {
+			fmt.Fprintf(d.out, "invalid break point : %s\n", err.Error())
+			return false
+		}
+		fmt.Fprintf(d.out, "Break point %d: %s\n", n, args)
+	case "clear":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(d.breakPoints) {
+			fmt.Fprintf(d.out, "no break point %q\n", args)
+			return false
+		}
+		d.breakPoints = append(d.breakPoints[:n-1], d.breakPoints[n:]...)
+	case "bl", "breaks":
+		for i, b := range d.breakPoints {
+			fmt.Fprintf(d.out, "%d: %s (%d hits)\n", i+1, b.spec, b.hits)
+		}
+	case "w", "watch":
+		e, err := compileExpr(args)
+		if err != nil {
+			fmt.Fprintf(d.out, "invalid expression : %s\n", err.Error())
+			return false
+		}
+		d.watches = append(d.watches, watch{text: args, e: e})
+	case "unwatch":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(d.watches) {
+			fmt.Fprintf(d.out, "no watch expression %q\n", args)
+			return false
+		}
+		d.watches = append(d.watches[:n-1], d.watches[n:]...)
+	case "p", "print":
+		e, err := compileExpr(args)
+		if err != nil {
+			fmt.Fprintf(d.out, "invalid expression : %s\n", err.Error())
+			return false
+		}
+		v := e(c)
+		fmt.Fprintf(d.out, "$%.2X (%d)\n", v, v)
+	case "log":
+		c.debug = !c.debug
+		fmt.Fprintf(d.out, "instruction log %t\n", c.debug)
+	case "q", "quit":
+		c.stopped = true
+		return true
+	case "h", "help":
+		fmt.Fprint(d.out, debuggerHelp)
+	default:
+		fmt.Fprintf(d.out, "unknown command %q, try help\n", fields[0])
+	}
+
+	return false
+}
+
+// jumpTo changes PC while stopped
+func (d *Debugger) jumpTo(c *Cpu, address Word) {
+	if address != c.instructionAddress() {
+		d.jump = &address
+	}
+}
+
+// close stops listening for GDB clients, detaching the current one
+func (d *Debugger) close() error {
+	if d.gdb != nil {
+		d.detachGDB()
+	}
+	if d.gdbListener != nil {
+		return d.gdbListener.Close()
+	}
+	return nil
+}
+
+// isCall CALL and RST opcodes (stepped over by next)
+func isCall(opcode uint8) bool {
+	switch opcode {
+	case 0xCD, 0xC4, 0xCC, 0xD4, 0xDC:
+		return true
+	}
+	return opcode&0xC7 == 0xC7
+}
+
+// label names the address, as mapped (see Symbols.Label)
+func (d *Debugger) label(c *Cpu, address Word) string {
+	if d.symbols == nil {
+		return ""
+	}
+	return d.symbols.Label(c.memory.bank(address), uint16(address))
+}
+
+// location address followed by its label, if any (e.g. $0150 (Main+$2))
+func (d *Debugger) location(c *Cpu, address Word) string {
+	if label := d.label(c, address); label != "" {
+		return fmt.Sprintf("$%.4X (%s)", address, label)
+	}
+	return fmt.Sprintf("$%.4X", address)
+}
+
+func (d *Debugger) address(c *Cpu, s string) (Word, bool) {
+	if _, address, ok := d.symbols.lookup(s); ok {
+		return address, true
+	}
+	e, err := compileExpr(s)
+	if err != nil {
+		fmt.Fprintf(d.out, "invalid address : %s\n", err.Error())
+		return 0, false
+	}
+	return Word(e(c)), true
+}
+
+func (d *Debugger) registers(c *Cpu) {
+	flags := []byte("----")
+	for i, f := range []flag{z_flag, n_flag, h_flag, c_flag} {
+		if c.reg.r_flags()&f > 0 {
+			flags[i] = "ZNHC"[i]
+		}
+	}
+	fmt.Fprintf(d.out, "A=$%.2X F=$%.2X (%s) B=$%.2X C=$%.2X D=$%.2X E=$%.2X H=$%.2X L=$%.2X\n",
+		c.reg.r8(reg_a), c.reg.r8(reg_f), flags, c.reg.r8(reg_b), c.reg.r8(reg_c), c.reg.r8(reg_d), c.reg.r8(reg_e), c.reg.r8(reg_h), c.reg.r8(reg_l))
+	fmt.Fprintf(d.out, "SP=$%.4X PC=$%.4X IME=%d IE=$%.2X IF=$%.2X\n",
+		c.sp, c.instructionAddress(), c.ime, c.memory.Read(INTERRUPT_ENABLE), c.memory.Read(INTERRUPT_FLAG))
+}
+
+// viewAddress an address (see address) or a bank:addr location (see memoryView)
+func (d *Debugger) viewAddress(c *Cpu, s string) (MemoryView, Word, bool) {
+	if !strings.Contains(s, ":") {
+		address, ok := d.address(c, s)
+		return MemoryView{Space: MEMORY_CPU}, address, ok
+	}
+	bank, address, err := parseLocation(s, d.symbols)
+	if err != nil {
+		fmt.Fprintf(d.out, "invalid address : %s\n", err.Error())
+		return MemoryView{}, 0, false
+	}
+	return memoryView(bank, address), address, true
+}
+
+func (d *Debugger) hexdump(c *Cpu, args []string) {
+
+	if len(args) == 0 {
+		fmt.Fprintln(d.out, "usage: x <addr> [len]")
+		return
+	}
+
+	view, address, ok := d.viewAddress(c, args[0])
+	if !ok {
+		return
+	}
+	prefix := ""
+	if view.Space != MEMORY_CPU {
+		prefix = fmt.Sprintf("%.2X:", view.Bank)
+	}
+
+	length := 64
+	if len(args) > 1 {
+		n, err := parseNumber(args[1])
+		if err != nil {
+			fmt.Fprintln(d.out, err.Error())
+			return
+		}
+		length = n
+	}
+
+	for row := 0; row < length; row += 16 {
+		var hex, ascii strings.Builder
+		for i := row; i < min(row+16, length); i++ {
+			v, ok := c.memory.peek(view, address+Word(i))
+			if !ok {
+				hex.WriteString("-- ")
+				ascii.WriteByte(' ')
+				continue
+			}
+			fmt.Fprintf(&hex, "%.2X ", v)
+			if v >= 0x20 && v < 0x7F {
+				ascii.WriteByte(v)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(d.out, "%s$%.4X: %-48s %s\n", prefix, address+Word(row), hex.String(), ascii.String())
+	}
+}
+
+func (d *Debugger) poke(c *Cpu, args []string) {
+
+	if len(args) < 2 {
+		fmt.Fprintln(d.out, "usage: poke <addr> <byte...>")
+		return
+	}
+
+	view, address, ok := d.viewAddress(c, args[0])
+	if !ok {
+		return
+	}
+
+	for i, arg := range args[1:] {
+		v, err := parseNumber(arg)
+		if err != nil || v < 0 || v > 0xFF {
+			fmt.Fprintf(d.out, "invalid byte %q\n", arg)
+			return
+		}
+		if !c.memory.poke(view, address+Word(i), uint8(v)) {
+			fmt.Fprintf(d.out, "$%.4X is outside the %s\n", address+Word(i), view)
+			return
+		}
+	}
+}
+
+func (d *Debugger) disasm(c *Cpu, args []string) {
+
+	pc := c.instructionAddress()
+	address, count := Word(disasm.Start(c.readMemory, uint16(pc))), 10
+
+	if len(args) > 0 {
+		a, ok := d.address(c, args[0])
+		if !ok {
+			return
+		}
+		address = a
+	}
+	if len(args) > 1 {
+		n, err := parseNumber(args[1])
+		if err != nil {
+			fmt.Fprintln(d.out, err.Error())
+			return
+		}
+		count = n
+	}
+
+	for range count {
+		i := c.disassemble(address)
+		marker := "  "
+		if address == pc {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %s: %s\n", marker, d.location(c, address), d.format(c, i))
+		address += Word(i.Size())
+	}
+}
+
+// readMemory reads the address bus, for the disassembler
+func (c *Cpu) readMemory(address uint16) uint8 {
+	return c.memory.Read(Word(address))
+}
+
+// disassemble decodes the instruction at address, as mapped
+func (c *Cpu) disassemble(address Word) disasm.Instruction {
+	return disasm.Decode(c.readMemory, uint16(address))
+}
+
+// format the instruction text, naming its target address (e.g. CALL Main)
+func (d *Debugger) format(c *Cpu, i disasm.Instruction) string {
+	return i.Format(func(address uint16) string { return d.label(c, Word(address)) })
+}
@@ -0,0 +1,235 @@
+package emulator
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// debuggerROM calls a routine and stores A into 0xC000
+func debuggerROM() []uint8 {
+	rom := make([]uint8, 0x8000)
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x12, // 0100 LD A, $12
+		0xCD, 0x10, 0x01, // 0102 CALL $0110
+		0x06, 0x34, // 0105 LD B, $34
+		0xEA, 0x00, 0xC0, // 0107 LD [$C000], A
+		0x18, 0xFE, // 010A JR -2
+	})
+	copy(rom[0x110:], []uint8{
+		0x3C,       // 0110 INC A
+		0xCB, 0x37, // 0111 SWAP A
+		0xC9, // 0113 RET
+	})
+	return rom
+}
+
+// interruptROM writes LCDC and waits for the VBlank interrupt
+func interruptROM() []uint8 {
+	rom := make([]uint8, 0x8000)
+	rom[0x40] = 0xD9 // RETI
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x01, // 0100 LD A, $01
+		0xE0, 0xFF, // 0102 LDH [IE], A
+		0x3E, 0x91, // 0104 LD A, $91
+		0xE0, 0x40, // 0106 LDH [LCDC], A
+		0xFB,       // 0108 EI
+		0x18, 0xFE, // 0109 JR -2
+	})
+	return rom
+}
+
+// runDebugger runs the ROM stopped on the first instruction, the commands are read from script
+func runDebugger(t *testing.T, script string) (*GameBoy, string) {
+	return runDebuggerROM(t, debuggerROM(), Config{Step: true}, script)
+}
+
+func runDebuggerROM(t *testing.T, rom []uint8, config Config, script string) (*GameBoy, string) {
+	var out bytes.Buffer
+	config.Silent, config.Debugger, config.DebuggerOutput = true, strings.NewReader(script), &out
+	g := NewGameBoy(config)
+	assert.NoError(t, g.LoadROM(rom))
+	assert.NoError(t, g.RunFrames(2))
+	return g, out.String()
+}
+
+func TestDebugger(t *testing.T) {
+
+	t.Run("expressions", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(debuggerROM()))
+		g.c.reg.w8(reg_a, 0x3)
+		g.c.reg.w16(reg_hl, 0xC000)
+		g.c.pc = 0x151
+		g.WriteMemory(0xC000, 0x42)
+
+		for s, expected := range map[string]int{
+			"PC=0x150 && A==0x3":   1,
+			"PC == 150 || A != 3":  1,
+			"[HL]":                 0x42,
+			"[HL + 1] + #10":       10,
+			"$10 - 1 & 0xF":        0xF,
+			"!(A > 2) || ZF":       0,
+			"-1 + a":               2,
+			"(HL & 0xFF00) = C000": 1,
+		} {
+			e, err := compileExpr(s)
+			assert.NoError(t, err, s)
+			assert.Equal(t, expected, e(g.c), s)
+		}
+
+		for _, s := range []string{"", "A ==", "(A", "[HL", "A B", "XYZ"} {
+			_, err := compileExpr(s)
+			assert.Error(t, err, s)
+		}
+	})
+
+	t.Run("step", func(t *testing.T) {
+		g, out := runDebugger(t, "d 100 3\ns\n\np A\nr\nq\n")
+		assert.Contains(t, out, "$0100: LD A, $12\n")
+		assert.Contains(t, out, "=> $0100: LD A, $12\n   $0102: CALL $0110\n   $0105: LD B, $34\n")
+
+		// an empty line repeats the step
+		assert.Contains(t, out, "$0102: CALL $0110\n")
+		assert.Contains(t, out, "$0110: INC A\n")
+		assert.Contains(t, out, "$12 (18)\n")
+		assert.Contains(t, out, "SP=$FFFC PC=$0110")
+		assert.True(t, g.c.stopped)
+	})
+
+	t.Run("step count", func(t *testing.T) {
+		// hexadecimal, as the addresses
+		_, out := runDebugger(t, "s 5\nr\nq\n")
+		assert.Contains(t, out, "SP=$FFFE PC=$0105")
+
+		_, out = runDebugger(t, "s A\nr\nq\n")
+		assert.Contains(t, out, "PC=$010A")
+	})
+
+	t.Run("next", func(t *testing.T) {
+		_, out := runDebugger(t, "s\nn\np A\nw B\ns\nq\n")
+		assert.Contains(t, out, "$0105: LD B, $34\n")
+		assert.Contains(t, out, "$31 (49)\n")
+		assert.Contains(t, out, "$0107: LD [$C000], A\n  1: B = $34 (52)\n")
+	})
+
+	t.Run("finish", func(t *testing.T) {
+		_, out := runDebugger(t, "until 111\nd\nout\nq\n")
+		assert.Contains(t, out, "$0111: SWAP A\n")
+		assert.Contains(t, out, "   $0110: INC A\n=> $0111: SWAP A\n   $0113: RET\n")
+		assert.Contains(t, out, "$0105: LD B, $34\n")
+	})
+
+	t.Run("break points", func(t *testing.T) {
+		g, out := runDebugger(t, "b 10A\nb 113\nbl\nclear 2\nc\nc\nbl\nx C000 2\nq\n")
+		assert.Contains(t, out, "1: 10A (0 hits)\n2: 113 (0 hits)\n")
+		assert.Contains(t, out, "Break point 1 at $010A\n")
+		assert.NotContains(t, out, "$0113: RET\n")
+
+		// kept after stopping
+		assert.Contains(t, out, "1: 10A (2 hits)\n")
+		assert.Contains(t, out, "$C000: 31 00")
+		assert.Equal(t, uint8(0x31), g.ReadMemory(0xC000))
+	})
+
+	t.Run("conditions", func(t *testing.T) {
+		_, out := runDebugger(t, "b PC=113 && A==31\nb 10A if B==34 ignore 2\nb 0:0107\nb 1:0107\nc\nc\nc\nbl\nq\n")
+		assert.Contains(t, out, "Break point 1 at $0113\n")
+		assert.Contains(t, out, "Break point 3 at $0107\n")
+		assert.Contains(t, out, "Break point 2 at $010A\n")
+		assert.Contains(t, out, "2: 10A if B==34 ignore 2 (3 hits)\n3: 0:0107 (1 hits)\n4: 1:0107 (0 hits)\n")
+	})
+
+	t.Run("command line", func(t *testing.T) {
+		// -b, no longer enables the interrupts
+		g, out := runDebuggerROM(t, debuggerROM(), Config{BreakPoints: "OPC=06; OPN=ret"}, "c\nbl\nc\n")
+		assert.Contains(t, out, "Break point 2 at $0113\n")
+		assert.Contains(t, out, "Break point 1 at $0105\n")
+		assert.Contains(t, out, "1: OPC=06 (1 hits)\n2: OPN=ret (1 hits)\n")
+		assert.Equal(t, uint8(0x00), g.ReadMemory(uint16(INTERRUPT_ENABLE)))
+	})
+
+	t.Run("watch points", func(t *testing.T) {
+		_, out := runDebugger(t, "b read FFFC-FFFD\nb write 1:C000\nb access 0:C000\nc\nc\nq\n")
+		assert.Contains(t, out, "Break point 1: read [$FFFC] = $05 at PC=$0113\nBreak point 1: read [$FFFD] = $01 at PC=$0113\n$0105: LD B, $34\n")
+		assert.Contains(t, out, "Break point 3: write [$C000] = $31 at PC=$0107\n$010A: JR $010A\n")
+		assert.NotContains(t, out, "Break point 2: write [")
+	})
+
+	t.Run("interrupts", func(t *testing.T) {
+		_, out := runDebuggerROM(t, interruptROM(), Config{Step: true}, "b io LCDC\nb irq vblank\nc\nc\nq\n")
+		assert.Contains(t, out, "Break point 1: write [$FF40] = $91 at PC=$0106\n$0108: EI\n")
+		assert.Contains(t, out, "Break point 2: VBLANK interrupt from PC=$0109\n$0040: RETI\n")
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		for _, spec := range []string{"read", "write C000-B000", "irq foo", "io C000", "150 ignore x", "PC==", "100 if"} {
+			_, err := parseBreakPoint(spec, nil)
+			assert.Error(t, err, spec)
+		}
+
+		b, err := parseBreakPoint("access 02:A000-BFFF if A > 1 ignore 1A", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, breakAccess, b.kind)
+		assert.Equal(t, 2, b.bank)
+		assert.Equal(t, Word(0xA000), b.start)
+		assert.Equal(t, Word(0xBFFF), b.end)
+		assert.Equal(t, 0x1A, b.ignore)
+		assert.NotNil(t, b.cond)
+
+		b, err = parseBreakPoint("irq timer joypad", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0x14), b.interrupts)
+	})
+
+	t.Run("symbols", func(t *testing.T) {
+		symbols, err := ParseSymbols(strings.NewReader("; debuggerROM\n00:0100 Start\n00:0107 Start.store\n00:0110 Routine\n"))
+		assert.NoError(t, err)
+
+		var out bytes.Buffer
+		g := NewGameBoy(Config{Silent: true, BreakPoints: "Routine", Debugger: strings.NewReader("d Routine 2\nuntil Start.store\nq\n"), DebuggerOutput: &out})
+		assert.NoError(t, g.LoadROM(debuggerROM()))
+		g.SetSymbols(symbols)
+		assert.NoError(t, g.RunFrames(2))
+
+		assert.Contains(t, out.String(), "Break point 1 at $0110 (Routine)\n$0110 (Routine): INC A\n")
+		assert.Contains(t, out.String(), "=> $0110 (Routine): INC A\n   $0111 (Routine+$1): SWAP A\n")
+		assert.Contains(t, out.String(), "$0107 (Start.store): LD [$C000], A\n")
+
+		// mooneye test ROMs (WLA-DX)
+		f, err := os.Open("../test-roms/mts-20240926-1737-443f6e1/acceptance/timer/tim00.sym")
+		assert.NoError(t, err)
+		defer f.Close()
+		symbols, err = ParseSymbols(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "main", symbols.Label(0, 0x150))
+		assert.Equal(t, "check_asserts_cb@check_asserts+$3", symbols.Label(1, 0x4845))
+		assert.Equal(t, "", symbols.Label(2, 0x4845))
+
+		bank, address, ok := symbols.lookup("check_asserts_cb")
+		assert.True(t, ok)
+		assert.Equal(t, 1, bank)
+		assert.Equal(t, Word(0x47F0), address)
+
+		_, err = ParseSymbols(strings.NewReader("01:XYZ Main\n"))
+		assert.Error(t, err)
+
+		// an invalid symbol file doesn't stop the game from loading
+		rom := writeTestROM(t, 0x18, 0xFE) // JR -2
+		assert.NoError(t, os.WriteFile(symbolFile(rom), []byte("01:XYZ Main\n"), 0644))
+		g = NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(rom))
+		assert.Nil(t, g.c.debugger.symbols)
+	})
+
+	t.Run("eof", func(t *testing.T) {
+		// keeps running without the debugger
+		g, out := runDebugger(t, "s\n")
+		assert.Contains(t, out, "$0102: CALL $0110\n")
+		assert.False(t, g.c.stopped)
+		assert.Equal(t, uint8(0x31), g.ReadMemory(0xC000))
+	})
+}
@@ -0,0 +1,239 @@
+package emulator
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// expr compiled debugger expression, evaluated against the current machine state
+type expr func(c *Cpu) int
+
+// exprRegisters registers and flags available to the debugger expressions
+var exprRegisters = map[string]expr{
+	"A":   func(c *Cpu) int { return int(c.reg.r8(reg_a)) },
+	"F":   func(c *Cpu) int { return int(c.reg.r8(reg_f)) },
+	"B":   func(c *Cpu) int { return int(c.reg.r8(reg_b)) },
+	"C":   func(c *Cpu) int { return int(c.reg.r8(reg_c)) },
+	"D":   func(c *Cpu) int { return int(c.reg.r8(reg_d)) },
+	"E":   func(c *Cpu) int { return int(c.reg.r8(reg_e)) },
+	"H":   func(c *Cpu) int { return int(c.reg.r8(reg_h)) },
+	"L":   func(c *Cpu) int { return int(c.reg.r8(reg_l)) },
+	"AF":  func(c *Cpu) int { return int(c.reg.r8(reg_a))<<8 | int(c.reg.r8(reg_f)) },
+	"BC":  func(c *Cpu) int { return int(c.reg.r16(reg_bc)) },
+	"DE":  func(c *Cpu) int { return int(c.reg.r16(reg_de)) },
+	"HL":  func(c *Cpu) int { return int(c.reg.r16(reg_hl)) },
+	"SP":  func(c *Cpu) int { return int(c.sp) },
+	"PC":  func(c *Cpu) int { return int(c.instructionAddress()) },
+	"IME": func(c *Cpu) int { return int(c.ime) },
+	"OPC": func(c *Cpu) int { return int(c.memory.Read(c.instructionAddress())) },
+	"ZF":  func(c *Cpu) int { return flagValue(c, z_flag) },
+	"NF":  func(c *Cpu) int { return flagValue(c, n_flag) },
+	"HF":  func(c *Cpu) int { return flagValue(c, h_flag) },
+	"CF":  func(c *Cpu) int { return flagValue(c, c_flag) },
+}
+
+func flagValue(c *Cpu, f flag) int {
+	if uint8(c.reg.r_flags())&uint8(f) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// exprOperators binary operators by precedence (lowest first), '=' is the same as '=='
+var exprOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<=", ">=", "<", ">", "="},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"+", "-"},
+}
+
+// compileExpr parses a debugger expression: registers (A, HL, SP, PC, ...), flags (ZF, NF, HF,
+// CF), IME, the opcode at PC (OPC), numbers (hexadecimal, optionally prefixed by 0x or $, decimal prefixed by #),
+// memory reads ([HL], [0xC000 + 1]) and the usual arithmetic, comparison and logic operators.
+// Registers win over hexadecimal numbers with the same name (use 0xBC for the number)
+func compileExpr(s string) (expr, error) {
+	p := &exprParser{tokens: tokenizeExpr(s)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	e, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func tokenizeExpr(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch ch := s[i]; {
+		case ch == ' ' || ch == '\t':
+			i++
+		case exprWord(ch):
+			j := i
+			for j < len(s) && exprWord(s[j]) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		case i+1 < len(s) && slices.Contains([]string{"||", "&&", "==", "!=", "<=", ">="}, s[i:i+2]):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		default:
+			tokens = append(tokens, string(ch))
+			i++
+		}
+	}
+	return tokens
+}
+
+// exprWord registers and numbers characters
+func exprWord(ch uint8) bool {
+	return ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$' || ch == '#'
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) binary(level int) (expr, error) {
+
+	if level == len(exprOperators) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for slices.Contains(exprOperators[level], p.peek()) {
+		op := p.tokens[p.pos]
+		p.pos++
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr(op, left, right)
+	}
+	return left, nil
+}
+
+func binaryExpr(op string, l, r expr) expr {
+	switch op {
+	case "||":
+		return func(c *Cpu) int { return boolValue(l(c) != 0 || r(c) != 0) }
+	case "&&":
+		return func(c *Cpu) int { return boolValue(l(c) != 0 && r(c) != 0) }
+	case "==", "=":
+		return func(c *Cpu) int { return boolValue(l(c) == r(c)) }
+	case "!=":
+		return func(c *Cpu) int { return boolValue(l(c) != r(c)) }
+	case "<=":
+		return func(c *Cpu) int { return boolValue(l(c) <= r(c)) }
+	case ">=":
+		return func(c *Cpu) int { return boolValue(l(c) >= r(c)) }
+	case "<":
+		return func(c *Cpu) int { return boolValue(l(c) < r(c)) }
+	case ">":
+		return func(c *Cpu) int { return boolValue(l(c) > r(c)) }
+	case "|":
+		return func(c *Cpu) int { return l(c) | r(c) }
+	case "^":
+		return func(c *Cpu) int { return l(c) ^ r(c) }
+	case "&":
+		return func(c *Cpu) int { return l(c) & r(c) }
+	case "+":
+		return func(c *Cpu) int { return l(c) + r(c) }
+	default:
+		return func(c *Cpu) int { return l(c) - r(c) }
+	}
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *exprParser) unary() (expr, error) {
+
+	token := p.peek()
+	p.pos++
+
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "!":
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *Cpu) int { return boolValue(e(c) == 0) }, nil
+	case "-":
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *Cpu) int { return -e(c) }, nil
+	case "(", "[":
+		e, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]"}[token]
+		if p.peek() != closing {
+			return nil, fmt.Errorf("missing %q", closing)
+		}
+		p.pos++
+		if token == "[" {
+			return func(c *Cpu) int { return int(c.memory.Read(Word(e(c)))) }, nil
+		}
+		return e, nil
+	}
+
+	if reg, ok := exprRegisters[strings.ToUpper(token)]; ok {
+		return reg, nil
+	}
+
+	n, err := parseNumber(token)
+	if err != nil {
+		return nil, err
+	}
+	return func(*Cpu) int { return n }, nil
+}
+
+// parseNumber hexadecimal (optionally prefixed by 0x or $) or decimal prefixed by #
+func parseNumber(s string) (int, error) {
+	base := 16
+	switch {
+	case strings.HasPrefix(s, "#"):
+		s, base = s[1:], 10
+	case strings.HasPrefix(s, "$"):
+		s = s[1:]
+	case strings.HasPrefix(strings.ToLower(s), "0x"):
+		s = s[2:]
+	}
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,112 @@
+package emulator
+
+// Button joypad buttons, the bit layout matches the (active-low) joypad state
+// https://gbdev.io/pandocs/Joypad_Input.html#ff00--p1joyp-joypad
+type Button uint8
+
+const (
+	BUTTON_RIGHT Button = 1 << iota
+	BUTTON_LEFT
+	BUTTON_UP
+	BUTTON_DOWN
+	BUTTON_A
+	BUTTON_B
+	BUTTON_SELECT
+	BUTTON_START
+)
+
+// Hotkey emulator actions triggered by the user (not forwarded to the game)
+type Hotkey int
+
+const (
+	HOTKEY_NONE Hotkey = iota
+	HOTKEY_PAUSE
+	HOTKEY_TOGGLE_DEBUG
+
+	// HOTKEY_SAVE_STATE + (slot - 1), slots 1-9
+	HOTKEY_SAVE_STATE
+
+	// HOTKEY_LOAD_STATE + (slot - 1), slots 1-9
+	HOTKEY_LOAD_STATE = HOTKEY_SAVE_STATE + STATE_SLOTS
+)
+
+const (
+	SCREEN_WIDTH  = 160
+	SCREEN_HEIGHT = 144
+)
+
+// VideoSink presents the frames rendered by the PPU
+type VideoSink interface {
+	// Init is called once, with the LCD size in pixels
+	Init(width, height int) error
+	// Draw is called once per frame, pixels are shades (0-3) after applying the DMG palettes
+	Draw(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]Pixel)
+	Close()
+}
+
+// ColorVideoSink a VideoSink also able to present CGB frames, sinks without color support
+// receive the CGB frames as shades
+type ColorVideoSink interface {
+	VideoSink
+	// DrawColor is called instead of Draw in CGB mode, once per frame
+	DrawColor(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]Color)
+}
+
+// SGBVideoSink a ColorVideoSink also able to present SGB frames (LCD and border), Init
+// receives the SGB screen size on the SGB models
+type SGBVideoSink interface {
+	ColorVideoSink
+	// DrawSGB is called instead of Draw on the SGB models, once per frame, the LCD is at
+	// SGB_LCD_X, SGB_LCD_Y
+	DrawSGB(frame *[SGB_SCREEN_HEIGHT][SGB_SCREEN_WIDTH]Color)
+}
+
+// AudioSink plays the samples mixed by the APU
+type AudioSink interface {
+	Init(sampleRate, bufferSize int) error
+	// Play receives the mixed samples (left and right interleaved), it may block until the device has room
+	Play(samples []float32)
+	Close()
+}
+
+// InputSource provides the joypad state and the emulator hotkeys
+type InputSource interface {
+	// Buttons currently pressed, polled once per frame
+	Buttons() Button
+	// Hotkey pressed since the last frame (HOTKEY_NONE if none), polled once per frame
+	Hotkey() Hotkey
+	// Closed reports if the user asked to quit (e.g. closed the window)
+	Closed() bool
+}
+
+// headlessVideo discards the frames, the last one is still available through GameBoy.Framebuffer
+type headlessVideo struct{}
+
+func (headlessVideo) Init(_, _ int) error                        { return nil }
+func (headlessVideo) Draw(_ *[SCREEN_HEIGHT][SCREEN_WIDTH]Pixel) {}
+func (headlessVideo) Close()                                     {}
+
+// captureAudio stores the mixed samples (see GameBoy.AudioSamples), keeping only the most recent ones
+type captureAudio struct {
+	samples []float32
+}
+
+// captured samples limit (~10s of interleaved stereo samples), older samples are dropped
+const maxCapturedSamples = sampleRate * 2 * 10
+
+func (a *captureAudio) Init(_, _ int) error { return nil }
+func (a *captureAudio) Close()              {}
+
+func (a *captureAudio) Play(samples []float32) {
+	a.samples = append(a.samples, samples...)
+	if len(a.samples) > maxCapturedSamples {
+		a.samples = a.samples[len(a.samples)-maxCapturedSamples:]
+	}
+}
+
+// headlessInput no buttons pressed, never closed
+type headlessInput struct{}
+
+func (headlessInput) Buttons() Button { return 0 }
+func (headlessInput) Hotkey() Hotkey  { return HOTKEY_NONE }
+func (headlessInput) Closed() bool    { return false }
@@ -0,0 +1,81 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testVideo struct {
+	width, height int
+	draws         int
+	closed        bool
+}
+
+func (v *testVideo) Init(width, height int) error {
+	v.width, v.height = width, height
+	return nil
+}
+
+func (v *testVideo) Draw(_ *[SCREEN_HEIGHT][SCREEN_WIDTH]Pixel) { v.draws++ }
+func (v *testVideo) Close()                                     { v.closed = true }
+
+type testInput struct {
+	buttons Button
+	hotkeys []Hotkey
+}
+
+func (i *testInput) Buttons() Button { return i.buttons }
+func (i *testInput) Closed() bool    { return len(i.hotkeys) == 0 }
+
+func (i *testInput) Hotkey() Hotkey {
+	if len(i.hotkeys) == 0 {
+		return HOTKEY_NONE
+	}
+	hotkey := i.hotkeys[0]
+	i.hotkeys = i.hotkeys[1:]
+	return hotkey
+}
+
+func TestFrontend(t *testing.T) {
+
+	t.Run("video sink", func(t *testing.T) {
+		video := &testVideo{}
+		g := NewGameBoy(Config{Silent: true, Video: video})
+		assert.NoError(t, g.Load(writeTestROM(t, 0x18, 0xFE))) // JR -2
+		assert.NoError(t, g.RunFrames(5))
+		assert.Equal(t, SCREEN_WIDTH, video.width)
+		assert.Equal(t, SCREEN_HEIGHT, video.height)
+		assert.Equal(t, 5, video.draws)
+		assert.NoError(t, g.Close())
+		assert.True(t, video.closed)
+	})
+
+	t.Run("joypad", func(t *testing.T) {
+		input := &testInput{buttons: BUTTON_START | BUTTON_LEFT}
+		g := NewGameBoy(Config{Silent: true, Input: input})
+		assert.NoError(t, g.Load(writeTestROM(t,
+			0x3E, 0x10, // LD A, 0x10 (select buttons)
+			0xE0, 0x00, // LDH [0xFF00], A
+			0xF0, 0x00, // LDH A, [0xFF00]
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0x3E, 0x20, // LD A, 0x20 (select d-pad)
+			0xE0, 0x00, // LDH [0xFF00], A
+			0xF0, 0x00, // LDH A, [0xFF00]
+			0xEA, 0x01, 0xC0, // LD [0xC001], A
+			0x18, 0xFE, // JR -2
+		)))
+		assert.NoError(t, g.RunFrames(1))
+		assert.Equal(t, uint8(0x07), g.c.memory.Read(0xC000)&0x0F)
+		assert.Equal(t, uint8(0x0D), g.c.memory.Read(0xC001)&0x0F)
+	})
+
+	t.Run("hotkeys", func(t *testing.T) {
+		input := &testInput{hotkeys: []Hotkey{HOTKEY_NONE, HOTKEY_SAVE_STATE + 1}}
+		g := NewGameBoy(Config{Silent: true, Input: input})
+		rom := writeTestROM(t, 0x18, 0xFE) // JR -2
+		assert.NoError(t, g.Load(rom))
+		assert.NoError(t, g.Loop(0))
+		assert.FileExists(t, stateFile(rom, 2))
+	})
+}
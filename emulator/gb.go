@@ -1,14 +1,23 @@
 package emulator
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
+)
+
+const (
+	// t-cycles per second
+	CLOCK_SPEED = 4194304
 
-	rl "github.com/gen2brain/raylib-go/raylib"
+	// t-cycles per frame, 4.194304 MHz / 60 FPS
+	CYCLES_PER_FRAME = CLOCK_SPEED / 60
 )
 
 type GameBoy struct {
@@ -18,38 +27,132 @@ type GameBoy struct {
 	timer  *Timer
 	video  *Video
 	sound  *Sound
+
+	config  Config
+	romFile string
+
+	// frontend (window, audio device and keyboard)
+	input       InputSource
+	initialized bool
+
+	// battery-backed cartridge RAM
+	savFile string
+	frames  int
 }
 
-func NewGameBoy(debug, step, silent, profiling bool, breakPoints string, palette, channels int) *GameBoy {
-	if step {
-		debug = true
+// Config emulator settings, the zero value is a headless emulator with all sound
+// channels enabled
+type Config struct {
+	Debug       bool   // log every instruction
+	Step        bool   // starts stopped in the debugger (see Debugger)
+	Silent      bool   // do not log the instructions while debugging
+	Profiling   bool   // log the emulation speed
+	BreakPoints string // break points, separated by ';' (see parseBreakPoint), parsed once the ROM symbols are loaded
+	Channels    int    // sound channels mask (bit 0 = CH1 ... bit 3 = CH4), 0 enables all
+	Model       Mode   // hardware model (power-up state), see Models, empty defaults to DMG
+
+	// DMG/MGB boot ROM (256 bytes), mapped over the cartridge until a write to FF50. The
+	// logo scroll and header checks run as on hardware, nil skips it (post-boot state)
+	BootROM []uint8
+
+	// frontends, nil runs headless: frames are discarded (see Framebuffer), audio
+	// is captured (see AudioSamples) and no buttons are pressed (see SetButtons)
+	Video VideoSink
+	Audio AudioSink
+	Input InputSource
+
+	// debugger commands (e.g. os.Stdin), read when stopped by the step mode, a break point or a
+	// line entered while running, nil just resumes. The output defaults to os.Stdout
+	Debugger       io.Reader
+	DebuggerOutput io.Writer
+
+	// CPU trace log, one line per instruction in the gameboy-doctor format (see traceInstruction),
+	// LY reads return $90 while tracing. Flushed by Close
+	Trace io.Writer
+
+	// code/data log, how each ROM byte was accessed (see CDL_OPCODE), merged into <rom>.cdl by
+	// Load and Close (see CoverageReport)
+	CodeDataLog bool
+
+	// guest code profile in the pprof format (see Profiler), the M-cycles spent on each address
+	// and routine. Written by Close
+	Profile io.Writer
+}
+
+func NewGameBoy(config Config) *GameBoy {
+	if config.Model == "" {
+		config.Model = DMG
+	}
+
+	if config.Channels == 0 {
+		config.Channels = 0xF
+	}
+
+	if config.Video == nil {
+		config.Video = headlessVideo{}
+	}
+
+	if config.Audio == nil {
+		config.Audio = &captureAudio{}
+	}
+
+	if config.Input == nil {
+		config.Input = headlessInput{}
 	}
 
 	mem := make(memoryArea, 65536)
-	sound := NewSound(mem, channels)
+	sound := NewSound(mem, config.Channels, config.Audio)
 
 	c := &Cpu{
-		step:        step,
-		silent:      silent,
-		breakPoints: strings.TrimSpace(breakPoints),
-		debug:       debug,
-		profiling:   profiling,
-		memory:      NewMemory(sound, mem),
+		step:      config.Step,
+		silent:    config.Silent,
+		mode:      config.Model,
+		debug:     config.Debug,
+		profiling: config.Profiling,
+		memory:    NewMemory(sound, mem),
+		debugger:  NewDebugger(config.Debugger, config.DebuggerOutput),
+	}
+
+	c.serial = NewSerialPort(c.memory)
+
+	if config.Trace != nil {
+		c.newTrace(config.Trace)
+	}
+
+	if config.Profile != nil {
+		c.profiler = NewProfiler()
+	}
+
+	c.memory.watch = func(address Word, value uint8, write bool) {
+		c.debugger.access(c, address, value, write)
+	}
+
+	if config.BootROM != nil {
+		c.memory.bootROM = bytes.Clone(config.BootROM)
+	}
+
+	if sgbModel(config.Model) {
+		c.memory.sgb = NewSgb(c.memory)
 	}
 
 	return &GameBoy{
 		c:      c,
 		timer:  NewTimer(c),
-		joypad: NewJoypad(c.memory),
+		joypad: NewJoypad(c.memory, config.Input),
 		sound:  sound,
+		config: config,
+		input:  config.Input,
 		video: &Video{
-			mem:     c.memory,
-			mode:    2,
-			palette: palette,
+			sink: config.Video,
+			mem:  c.memory,
+			sgb:  c.memory.sgb,
+			mode: 2,
 		},
 	}
 }
 
+// Load loads the ROM file, its battery-backed RAM (<rom>.sav), its symbols (<rom>.sym) and its
+// code/data log (<rom>.cdl), if any
 func (g *GameBoy) Load(romFile string) error {
 
 	f1, err := os.ReadFile(romFile)
@@ -57,22 +160,55 @@ func (g *GameBoy) Load(romFile string) error {
 		return err
 	}
 
+	if err := g.LoadROM(f1); err != nil {
+		return err
+	}
+
+	// debugger labels, optional, the game runs without them
+	symbols, err := loadSymbols(symbolFile(romFile))
+	if err != nil {
+		log.Printf("Ignoring the symbol file %s : %s\n", symbolFile(romFile), err.Error())
+	} else if symbols != nil {
+		g.c.debugger.symbols = symbols
+	}
+
+	// previous runs
+	if g.c.memory.cdl != nil {
+		if err := loadCDL(cdlFile(romFile), g.c.memory.cdl); err != nil {
+			return err
+		}
+	}
+
+	// restore battery-backed RAM
+	g.romFile = romFile
+	g.savFile = batteryFile(romFile)
+	return g.c.memory.mbc.loadBattery(g.savFile)
+}
+
+// LoadROM loads the ROM contents, without battery-backed RAM nor save states
+func (g *GameBoy) LoadROM(rom []uint8) error {
+
 	if len(g.c.memory.mem) == 0 {
 		g.c.memory.mem = make(memoryArea, 65536)
 	}
 
-	if len(g.c.memory.rom) == 0 {
-		g.c.memory.rom = make(memoryArea, len(f1))
+	if len(g.c.memory.rom) != len(rom) {
+		g.c.memory.rom = make(memoryArea, len(rom))
+	}
+
+	if g.config.CodeDataLog && len(g.c.memory.cdl) != len(rom) {
+		g.c.memory.cdl = make([]uint8, len(rom))
 	}
 
-	for address, value := range f1 {
+	for address, value := range rom {
 		if address < int(VRAM_START) {
 			g.c.memory.mem[address] = value
 		}
 		g.c.memory.rom[address] = value
 	}
 
-	return nil
+	// detect the cartridge MBC
+	return g.c.memory.init()
 }
 
 // Game Loop
@@ -173,60 +309,13 @@ func (g *GameBoy) Loop(interval time.Duration) error {
 	// }(g, fps, stop)
 
 	// block
-	for !rl.WindowShouldClose() && !g.c.stopped {
+	for !g.input.Closed() && !g.c.stopped {
 
 		// if len(fps) == 0 {
 		// 	fps <- 0x0
 		// }
 
-		var (
-			mCycles int
-			tCycles int
-		)
-
-		// 4.194304 MHz / 60 FPS
-		for range 69905 {
-
-			if tCycles%4 == 0 {
-
-				// broadcast machine cycle
-				g.broadcast(mCycles)
-
-				// 4Mihz (t-cycles) = 1 Mihz (m-cycles) == 1ms
-				if mCycles%1048 == 0 {
-					if g.c.memory.mbc.initialized() {
-						// RTC tick (if supported by cartridge)
-						g.c.memory.mbc.controller.Tick()
-					}
-				}
-
-				// overflow internal m-cycle counter, reset
-				if mCycles == math.MaxInt32 {
-					mCycles = 0
-				} else {
-					mCycles++
-				}
-
-				if rl.IsKeyPressed(rl.KeyP) {
-					g.c.step = true
-				}
-			}
-
-			// timer v2
-			g.timer.sync2(tCycles)
-
-			// every T-cycle
-			g.sound.sync(tCycles)
-
-			if tCycles == math.MaxInt32 {
-				tCycles = 0
-			} else {
-				tCycles++
-			}
-		}
-
-		// emulate raylib event loop
-		g.video.draw()
+		g.runFrame()
 	}
 
 	if !g.c.stopped {
@@ -241,34 +330,226 @@ func (g *GameBoy) Loop(interval time.Duration) error {
 		}
 	}
 
+	// force stop the emulator
+	return g.Close()
+}
+
+// Close persists the battery-backed RAM and releases the window, audio device and serial device
+func (g *GameBoy) Close() error {
+
+	if err := g.c.serial.plug(nil); err != nil {
+		return err
+	}
+
+	if err := g.c.debugger.close(); err != nil {
+		return err
+	}
+
+	if err := g.c.flushTrace(); err != nil {
+		return err
+	}
+
+	if g.c.profiler != nil {
+		if err := g.c.profiler.Write(g.config.Profile); err != nil {
+			return err
+		}
+	}
+
+	// persist the code/data log
+	if g.c.memory.cdl != nil && g.romFile != "" {
+		if err := os.WriteFile(cdlFile(g.romFile), g.c.memory.cdl, 0644); err != nil {
+			return err
+		}
+	}
+
+	// persist battery-backed RAM
+	if err := g.c.memory.mbc.saveBattery(g.savFile); err != nil {
+		return err
+	}
+
+	if !g.initialized {
+		return nil
+	}
+
 	// stop sound
 	g.sound.stop()
 
 	// close window
-	rl.CloseWindow()
+	g.video.close()
 
-	// force stop the emulator
+	g.initialized = false
 	return nil
 }
 
+// runFrame emulates a single frame, presents it and handles the frontend hotkeys
+func (g *GameBoy) runFrame() {
+
+	// emulate a single frame
+	g.frame()
+
+	// present the frame
+	g.video.draw()
+
+	// pause, save states, etc
+	g.hotkeys()
+
+	// periodically persist battery-backed RAM
+	g.frames++
+	g.c.memory.frame = g.frames
+	if g.frames%BATTERY_FLUSH_FRAMES == 0 {
+		if err := g.c.memory.mbc.saveBattery(g.savFile); err != nil {
+			log.Printf("Error saving battery RAM : %s\n", err.Error())
+		}
+	}
+}
+
+// frame runs the machine for a single frame, 4.194304 MHz / 60 FPS
+func (g *GameBoy) frame() {
+
+	var (
+		mCycles int
+		tCycles int
+	)
+
+	// poll the joypad
+	g.joypad.sync(0)
+
+	// lockstep with the other end of the link cable
+	g.c.serial.frame()
+
+	for range CYCLES_PER_FRAME {
+
+		if tCycles%4 == 0 {
+
+			// broadcast machine cycle
+			g.broadcast(mCycles)
+
+			// 4Mihz (t-cycles) = 1 Mihz (m-cycles) == 1ms
+			if mCycles%1048 == 0 {
+				if g.c.memory.mbc.initialized() {
+					// RTC tick (if supported by cartridge)
+					g.c.memory.mbc.controller.Tick()
+				}
+			}
+
+			// overflow internal m-cycle counter, reset
+			if mCycles == math.MaxInt32 {
+				mCycles = 0
+			} else {
+				mCycles++
+			}
+		} else if tCycles%2 == 0 && g.c.memory.doubleSpeed() {
+			// CGB double speed, the CPU runs twice per PPU m-cycle
+			g.c.sync(mCycles)
+		}
+
+		// timer v2 (DIV runs at the CPU speed)
+		g.timer.sync2(tCycles)
+		if g.c.memory.doubleSpeed() {
+			g.timer.sync2(tCycles)
+		}
+
+		// every T-cycle
+		g.sound.sync(tCycles)
+
+		if tCycles == math.MaxInt32 {
+			tCycles = 0
+		} else {
+			tCycles++
+		}
+	}
+}
+
 func (g *GameBoy) init() error {
 
-	if err := g.c.memory.init(); err != nil {
+	// init frontends
+	if err := g.video.init(); err != nil {
+		return err
+	}
+	if err := g.sound.init(); err != nil {
+		return err
+	}
+
+	if err := g.powerUp(); err != nil {
 		return err
 	}
 
-	// init handlers
-	g.video.init(640, 576)
+	// command-line break points, the labels are known by now
+	for _, spec := range strings.Split(g.config.BreakPoints, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		if _, err := g.c.debugger.addBreakPoint(spec); err != nil {
+			log.Printf("Invalid break point %q : %s\n", spec, err.Error())
+		}
+	}
+
+	g.initialized = true
+	return nil
+}
+
+// powerUp init handlers, power up sequence
+// https://gbdev.io/pandocs/Power_Up_Sequence.html
+func (g *GameBoy) powerUp() error {
+	if !slices.Contains(Models, g.c.mode) {
+		return fmt.Errorf("unknown hardware model %q", g.c.mode)
+	}
+	if g.c.memory.bootROM != nil && len(g.c.memory.bootROM) != BOOT_ROM_SIZE {
+		return fmt.Errorf("invalid boot ROM size %d (expected %d)", len(g.c.memory.bootROM), BOOT_ROM_SIZE)
+	}
 	if err := g.c.init(); err != nil {
 		return err
 	}
+
+	// CGB cartridges run in CGB mode on the CGB models
+	if cgbModel(g.c.mode) && g.c.memory.mem[CARTRIDGE_HEADER_CGB_FLAG]&0x80 > 0 {
+		g.c.memory.enableCGB()
+	}
+
+	// SGB cartridges enable the SGB functions on the SGB models
+	if g.c.memory.sgb != nil {
+		g.c.memory.sgb.init()
+	}
+
 	g.joypad.init()
 	g.timer.init()
-	return g.sound.init()
+
+	// PPU position when the boot ROM hands over to the cartridge
+	if g.c.memory.bootROM == nil {
+		for range powerUpPPU[g.c.mode] {
+			g.video.scan(g.c)
+		}
+	}
+	g.sound.enableChannels()
+	return nil
+}
+
+func (g *GameBoy) hotkeys() {
+
+	// a line entered on the debugger input pauses too
+	if g.c.debugger.interrupted() {
+		g.c.step = true
+	}
+
+	switch hotkey := g.input.Hotkey(); {
+	case hotkey == HOTKEY_PAUSE:
+		g.c.step = true
+	case hotkey == HOTKEY_TOGGLE_DEBUG:
+		g.c.debug = !g.c.debug
+	case hotkey >= HOTKEY_SAVE_STATE && hotkey < HOTKEY_LOAD_STATE:
+		slot := int(hotkey-HOTKEY_SAVE_STATE) + 1
+		if err := g.saveStateSlot(slot); err != nil {
+			log.Printf("Error on save state slot %d : %s\n", slot, err.Error())
+		}
+	case hotkey >= HOTKEY_LOAD_STATE && hotkey < HOTKEY_LOAD_STATE+STATE_SLOTS:
+		slot := int(hotkey-HOTKEY_LOAD_STATE) + 1
+		if err := g.loadStateSlot(slot); err != nil {
+			log.Printf("Error on save state slot %d : %s\n", slot, err.Error())
+		}
+	}
 }
 
 func (g *GameBoy) broadcast(cycle int) {
-	g.joypad.sync(cycle)
 	g.c.sync(cycle)
 	//g.timer.sync(cycle)
 	g.video.scan(g.c)
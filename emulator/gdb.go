@@ -0,0 +1,489 @@
+package emulator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// GDB registers, 16-bit little endian, in the order of the g/G packets
+const (
+	GDB_REG_AF = iota
+	GDB_REG_BC
+	GDB_REG_DE
+	GDB_REG_HL
+	GDB_REG_SP
+	GDB_REG_PC
+	GDB_REGISTERS
+)
+
+// GDB stop signals
+const (
+	GDB_SIGINT  = 2
+	GDB_SIGTRAP = 5
+)
+
+// gdbTargetXML register layout (qXfer:features:read)
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.z80.cpu">
+    <reg name="af" bitsize="16" type="int"/>
+    <reg name="bc" bitsize="16" type="int"/>
+    <reg name="de" bitsize="16" type="int"/>
+    <reg name="hl" bitsize="16" type="int"/>
+    <reg name="sp" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// gdbClient GDB remote serial protocol connection, the packets are read in background and
+// answered by the emulator goroutine while stopped (all-stop mode)
+// https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+type gdbClient struct {
+	conn    net.Conn
+	packets chan string // packet data ("\x03" for an interrupt), closed on disconnect
+	noAck   atomic.Bool
+	mu      sync.Mutex // writes
+
+	pending *string // packet read while running, answered once stopped
+	running bool    // resumed, a stop reply is due
+	sigint  bool    // stopped by an interrupt (Ctrl-C)
+}
+
+func newGDBClient(conn net.Conn) *gdbClient {
+	g := &gdbClient{conn: conn, packets: make(chan string, 16)}
+	go g.read()
+	return g
+}
+
+// read decodes the packets ($data#checksum), acknowledging them until the no ack mode
+func (g *gdbClient) read() {
+
+	defer close(g.packets)
+	r := bufio.NewReader(g.conn)
+
+	for {
+		ch, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch ch {
+		case 0x03:
+			g.packets <- "\x03"
+			continue
+		case '$':
+		default:
+			// acks
+			continue
+		}
+
+		data, err := r.ReadString('#')
+		if err != nil {
+			return
+		}
+		data = data[:len(data)-1]
+
+		checksum := make([]byte, 2)
+		if _, err := r.Read(checksum[:1]); err != nil {
+			return
+		}
+		if _, err := r.Read(checksum[1:]); err != nil {
+			return
+		}
+
+		if !g.noAck.Load() {
+			sum, err := strconv.ParseUint(string(checksum), 16, 8)
+			if err != nil || uint8(sum) != gdbChecksum(data) {
+				g.write("-")
+				continue
+			}
+			g.write("+")
+		}
+
+		if data == "QStartNoAckMode" {
+			g.noAck.Store(true)
+		}
+
+		g.packets <- data
+	}
+}
+
+func gdbChecksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func (g *gdbClient) write(s string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.conn.Write([]byte(s)); err != nil {
+		log.Printf("Error writing to the GDB client : %s\n", err.Error())
+	}
+}
+
+func (g *gdbClient) send(data string) {
+	g.write(fmt.Sprintf("$%s#%.2x", data, gdbChecksum(data)))
+}
+
+// next packet, false once disconnected
+func (g *gdbClient) next() (string, bool) {
+	if g.pending != nil {
+		packet := *g.pending
+		g.pending = nil
+		return packet, true
+	}
+	packet, ok := <-g.packets
+	return packet, ok
+}
+
+// ListenGDB serves the GDB remote serial protocol on the TCP address (e.g. localhost:2345),
+// returning the address listened. A client attaching stops the emulator, SM83 registers are
+// mapped as AF, BC, DE, HL, SP and PC
+func (g *GameBoy) ListenGDB(address string) (net.Addr, error) {
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	d := g.c.debugger
+	d.gdbListener = listener
+	d.gdbClients = make(chan *gdbClient, 1)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			log.Printf("GDB client attached from %s\n", conn.RemoteAddr())
+			d.gdbClients <- newGDBClient(conn)
+		}
+	}()
+
+	return listener.Addr(), nil
+}
+
+// pollGDB attaches new clients and checks the interrupts while running (once per frame),
+// returning true to stop
+func (d *Debugger) pollGDB() bool {
+
+	select {
+	case client := <-d.gdbClients:
+		if d.gdb != nil {
+			// a single client at a time
+			client.conn.Close()
+			return false
+		}
+		d.gdb = client
+		return true
+	default:
+	}
+
+	if d.gdb == nil {
+		return false
+	}
+
+	select {
+	case packet, ok := <-d.gdb.packets:
+		if !ok {
+			d.detachGDB()
+			return false
+		}
+		if packet == "\x03" {
+			d.gdb.sigint = true
+		} else {
+			d.gdb.pending = &packet
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// detachGDB removes the client break points, the emulator keeps running
+func (d *Debugger) detachGDB() {
+	d.gdb.conn.Close()
+	d.gdb = nil
+	d.breakPoints = slices.DeleteFunc(d.breakPoints, func(b *breakPoint) bool { return b.gdb })
+}
+
+// serveGDB answers the client while stopped, until it resumes the execution
+func (d *Debugger) serveGDB(c *Cpu) {
+
+	client := d.gdb
+	if client.running {
+		client.running = false
+		client.send(d.stopReply())
+	}
+
+	for {
+		packet, ok := client.next()
+		if !ok {
+			d.detachGDB()
+			return
+		}
+		if packet == "\x03" {
+			// already stopped
+			continue
+		}
+		if d.gdbPacket(c, packet) {
+			return
+		}
+	}
+}
+
+// stopReply why the emulator stopped
+func (d *Debugger) stopReply() string {
+	defer func() { d.gdb.sigint, d.watchHit = false, "" }()
+	switch {
+	case d.gdb.sigint:
+		return fmt.Sprintf("S%.2x", GDB_SIGINT)
+	case d.watchHit != "":
+		return fmt.Sprintf("T%.2x%s", GDB_SIGTRAP, d.watchHit)
+	}
+	return fmt.Sprintf("S%.2x", GDB_SIGTRAP)
+}
+
+// gdbPacket answers a packet, returning true if it resumes the execution
+func (d *Debugger) gdbPacket(c *Cpu, packet string) bool {
+
+	client := d.gdb
+
+	switch {
+	case packet == "?":
+		client.send(fmt.Sprintf("S%.2x", GDB_SIGTRAP))
+	case packet == "g":
+		var sb strings.Builder
+		for r := range GDB_REGISTERS {
+			sb.WriteString(gdbWord(d.gdbRegister(c, r)))
+		}
+		client.send(sb.String())
+	case strings.HasPrefix(packet, "G"):
+		data, err := hex.DecodeString(packet[1:])
+		if err != nil || len(data) < GDB_REGISTERS*2 {
+			client.send("E01")
+			return false
+		}
+		for r := range GDB_REGISTERS {
+			d.setGDBRegister(c, r, Word(binary.LittleEndian.Uint16(data[r*2:])))
+		}
+		client.send("OK")
+	case strings.HasPrefix(packet, "p"):
+		r, err := strconv.ParseUint(packet[1:], 16, 8)
+		if err != nil || r >= GDB_REGISTERS {
+			client.send("E01")
+			return false
+		}
+		client.send(gdbWord(d.gdbRegister(c, int(r))))
+	case strings.HasPrefix(packet, "P"):
+		reg, value, _ := strings.Cut(packet[1:], "=")
+		r, err := strconv.ParseUint(reg, 16, 8)
+		data, herr := hex.DecodeString(value)
+		if err != nil || herr != nil || r >= GDB_REGISTERS || len(data) < 2 {
+			client.send("E01")
+			return false
+		}
+		d.setGDBRegister(c, int(r), Word(binary.LittleEndian.Uint16(data)))
+		client.send("OK")
+	case strings.HasPrefix(packet, "m"):
+		address, length, err := gdbRange(packet[1:])
+		if err != nil {
+			client.send("E01")
+			return false
+		}
+		data := make([]uint8, length)
+		for i := range data {
+			data[i] = c.memory.Read(address + Word(i))
+		}
+		client.send(hex.EncodeToString(data))
+	case strings.HasPrefix(packet, "M"):
+		area, value, _ := strings.Cut(packet[1:], ":")
+		address, length, err := gdbRange(area)
+		data, herr := hex.DecodeString(value)
+		if err != nil || herr != nil || len(data) != length {
+			client.send("E01")
+			return false
+		}
+		for i, v := range data {
+			c.memory.Write(address+Word(i), v)
+		}
+		client.send("OK")
+	case strings.HasPrefix(packet, "c"), strings.HasPrefix(packet, "vCont;c"):
+		// c[addr]
+		if address, err := strconv.ParseUint(packet[1:], 16, 16); err == nil {
+			d.jumpTo(c, Word(address))
+		}
+		client.running = true
+		return true
+	case strings.HasPrefix(packet, "s"), strings.HasPrefix(packet, "vCont;s"):
+		// s[addr]
+		if address, err := strconv.ParseUint(packet[1:], 16, 16); err == nil {
+			d.jumpTo(c, Word(address))
+		}
+		d.steps = 1
+		client.running = true
+		return true
+	case strings.HasPrefix(packet, "Z") || strings.HasPrefix(packet, "z"):
+		client.send(d.gdbBreakPoint(packet))
+	case packet == "D" || strings.HasPrefix(packet, "D;"):
+		client.send("OK")
+		d.detachGDB()
+		return true
+	case packet == "k":
+		d.detachGDB()
+		c.stopped = true
+		return true
+	case strings.HasPrefix(packet, "qSupported"):
+		client.send("PacketSize=4000;qXfer:features:read+;swbreak+;hwbreak+;QStartNoAckMode+;vContSupported+")
+	case packet == "QStartNoAckMode":
+		client.send("OK")
+	case packet == "vCont?":
+		client.send("vCont;c;s")
+	case packet == "qAttached":
+		client.send("1")
+	case packet == "qfThreadInfo":
+		client.send("m1")
+	case packet == "qsThreadInfo":
+		client.send("l")
+	case packet == "qC":
+		client.send("QC1")
+	case strings.HasPrefix(packet, "H"):
+		client.send("OK")
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		offset, length, err := gdbRange(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+		if err != nil {
+			client.send("E01")
+			return false
+		}
+		start := min(int(offset), len(gdbTargetXML))
+		end := min(start+length, len(gdbTargetXML))
+		if end == len(gdbTargetXML) {
+			client.send("l" + gdbTargetXML[start:end])
+		} else {
+			client.send("m" + gdbTargetXML[start:end])
+		}
+	default:
+		// unsupported
+		client.send("")
+	}
+
+	return false
+}
+
+// gdbBreakPoint adds (Z) or removes (z) a break point (0, 1) or watch point (2 write, 3 read,
+// 4 access), as type,addr,kind
+func (d *Debugger) gdbBreakPoint(packet string) string {
+
+	fields := strings.Split(packet[1:], ",")
+	if len(fields) < 3 {
+		return "E01"
+	}
+	address, aerr := strconv.ParseUint(fields[1], 16, 16)
+	length, lerr := strconv.ParseUint(fields[2], 16, 16)
+	if aerr != nil || lerr != nil {
+		return "E01"
+	}
+	end := address + max(length, 1) - 1
+
+	var spec string
+	switch fields[0] {
+	case "0", "1":
+		spec = fmt.Sprintf("$%X", address)
+	case "2":
+		spec = fmt.Sprintf("write $%X-$%X", address, end)
+	case "3":
+		spec = fmt.Sprintf("read $%X-$%X", address, end)
+	case "4":
+		spec = fmt.Sprintf("access $%X-$%X", address, end)
+	default:
+		return ""
+	}
+
+	if packet[0] == 'z' {
+		for i, b := range d.breakPoints {
+			if b.gdb && b.spec == spec {
+				d.breakPoints = append(d.breakPoints[:i], d.breakPoints[i+1:]...)
+				break
+			}
+		}
+		return "OK"
+	}
+
+	n, err := d.addBreakPoint(spec)
+	if err != nil {
+		return "E01"
+	}
+	d.breakPoints[n-1].gdb = true
+	return "OK"
+}
+
+// gdbRange addr,length
+func gdbRange(s string) (Word, int, error) {
+	a, l, _ := strings.Cut(s, ",")
+	address, err := strconv.ParseUint(a, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(l, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return Word(address), int(length), nil
+}
+
+func gdbWord(w Word) string {
+	return fmt.Sprintf("%.2x%.2x", w.Low(), w.High())
+}
+
+func (d *Debugger) gdbRegister(c *Cpu, r int) Word {
+	switch r {
+	case GDB_REG_AF:
+		return NewWord(c.reg.r8(reg_a), c.reg.r8(reg_f))
+	case GDB_REG_BC:
+		return c.reg.r16(reg_bc)
+	case GDB_REG_DE:
+		return c.reg.r16(reg_de)
+	case GDB_REG_HL:
+		return c.reg.r16(reg_hl)
+	case GDB_REG_SP:
+		return c.sp
+	default:
+		if d.jump != nil {
+			return *d.jump
+		}
+		return c.instructionAddress()
+	}
+}
+
+func (d *Debugger) setGDBRegister(c *Cpu, r int, value Word) {
+	switch r {
+	case GDB_REG_AF:
+		c.reg.w8(reg_a, value.High())
+		c.reg.w8(reg_f, value.Low()&0xF0)
+	case GDB_REG_BC:
+		c.reg.w16(reg_bc, value)
+	case GDB_REG_DE:
+		c.reg.w16(reg_de, value)
+	case GDB_REG_HL:
+		c.reg.w16(reg_hl, value)
+	case GDB_REG_SP:
+		c.sp = value
+	default:
+		d.jumpTo(c, value)
+	}
+}
@@ -0,0 +1,93 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gdbCommand sends a packet, returning the reply (acks are skipped)
+func gdbCommand(t *testing.T, conn net.Conn, r *bufio.Reader, packet string) string {
+	_, err := fmt.Fprintf(conn, "$%s#%.2x", packet, gdbChecksum(packet))
+	assert.NoError(t, err)
+	return gdbReply(t, r)
+}
+
+func gdbReply(t *testing.T, r *bufio.Reader) string {
+	if _, err := r.ReadString('$'); err != nil {
+		assert.NoError(t, err)
+		return ""
+	}
+	data, err := r.ReadString('#')
+	assert.NoError(t, err)
+	_, err = r.Discard(2)
+	assert.NoError(t, err)
+	return strings.TrimSuffix(data, "#")
+}
+
+func TestGDB(t *testing.T) {
+
+	g := NewGameBoy(Config{Silent: true, DebuggerOutput: io.Discard})
+	assert.NoError(t, g.LoadROM(debuggerROM()))
+	addr, err := g.ListenGDB("127.0.0.1:0")
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- g.RunFrames(0) }()
+
+	conn, err := net.Dial("tcp", addr.String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+	r := bufio.NewReader(conn)
+
+	assert.Contains(t, gdbCommand(t, conn, r, "qSupported:multiprocess+;swbreak+"), "qXfer:features:read+")
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "QStartNoAckMode"))
+	assert.Equal(t, "S05", gdbCommand(t, conn, r, "?"))
+	assert.Contains(t, gdbCommand(t, conn, r, "qXfer:features:read:target.xml:0,1000"), `<reg name="pc" bitsize="16" type="code_ptr"/>`)
+
+	// stopped in the loop, A = $31 and flags cleared by SWAP
+	assert.Equal(t, "0031"+"1334"+"d800"+"4d01"+"feff"+"0a01", gdbCommand(t, conn, r, "g"))
+	assert.Equal(t, "0a01", gdbCommand(t, conn, r, "p5"))
+
+	// memory
+	assert.Equal(t, "3100", gdbCommand(t, conn, r, "mc000,2"))
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "Mc001,1:aa"))
+	assert.Equal(t, "31aa", gdbCommand(t, conn, r, "mc000,2"))
+
+	// break point, hit again by the loop
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "Z0,10a,1"))
+	assert.Equal(t, "S05", gdbCommand(t, conn, r, "c"))
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "z0,10a,1"))
+
+	// restarts the program, stopped by the write
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "Z2,c000,1"))
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "P5=0001"))
+	assert.Equal(t, "0001", gdbCommand(t, conn, r, "p5"))
+	assert.Equal(t, "T05watch:c000;", gdbCommand(t, conn, r, "c"))
+	assert.Equal(t, "0a01", gdbCommand(t, conn, r, "p5"))
+	assert.Equal(t, "OK", gdbCommand(t, conn, r, "z2,c000,1"))
+
+	// single step
+	assert.Equal(t, "S05", gdbCommand(t, conn, r, "s"))
+	assert.Equal(t, "0a01", gdbCommand(t, conn, r, "p5"))
+
+	// interrupted while running
+	_, err = fmt.Fprint(conn, "$c#63")
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte{0x03})
+	assert.NoError(t, err)
+	assert.Equal(t, "S02", gdbReply(t, r))
+
+	// kill
+	_, err = fmt.Fprint(conn, "$k#6b")
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+	assert.NoError(t, g.Close())
+}
@@ -0,0 +1,192 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	GOLDEN_DIR = "testdata/golden"
+
+	// actual and diff images of the failed comparisons
+	GOLDEN_FAILURES_DIR = "testdata/failures"
+)
+
+// UPDATE_GOLDEN=1 go test -run TestGolden ./emulator rewrites the golden images
+var updateGolden = os.Getenv("UPDATE_GOLDEN") != ""
+
+// goldenROM a ROM rendered for a number of frames, then compared against <name>.png
+type goldenROM struct {
+	name   string
+	rom    func(t *testing.T) string // ROM file, empty skips the test
+	frames int
+}
+
+var goldenROMs = []goldenROM{
+	// https://github.com/mattcurrie/dmg-acid2, reference image copied as testdata/golden/dmg-acid2.png
+	{name: "dmg-acid2", rom: optionalROM("../test-roms/dmg-acid2.gb"), frames: 60},
+
+	// background tiles, checkerboard of a tile using the 4 shades
+	{name: "bg-checkerboard", rom: func(t *testing.T) string {
+		return writeTestROM(t,
+			0xF3,       // DI
+			0xAF,       // XOR A
+			0xE0, 0x40, // LDH [LCDC], A (LCD off)
+			0x21, 0x10, 0x80, // LD HL, 0x8010 (tile 1)
+			0x06, 0x08, // LD B, 8
+			0x3E, 0xF0, // LD A, 0xF0 (low bits)
+			0x22,       // LD [HL+], A
+			0x3E, 0xCC, // LD A, 0xCC (high bits)
+			0x22,       // LD [HL+], A
+			0x05,       // DEC B
+			0x20, 0xF7, // JR NZ, -9
+			0x21, 0x00, 0x98, // LD HL, 0x9800 (tile map)
+			0x7D,       // LD A, L
+			0xCB, 0x37, // SWAP A
+			0x0F,       // RRCA (row bit 0)
+			0xAD,       // XOR L (column bit 0)
+			0xE6, 0x01, // AND 1
+			0x22,       // LD [HL+], A
+			0x7C,       // LD A, H
+			0xFE, 0x9C, // CP 0x9C
+			0x20, 0xF3, // JR NZ, -13
+			0x3E, 0xE4, // LD A, 0xE4
+			0xE0, 0x47, // LDH [BGP], A
+			0x3E, 0x91, // LD A, 0x91 (LCD on, tiles at 0x8000, BG on)
+			0xE0, 0x40, // LDH [LCDC], A
+			0x18, 0xFE, // JR -2
+		)
+	}, frames: 5},
+}
+
+func optionalROM(file string) func(t *testing.T) string {
+	return func(t *testing.T) string {
+		if _, err := os.Stat(file); err != nil {
+			return ""
+		}
+		return file
+	}
+}
+
+// compareGolden compares the image with the golden image, writing the actual and diff images on failure
+func compareGolden(t *testing.T, name string, actual *image.Gray) {
+
+	golden := filepath.Join(GOLDEN_DIR, name+".png")
+
+	if updateGolden {
+		assert.NoError(t, writePNG(golden, actual))
+		return
+	}
+
+	f, err := os.Open(golden)
+	if os.IsNotExist(err) {
+		t.Skipf("golden image %s not found (run with UPDATE_GOLDEN=1 to create it)", golden)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	expected, err := png.Decode(f)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.Equal(t, actual.Bounds(), expected.Bounds()) {
+		return
+	}
+
+	// mismatches in red over the expected image (faded)
+	diff := image.NewRGBA(actual.Bounds())
+	mismatches := 0
+	for y := actual.Bounds().Min.Y; y < actual.Bounds().Max.Y; y++ {
+		for x := actual.Bounds().Min.X; x < actual.Bounds().Max.X; x++ {
+			e := color.GrayModel.Convert(expected.At(x, y)).(color.Gray)
+			if e.Y == actual.GrayAt(x, y).Y {
+				fade := 0xC0 + e.Y/4
+				diff.Set(x, y, color.RGBA{R: fade, G: fade, B: fade, A: 0xFF})
+				continue
+			}
+			diff.Set(x, y, color.RGBA{R: 0xFF, A: 0xFF})
+			mismatches++
+		}
+	}
+
+	if mismatches == 0 {
+		return
+	}
+
+	assert.NoError(t, os.MkdirAll(GOLDEN_FAILURES_DIR, 0755))
+	actualFile := filepath.Join(GOLDEN_FAILURES_DIR, name+"-actual.png")
+	diffFile := filepath.Join(GOLDEN_FAILURES_DIR, name+"-diff.png")
+	assert.NoError(t, writePNG(actualFile, actual))
+	assert.NoError(t, writePNG(diffFile, diff))
+
+	t.Errorf("%s: %d pixels differ from %s (see %s and %s)", name, mismatches, golden, actualFile, diffFile)
+}
+
+func writePNG(file string, img image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestGolden(t *testing.T) {
+	for _, tc := range goldenROMs {
+		t.Run(tc.name, func(t *testing.T) {
+
+			rom := tc.rom(t)
+			if rom == "" {
+				t.Skipf("%s ROM not found", tc.name)
+			}
+
+			g := NewGameBoy(Config{Silent: true})
+			if !assert.NoError(t, g.Load(rom)) {
+				return
+			}
+			if !assert.NoError(t, g.RunFrames(tc.frames)) {
+				return
+			}
+
+			compareGolden(t, tc.name, g.Screenshot())
+		})
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+
+	var frame [SCREEN_HEIGHT][SCREEN_WIDTH]Pixel
+	frame[0][0] = 3
+	frame[0][1] = 1
+	frame[0][2] = 100 // transparent
+
+	img := FrameImage(&frame)
+	assert.Equal(t, SHADES[3], img.GrayAt(0, 0))
+	assert.Equal(t, SHADES[1], img.GrayAt(1, 0))
+	assert.Equal(t, SHADES[0], img.GrayAt(2, 0))
+
+	file := filepath.Join(t.TempDir(), "frame.png")
+	g := NewGameBoy(Config{Silent: true})
+	g.video.videoMemory = frame
+	assert.NoError(t, g.SaveScreenshot(file))
+
+	f, err := os.Open(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(SHADES[3]), fmt.Sprint(color.GrayModel.Convert(decoded.At(0, 0))))
+}
@@ -6,10 +6,22 @@ import (
 )
 
 const (
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#0143--cgb-flag
+	CARTRIDGE_HEADER_CGB_FLAG = 0x0143
+
 	// https://gbdev.io/pandocs/The_Cartridge_Header.html#0147--cartridge-type
 	CARTRIDGE_HEADER_TYPE     = 0x0147
 	CARTRIDGE_HEADER_ROM_SIZE = 0x0148
 	CARTRIDGE_HEADER_RAM_SIZE = 0x0149
+
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#0146--sgb-flag
+	CARTRIDGE_HEADER_SGB_FLAG = 0x0146
+
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#014b--old-licensee-code
+	CARTRIDGE_HEADER_OLD_LICENSEE = 0x014B
+
+	// https://gbdev.io/pandocs/The_Cartridge_Header.html#014d--header-checksum
+	CARTRIDGE_HEADER_CHECKSUM = 0x014D
 )
 
 // https://gbdev.io/pandocs/The_Cartridge_Header.html#0147--cartridge-type
@@ -106,21 +118,50 @@ var (
 		0x05: 64,  // 64 Kib
 	}
 
-	mbcControllerMap = map[int]memoryController{
-		MBC1:                    &mbc1{romSelected: 0x1, name: "MBC1"},
-		MBC1_RAM:                &mbc1{ramSupport: true, romSelected: 0x1, name: "MBC1_RAM"},
-		MBC1_RAM_BATTERY:        &mbc1{ramSupport: true, batterySupport: true, romSelected: 0x1, name: "MBC1_RAM_BATTERY"},
-		MBC2:                    &mbc2{romSelected: 0x1, name: "MBC2"},
-		MBC2_BATTERY:            &mbc2{romSelected: 0x1, batterySupport: true, name: "MBC2_BATTERY"},
-		MBC3:                    &mbc3{romSelected: 0x1, name: "MBC3"},
-		MBC3_TIMER_BATTERY:      &mbc3{romSelected: 0x1, name: "MBC3_TIMER_BATTERY", batterySupport: true},
-		MBC3_TIMER_RAM_BATTERY:  &mbc3{romSelected: 0x1, name: "MBC3_TIMER_RAM_BATTERY", ramSupport: true, batterySupport: true},
-		MBC5:                    &mbc5{romSelected: 0x1, name: "MBC5"},
-		MBC5_RAM:                &mbc5{romSelected: 0x1, name: "MBC5", ramSupport: true},
-		MBC5_RAM_BATTERY:        &mbc5{romSelected: 0x1, name: "MBC5", ramSupport: true, batterySupport: true},
-		MBC5_RUMBLE:             &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true},
-		MBC5_RUMBLE_RAM:         &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true, ramSupport: true},
-		MBC5_RUMBLE_RAM_BATTERY: &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true, ramSupport: true, batterySupport: true},
+	// mbcControllerMap controller factories, each cartridge gets its own controller (banks, RAM, RTC)
+	mbcControllerMap = map[int]func() memoryController{
+		MBC1: func() memoryController {
+			return &mbc1{romSelected: 0x1, name: "MBC1"}
+		},
+		MBC1_RAM: func() memoryController {
+			return &mbc1{ramSupport: true, romSelected: 0x1, name: "MBC1_RAM"}
+		},
+		MBC1_RAM_BATTERY: func() memoryController {
+			return &mbc1{ramSupport: true, batterySupport: true, romSelected: 0x1, name: "MBC1_RAM_BATTERY"}
+		},
+		MBC2: func() memoryController {
+			return &mbc2{romSelected: 0x1, name: "MBC2"}
+		},
+		MBC2_BATTERY: func() memoryController {
+			return &mbc2{romSelected: 0x1, batterySupport: true, name: "MBC2_BATTERY"}
+		},
+		MBC3: func() memoryController {
+			return &mbc3{romSelected: 0x1, name: "MBC3"}
+		},
+		MBC3_TIMER_BATTERY: func() memoryController {
+			return &mbc3{romSelected: 0x1, name: "MBC3_TIMER_BATTERY", batterySupport: true, rtcSupport: true, rtcRegisters: map[uint8]uint8{}, rtcRegistersLatch: map[uint8]uint8{}}
+		},
+		MBC3_TIMER_RAM_BATTERY: func() memoryController {
+			return &mbc3{romSelected: 0x1, name: "MBC3_TIMER_RAM_BATTERY", ramSupport: true, batterySupport: true, rtcSupport: true, rtcRegisters: map[uint8]uint8{}, rtcRegistersLatch: map[uint8]uint8{}}
+		},
+		MBC5: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5"}
+		},
+		MBC5_RAM: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5", ramSupport: true}
+		},
+		MBC5_RAM_BATTERY: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5", ramSupport: true, batterySupport: true}
+		},
+		MBC5_RUMBLE: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true}
+		},
+		MBC5_RUMBLE_RAM: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true, ramSupport: true}
+		},
+		MBC5_RUMBLE_RAM_BATTERY: func() memoryController {
+			return &mbc5{romSelected: 0x1, name: "MBC5", rumbleSupport: true, ramSupport: true, batterySupport: true}
+		},
 	}
 )
 
@@ -129,11 +170,20 @@ type memoryController interface {
 	Read(area memoryArea, address Word) uint8
 	Name() string
 	Tick()
+	RAM() []uint8
+	Battery() bool
+	// Banks currently mapped at 0x4000-0x7FFF (ROM) and 0xA000-0xBFFF (RAM)
+	Banks(area memoryArea) (rom, ram int)
+	// ROMOffset ROM byte currently mapped at a 0x0000-0x7FFF address
+	ROMOffset(area memoryArea, address Word) int
+	saveState() mbcState
+	loadState(s mbcState)
 }
 
 type Mbc struct {
 	controller memoryController
 	mem        memoryArea
+	saved      []uint8 // external RAM contents at the last battery flush
 }
 
 func NewMbc() *Mbc {
@@ -150,11 +200,13 @@ func (m *Mbc) detectType(mem memoryArea) error {
 		return nil
 	}
 
-	controller, ok := mbcControllerMap[int(cartridgeType)]
+	newController, ok := mbcControllerMap[int(cartridgeType)]
 	if !ok {
 		return fmt.Errorf("not supported cartridge type %X", cartridgeType)
 	}
 
+	controller := newController()
+
 	log.Printf("Detected cartdrige type %s (size=%d)\n", controller.Name(), romSize(mem))
 
 	m.controller = controller
@@ -182,6 +234,14 @@ func romBank00(address Word) bool {
 	return address >= ROM_BANK_00_START && address <= ROM_BANK_00_END
 }
 
+// romOffset ROM offset of a 0x0000-0x7FFF address, bank 0 fixed and bank at 0x4000-0x7FFF
+func romOffset(bank int, address Word) int {
+	if romBank00(address) {
+		return int(address)
+	}
+	return bank*SELECT_RAM_AREA_START + int(address-ROM_BANK_NN_START)
+}
+
 func romBankNN(address Word) bool {
 	return address >= ROM_BANK_NN_START && address <= ROM_BANK_NN_END
 }
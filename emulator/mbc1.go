@@ -1,5 +1,7 @@
 package emulator
 
+import "bytes"
+
 type mbc1 struct {
 	ramSupport     bool
 	batterySupport bool
@@ -19,6 +21,64 @@ func (b *mbc1) Name() string {
 	return b.name
 }
 
+func (b *mbc1) RAM() []uint8 {
+	return b.ramArea[:]
+}
+
+func (b *mbc1) Battery() bool {
+	return b.batterySupport
+}
+
+func (b *mbc1) Banks(area memoryArea) (int, int) {
+
+	// same wrap around as Read
+	bankN := b.romSelected
+	rs := uint8(romSize(area))
+	if rs == 64 {
+		bankN |= (b.ramSelected & 0x1) << 5
+	} else {
+		bankN |= (b.ramSelected & 0x3) << 5
+	}
+	if rs > 0 {
+		bankN = (bankN - rs) % rs
+	}
+
+	if b.mode == 0x0 {
+		return int(bankN), 0
+	}
+	return int(bankN), int(b.ramSelected)
+}
+
+// ROMOffset same mapping as Read, mode 1 maps the upper bank bits at 0x0000-0x3FFF too
+func (b *mbc1) ROMOffset(area memoryArea, address Word) int {
+	rom, _ := b.Banks(area)
+	if !romBank00(address) || b.mode == 0x0 || romSize(area) <= 32 {
+		return romOffset(rom, address)
+	}
+	if romSize(area) == 64 {
+		return romOffset(int(b.ramSelected&0x1<<5), address+ROM_BANK_NN_START)
+	}
+	return romOffset(int(b.ramSelected&0x3<<5), address+ROM_BANK_NN_START)
+}
+
+func (b *mbc1) saveState() mbcState {
+	return mbcState{
+		RamEnabled:  b.ramEnabled,
+		RomSelected: uint16(b.romSelected),
+		RamSelected: b.ramSelected,
+		Mode:        b.mode,
+		RAM:         bytes.Clone(b.ramArea[:]),
+	}
+}
+
+func (b *mbc1) loadState(s mbcState) {
+	b.ramEnabled = s.RamEnabled
+	b.romSelected = uint8(s.RomSelected)
+	b.ramSelected = s.RamSelected
+	b.mode = s.Mode
+	copy(b.ramArea[:], s.RAM)
+}
+
 func (b *mbc1) Write(area memoryArea, address Word, value uint8) {
 
 	// https://github.com/Hacktix/GBEDG/blob/master/mbcs/mbc1/index.md#0000---1fff-enable-ram
@@ -1,5 +1,7 @@
 package emulator
 
+import "bytes"
+
 type mbc2 struct {
 	batterySupport bool
 	ramEnabled     bool
@@ -12,6 +14,36 @@ func (b *mbc2) Name() string {
 	return b.name
 }
 
+func (b *mbc2) RAM() []uint8 {
+	return b.ramArea[:]
+}
+
+func (b *mbc2) Battery() bool {
+	return b.batterySupport
+}
+
+func (b *mbc2) Banks(_ memoryArea) (int, int) {
+	return int(b.romSelected), 0
+}
+
+func (b *mbc2) ROMOffset(_ memoryArea, address Word) int {
+	return romOffset(int(b.romSelected), address)
+}
+
+func (b *mbc2) saveState() mbcState {
+	return mbcState{
+		RamEnabled:  b.ramEnabled,
+		RomSelected: uint16(b.romSelected),
+		RAM:         bytes.Clone(b.ramArea[:]),
+	}
+}
+
+func (b *mbc2) loadState(s mbcState) {
+	b.ramEnabled = s.RamEnabled
+	b.romSelected = uint8(s.RomSelected)
+	copy(b.ramArea[:], s.RAM)
+}
+
 func (b *mbc2) Tick() {
 
 }
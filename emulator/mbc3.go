@@ -1,5 +1,14 @@
 package emulator
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+)
+
 const (
 	RTC_S  = uint8(0x8)
 	RTC_M  = uint8(0x9)
@@ -27,7 +36,7 @@ type mbc3 struct {
 }
 
 func (b *mbc3) Tick() {
-	if b.halted {
+	if !b.rtcSupport || b.halted {
 		return
 	}
 
@@ -36,32 +45,90 @@ func (b *mbc3) Tick() {
 		return
 	}
 	b.remaining = 0
-	b.rtcRegisters[RTC_S] += 1
-	if b.rtcRegisters[RTC_S] == 60 {
-		b.rtcRegisters[RTC_S] = 0
-		b.rtcRegisters[RTC_M] += 1
-	}
-	if b.rtcRegisters[RTC_M] == 60 {
-		b.rtcRegisters[RTC_M] = 0
-		b.rtcRegisters[RTC_H] += 1
-	}
-	if b.rtcRegisters[RTC_H] == 24 {
-		b.rtcRegisters[RTC_H] = 0
-		// 9 bit day counter + 1
-		dc := uint16(b.rtcRegisters[RTC_DL]) | (uint16(b.rtcRegisters[RTC_DH]&0x1) << 8) + 1
-		if dc > 0x1FF {
-			b.rtcRegisters[RTC_DH] |= 0x80 // set carry flag
-		} else {
-			b.rtcRegisters[RTC_DL] = uint8(dc & 0xFF)
-			b.rtcRegisters[RTC_DH] |= uint8(dc & 0x100 >> 8) // bit 8 of day counter
-		}
+	b.addSeconds(1)
+}
+
+// addSeconds advances the RTC registers, carrying into minutes, hours and the 9 bit day counter
+// https://gbdev.io/pandocs/MBC3.html#the-clock-counter-registers
+func (b *mbc3) addSeconds(seconds int64) {
+	total := int64(b.rtcRegisters[RTC_S]) + seconds
+	b.rtcRegisters[RTC_S] = uint8(total % 60)
+
+	total = int64(b.rtcRegisters[RTC_M]) + total/60
+	b.rtcRegisters[RTC_M] = uint8(total % 60)
+
+	total = int64(b.rtcRegisters[RTC_H]) + total/60
+	b.rtcRegisters[RTC_H] = uint8(total % 24)
+
+	days := int64(b.rtcRegisters[RTC_DL]) | int64(b.rtcRegisters[RTC_DH]&0x1)<<8
+	days += total / 24
+	if days > 0x1FF {
+		b.rtcRegisters[RTC_DH] |= 0x80 // set carry flag
+		days &= 0x1FF
 	}
+	b.rtcRegisters[RTC_DL] = uint8(days & 0xFF)
+	b.rtcRegisters[RTC_DH] = (b.rtcRegisters[RTC_DH] & 0xFE) | uint8(days>>8) // bit 8 of day counter
 }
 
 func (b *mbc3) Name() string {
 	return b.name
 }
 
+func (b *mbc3) RAM() []uint8 {
+	return b.ramArea[:]
+}
+
+func (b *mbc3) Battery() bool {
+	return b.batterySupport
+}
+
+func (b *mbc3) Banks(_ memoryArea) (int, int) {
+	return int(b.romSelected), int(b.ramSelected)
+}
+
+func (b *mbc3) ROMOffset(_ memoryArea, address Word) int {
+	return romOffset(int(b.romSelected), address)
+}
+
+func (b *mbc3) saveState() mbcState {
+	return mbcState{
+		RamEnabled:        b.ramEnabled,
+		RomSelected:       uint16(b.romSelected),
+		RamSelected:       b.ramSelected,
+		Mode:              b.mode,
+		RAM:               bytes.Clone(b.ramArea[:]),
+		RtcSelected:       b.rtcSelected,
+		RtcRegisters:      maps.Clone(b.rtcRegisters),
+		RtcRegistersLatch: maps.Clone(b.rtcRegistersLatch),
+		Latch:             b.latch,
+		Remaining:         b.remaining,
+		Halted:            b.halted,
+	}
+}
+
+func (b *mbc3) loadState(s mbcState) {
+	b.ramEnabled = s.RamEnabled
+	b.romSelected = uint8(s.RomSelected)
+	b.ramSelected = s.RamSelected
+	b.mode = s.Mode
+	copy(b.ramArea[:], s.RAM)
+	b.rtcSelected = s.RtcSelected
+	b.latch = s.Latch
+	b.remaining = s.Remaining
+	b.halted = s.Halted
+	if b.rtcSupport {
+		b.rtcRegisters = maps.Clone(s.RtcRegisters)
+		b.rtcRegistersLatch = maps.Clone(s.RtcRegistersLatch)
+		// gob does not encode empty maps
+		if b.rtcRegisters == nil {
+			b.rtcRegisters = map[uint8]uint8{}
+		}
+		if b.rtcRegistersLatch == nil {
+			b.rtcRegistersLatch = map[uint8]uint8{}
+		}
+	}
+}
+
 func (b *mbc3) Write(area memoryArea, address Word, value uint8) {
 
 	// https://github.com/Hacktix/GBEDG/blob/master/mbcs/mbc3/index.md#0000---1fff-enable-ram--timer-registers
@@ -205,3 +272,59 @@ func (b *mbc3) Read(area memoryArea, address Word) uint8 {
 	// open bus value
 	return 0xFF
 }
+
+// RTC footer appended to the battery RAM in .sav files (same layout used by VBA and BGB): the
+// current S, M, H, DL and DH registers, followed by their latched values, each one stored as a
+// 32-bit little endian integer, and then the 64-bit UNIX timestamp of when the file was saved.
+// https://bgb.bircd.org/rtcsave.html
+const (
+	RTC_FOOTER_SIZE        = 48
+	RTC_FOOTER_LEGACY_SIZE = 44 // 32-bit timestamp
+	RTC_FOOTER_TIMESTAMP   = 40 // timestamp offset
+)
+
+var rtcFooterRegisters = []uint8{RTC_S, RTC_M, RTC_H, RTC_DL, RTC_DH}
+
+// saveRTC encodes the RTC footer
+func (b *mbc3) saveRTC(now time.Time) []byte {
+	footer := make([]byte, 0, RTC_FOOTER_SIZE)
+	for _, r := range rtcFooterRegisters {
+		footer = binary.LittleEndian.AppendUint32(footer, uint32(b.rtcRegisters[r]))
+	}
+	for _, r := range rtcFooterRegisters {
+		footer = binary.LittleEndian.AppendUint32(footer, uint32(b.rtcRegistersLatch[r]))
+	}
+	return binary.LittleEndian.AppendUint64(footer, uint64(now.Unix()))
+}
+
+// loadRTC decodes the RTC footer and catches up with the real time elapsed since it was saved
+func (b *mbc3) loadRTC(footer []byte, now time.Time) error {
+
+	if len(footer) != RTC_FOOTER_SIZE && len(footer) != RTC_FOOTER_LEGACY_SIZE {
+		return fmt.Errorf("invalid RTC footer size %d", len(footer))
+	}
+
+	for i, r := range rtcFooterRegisters {
+		b.rtcRegisters[r] = uint8(binary.LittleEndian.Uint32(footer[i*4:]))
+		b.rtcRegistersLatch[r] = uint8(binary.LittleEndian.Uint32(footer[(i+5)*4:]))
+	}
+
+	var timestamp int64
+	if len(footer) == RTC_FOOTER_SIZE {
+		timestamp = int64(binary.LittleEndian.Uint64(footer[RTC_FOOTER_TIMESTAMP:]))
+	} else {
+		timestamp = int64(binary.LittleEndian.Uint32(footer[RTC_FOOTER_TIMESTAMP:]))
+	}
+
+	// halt flag (bit 6 of DH)
+	b.halted = b.rtcRegisters[RTC_DH]&0x40 > 0
+
+	// wall-clock catch-up
+	elapsed := now.Unix() - timestamp
+	if !b.halted && elapsed > 0 {
+		log.Printf("RTC catching up %s\n", time.Duration(elapsed)*time.Second)
+		b.addSeconds(elapsed)
+	}
+
+	return nil
+}
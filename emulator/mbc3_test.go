@@ -0,0 +1,112 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRTC() *mbc3 {
+	return &mbc3{
+		romSelected:       0x1,
+		batterySupport:    true,
+		rtcSupport:        true,
+		rtcRegisters:      map[uint8]uint8{},
+		rtcRegistersLatch: map[uint8]uint8{},
+	}
+}
+
+func TestMbc3RTC(t *testing.T) {
+
+	t.Run("no rtc does not tick", func(t *testing.T) {
+		b := &mbc3{romSelected: 0x1}
+		for range 2000 {
+			b.Tick()
+		}
+		assert.Nil(t, b.rtcRegisters)
+	})
+
+	t.Run("tick one second", func(t *testing.T) {
+		b := newRTC()
+		for range 1000 {
+			b.Tick()
+		}
+		assert.Equal(t, uint8(1), b.rtcRegisters[RTC_S])
+	})
+
+	t.Run("halted does not tick", func(t *testing.T) {
+		b := newRTC()
+		b.halted = true
+		for range 1000 {
+			b.Tick()
+		}
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_S])
+	})
+
+	t.Run("carry into days", func(t *testing.T) {
+		b := newRTC()
+		b.rtcRegisters[RTC_S] = 59
+		b.rtcRegisters[RTC_M] = 59
+		b.rtcRegisters[RTC_H] = 23
+		b.rtcRegisters[RTC_DL] = 0xFF
+		b.addSeconds(1)
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_S])
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_M])
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_H])
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_DL])
+		assert.Equal(t, uint8(0x1), b.rtcRegisters[RTC_DH])
+	})
+
+	t.Run("day counter overflow", func(t *testing.T) {
+		b := newRTC()
+		b.rtcRegisters[RTC_DL] = 0xFF
+		b.rtcRegisters[RTC_DH] = 0x1
+		b.addSeconds(86400 + 3661)
+		assert.Equal(t, uint8(1), b.rtcRegisters[RTC_S])
+		assert.Equal(t, uint8(1), b.rtcRegisters[RTC_M])
+		assert.Equal(t, uint8(1), b.rtcRegisters[RTC_H])
+		assert.Equal(t, uint8(0), b.rtcRegisters[RTC_DL])
+		assert.Equal(t, uint8(0x80), b.rtcRegisters[RTC_DH])
+	})
+
+	t.Run("footer round trip with catch-up", func(t *testing.T) {
+		saved := time.Unix(1700000000, 0)
+
+		b := newRTC()
+		b.rtcRegisters[RTC_S] = 10
+		b.rtcRegisters[RTC_M] = 20
+		b.rtcRegisters[RTC_H] = 5
+		b.rtcRegistersLatch[RTC_H] = 4
+		footer := b.saveRTC(saved)
+		assert.Len(t, footer, RTC_FOOTER_SIZE)
+
+		r := newRTC()
+		assert.NoError(t, r.loadRTC(footer, saved.Add(2*time.Hour+5*time.Second)))
+		assert.Equal(t, uint8(15), r.rtcRegisters[RTC_S])
+		assert.Equal(t, uint8(20), r.rtcRegisters[RTC_M])
+		assert.Equal(t, uint8(7), r.rtcRegisters[RTC_H])
+		assert.Equal(t, uint8(4), r.rtcRegistersLatch[RTC_H])
+		assert.False(t, r.halted)
+	})
+
+	t.Run("halted clock does not catch up", func(t *testing.T) {
+		saved := time.Unix(1700000000, 0)
+
+		b := newRTC()
+		b.rtcRegisters[RTC_S] = 10
+		b.rtcRegisters[RTC_DH] = 0x40
+		footer := b.saveRTC(saved)
+
+		r := newRTC()
+		assert.NoError(t, r.loadRTC(footer, saved.Add(time.Hour)))
+		assert.Equal(t, uint8(10), r.rtcRegisters[RTC_S])
+		assert.True(t, r.halted)
+	})
+
+	t.Run("legacy footer", func(t *testing.T) {
+		r := newRTC()
+		assert.NoError(t, r.loadRTC(make([]byte, RTC_FOOTER_LEGACY_SIZE), time.Unix(0, 0)))
+		assert.Error(t, r.loadRTC(make([]byte, 10), time.Unix(0, 0)))
+	})
+}
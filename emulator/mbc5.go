@@ -1,5 +1,7 @@
 package emulator
 
+import "bytes"
+
 type mbc5 struct {
 	ramSupport     bool
 	rumbleSupport  bool
@@ -15,6 +17,38 @@ func (b *mbc5) Name() string {
 	return b.name
 }
 
+func (b *mbc5) RAM() []uint8 {
+	return b.ramArea[:]
+}
+
+func (b *mbc5) Battery() bool {
+	return b.batterySupport
+}
+
+func (b *mbc5) Banks(_ memoryArea) (int, int) {
+	return int(b.romSelected), int(b.ramSelected)
+}
+
+func (b *mbc5) ROMOffset(_ memoryArea, address Word) int {
+	return romOffset(int(b.romSelected), address)
+}
+
+func (b *mbc5) saveState() mbcState {
+	return mbcState{
+		RamEnabled:  b.ramEnabled,
+		RomSelected: b.romSelected,
+		RamSelected: b.ramSelected,
+		RAM:         bytes.Clone(b.ramArea[:]),
+	}
+}
+
+func (b *mbc5) loadState(s mbcState) {
+	b.ramEnabled = s.RamEnabled
+	b.romSelected = s.RomSelected
+	b.ramSelected = s.RamSelected
+	copy(b.ramArea[:], s.RAM)
+}
+
 func (b *mbc5) Tick() {
 
 }
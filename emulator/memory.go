@@ -9,6 +9,7 @@ const (
 
 	ROM_BANK_NN_START = Word(0x4000)
 	ROM_BANK_NN_END   = Word(0x7FFF)
+	ROM_BANK_SIZE     = 0x4000
 
 	VRAM_START = Word(0x8000)
 	VRAM_END   = Word(0x9FFF)
@@ -18,6 +19,12 @@ const (
 	PORT_SERIAL_TRANSFER_SB = 0xFF01
 	PORT_SERIAL_TRANSFER_SC = 0xFF02
 	PORT_OAM_DMA_CONTROL    = 0xFF46
+
+	// https://gbdev.io/pandocs/Power_Up_Sequence.html#monochrome-models-dmg0-dmg-mgb
+	PORT_BOOT_ROM_DISABLE = 0xFF50
+
+	// DMG/MGB boot ROM, mapped over 0x0000-0x00FF
+	BOOT_ROM_SIZE = 0x100
 )
 
 type memoryArea []uint8
@@ -30,6 +37,38 @@ type Memory struct {
 	dma        bool
 	resetTimer bool
 	sound      *Sound
+	bootROM    memoryArea // mapped over the cartridge until FF50 is written, nil once disabled
+
+	// CGB mode (see cgb.go)
+	cgb        bool
+	vram1      memoryArea // VRAM bank 1
+	wram       memoryArea // WRAM banks 1-7 (0xD000-0xDFFF)
+	bgPalette  [PALETTE_RAM_SIZE]uint8
+	objPalette [PALETTE_RAM_SIZE]uint8
+	hdma       hdma
+
+	// SGB models (see sgb.go)
+	sgb *Sgb
+
+	// debugger watch points (see Debugger.access), called on each access while watching (the
+	// CPU executing an instruction)
+	watch    func(address Word, value uint8, write bool)
+	watching bool
+
+	// LY reads return TRACE_LY, as expected by the trace logs (see Config.Trace)
+	stubLY bool
+
+	// code/data log (see cdl.go), one byte per ROM byte, nil disabled. The reads are logged
+	// as data while the CPU executes an instruction
+	cdl     []uint8
+	logging bool
+
+	// last instruction write to each address, as the frames completed before it plus 1 (see
+	// GameBoy.LastWrite), nil until tracked. The writes are tracked while the CPU executes an
+	// instruction
+	written  []int
+	tracking bool
+	frame    int
 }
 
 func NewMemory(sound *Sound, mem memoryArea) *Memory {
@@ -38,10 +77,35 @@ func NewMemory(sound *Sound, mem memoryArea) *Memory {
 		joypad: 0xFF,
 		sound:  sound,
 		mem:    mem,
+		vram1:  make(memoryArea, VRAM_BANK_SIZE),
+		wram:   make(memoryArea, (WRAM_BANKS-1)*WRAM_BANK_SIZE),
 	}
 }
 
 func (m *Memory) Read(address Word) uint8 {
+	value := m.read(address)
+	if m.watching {
+		m.watch(address, value, false)
+	}
+	if m.logging {
+		m.logROM(address, CDL_DATA)
+	}
+	return value
+}
+
+func (m *Memory) read(address Word) uint8 {
+
+	// boot ROM overlay
+	if m.bootROM != nil && address < BOOT_ROM_SIZE {
+		return m.bootROM[address]
+	}
+
+	// banked VRAM/WRAM and CGB registers
+	if m.cgb {
+		if value, ok := m.readCGB(address); ok {
+			return value
+		}
+	}
 
 	// intercept ROM and RAM memory reads
 	if m.mbc != nil && m.mbc.initialized() && ownedByMBC(address) {
@@ -50,10 +114,21 @@ func (m *Memory) Read(address Word) uint8 {
 
 	rVal := m.mem[address]
 
+	if m.stubLY && address == LY_REGISTER {
+		return TRACE_LY
+	}
+
 	// unreadable bits return 1
 	if address == PORT_JOYPAD {
 		rVal |= 0xCF
 		state := m.joypad
+		if m.sgb != nil {
+			// SGB multiplayer, the joypad ID is returned when no line is selected
+			if m.sgb.players > 1 && rVal&0x30 == 0x30 {
+				return (rVal & 0xF0) | (0xF - m.sgb.player)
+			}
+			state = m.sgb.joypadState(state)
+		}
 		if rVal&0x20 == 0 {
 			rVal = (rVal & 0xF0) | ((state & 0xF0) >> 4)
 		}
@@ -98,8 +173,8 @@ func (m *Memory) Read(address Word) uint8 {
 
 	// unmapped
 	if address == 0xFF03 || address == 0xFF08 || address == 0xFF09 || address == 0xFF0A || address == 0xFF0B || address == 0xFF0C ||
-		address == 0xFF0D || address == 0xFF0E || address == 0xFF15 || address == 0xFF1F || address == 0xFF27 || address == 0xFF28 ||
-		address == 0xFF29 || address == 0xFF4C || address == 0xFF4D || address == 0xFF4E || address == 0xFF69 || address == 0xFF74 {
+		address == 0xFF0D || address == 0xFF0E || address == 0xFF15 || address == 0xFF1F || (address >= 0xFF27 && address <= 0xFF2F) ||
+		address == 0xFF4C || address == 0xFF4D || address == 0xFF4E || address == 0xFF69 || address == 0xFF74 {
 		return 0xFF
 	}
 
@@ -113,6 +188,13 @@ func (m *Memory) Read(address Word) uint8 {
 
 func (m *Memory) Write(address Word, value uint8) {
 
+	if m.watching {
+		m.watch(address, value, true)
+	}
+	if m.tracking {
+		m.written[address] = m.frame + 1
+	}
+
 	if address == PORT_DIV {
 		// reset timer
 		m.mem[address] = 0x0
@@ -124,6 +206,11 @@ func (m *Memory) Write(address Word, value uint8) {
 		return
 	}
 
+	// banked VRAM/WRAM and CGB registers
+	if m.cgb && m.writeCGB(address, value) {
+		return
+	}
+
 	// APU off all registers are read-only
 	if m.mem[NR52]&0x80 > 0 {
 
@@ -187,6 +274,17 @@ func (m *Memory) Write(address Word, value uint8) {
 	if address == PORT_JOYPAD {
 		// write JP
 		m.mem[address] = (value & 0x30) | (m.mem[address] & 0xCF)
+		if m.sgb != nil {
+			m.sgb.writeJoypad(value)
+		}
+		return
+	}
+
+	if address == PORT_BOOT_ROM_DISABLE {
+		// unmap the boot ROM, it can't be mapped again until the next power cycle
+		if value&0x1 > 0 {
+			m.bootROM = nil
+		}
 		return
 	}
 
@@ -206,6 +304,26 @@ func (m *Memory) Write(address Word, value uint8) {
 	m.mem[address] = value
 }
 
+// bank currently mapped at the address (ROM, external RAM, VRAM and WRAM), 0 if not banked
+func (m *Memory) bank(address Word) int {
+	switch {
+	case romBankNN(address) || externalRAMArea(address):
+		rom, ram := 1, 0 // no MBC, 32 KiB
+		if m.mbc.initialized() {
+			rom, ram = m.mbc.controller.Banks(m.rom)
+		}
+		if externalRAMArea(address) {
+			return ram
+		}
+		return rom
+	case m.cgb && address >= VRAM_START && address <= VRAM_END:
+		return int(m.mem[PORT_VBK] & 0x1)
+	case m.cgb && address >= WRAM_BANK_NN_START && address < WRAM_BANK_NN_START+WRAM_BANK_SIZE:
+		return max(int(m.mem[PORT_SVBK]&0x7), 1)
+	}
+	return 0
+}
+
 func (m *Memory) init() error {
 	return m.mbc.detectType(m.mem)
 }
@@ -0,0 +1,180 @@
+package emulator
+
+import "fmt"
+
+// memory viewer address spaces (see MemoryView)
+const (
+	MEMORY_CPU = iota // 0x0000-0xFFFF as mapped for the CPU
+	MEMORY_ROM        // a ROM bank, bank 0 at 0x0000-0x3FFF and the others at 0x4000-0x7FFF
+	MEMORY_RAM        // an external RAM bank, at 0xA000-0xBFFF
+
+	EXTERNAL_RAM_BANK_SIZE = 0x2000
+)
+
+// MemoryView address space shown by a memory viewer, the CPU view or a single ROM or external
+// RAM bank regardless of the banks mapped by the MBC
+type MemoryView struct {
+	Space int // MEMORY_CPU, MEMORY_ROM or MEMORY_RAM
+	Bank  int // ROM or RAM bank
+}
+
+func (v MemoryView) String() string {
+	switch v.Space {
+	case MEMORY_ROM:
+		return fmt.Sprintf("ROM bank $%.2X", v.Bank)
+	case MEMORY_RAM:
+		return fmt.Sprintf("RAM bank $%.2X", v.Bank)
+	}
+	return "CPU"
+}
+
+// Range first and last address of the view
+func (v MemoryView) Range() (uint16, uint16) {
+	switch {
+	case v.Space == MEMORY_ROM && v.Bank == 0:
+		return uint16(ROM_BANK_00_START), uint16(ROM_BANK_00_END)
+	case v.Space == MEMORY_ROM:
+		return uint16(ROM_BANK_NN_START), uint16(ROM_BANK_NN_END)
+	case v.Space == MEMORY_RAM:
+		return RAM_BANK_START, RAM_BANK_END
+	}
+	return 0x0000, 0xFFFF
+}
+
+// memoryView the view of a [bank:]address, as the debugger and the break points take it: the
+// bank selects a ROM bank at 0x0000-0x7FFF, an external RAM bank at 0xA000-0xBFFF
+func memoryView(bank int, address Word) MemoryView {
+	switch {
+	case bank >= 0 && address <= ROM_BANK_NN_END:
+		return MemoryView{Space: MEMORY_ROM, Bank: bank}
+	case bank >= 0 && externalRAMArea(address):
+		return MemoryView{Space: MEMORY_RAM, Bank: bank}
+	}
+	return MemoryView{Space: MEMORY_CPU}
+}
+
+// banks number of ROM and external RAM banks of the cartridge
+func (m *Memory) banks() (rom, ram int) {
+	rom = max(len(m.rom)/ROM_BANK_SIZE, 1)
+	if !m.mbc.initialized() {
+		return rom, 0
+	}
+	ram = ramSize(m.rom)
+	if _, ok := m.mbc.controller.(*mbc2); ok {
+		ram = 1 // 512 half-bytes, built in
+	}
+	return rom, ram
+}
+
+// byteAt the ROM or external RAM byte behind an address of a bank view, nil if the address is
+// outside the view or past the cartridge banks
+func (m *Memory) byteAt(v MemoryView, address Word) *uint8 {
+
+	first, last := v.Range()
+	if address < Word(first) || address > Word(last) {
+		return nil
+	}
+
+	switch v.Space {
+	case MEMORY_ROM:
+		if offset := romOffset(v.Bank, address); offset < len(m.rom) {
+			return &m.rom[offset]
+		}
+	case MEMORY_RAM:
+		_, banks := m.banks()
+		offset := v.Bank*EXTERNAL_RAM_BANK_SIZE + int(address-RAM_BANK_START)
+		if v.Bank < banks && offset < len(m.mbc.controller.RAM()) {
+			return &m.mbc.controller.RAM()[offset]
+		}
+	}
+	return nil
+}
+
+// mappedByte the cartridge byte mapped at a CPU address (the current ROM and RAM banks), nil
+// outside the cartridge, without a MBC (the ROM is read from mem) or past the banks
+func (m *Memory) mappedByte(address Word) *uint8 {
+	switch {
+	case !m.mbc.initialized() || m.bootROM != nil && address < BOOT_ROM_SIZE:
+		return nil
+	case externalRAMArea(address):
+		return m.byteAt(MemoryView{Space: MEMORY_RAM, Bank: m.bank(address)}, address)
+	case address <= ROM_BANK_NN_END:
+		if offset := m.mbc.controller.ROMOffset(m.rom, address); offset < len(m.rom) {
+			return &m.rom[offset]
+		}
+	}
+	return nil
+}
+
+// peek reads an address of a view without side effects (watch points, code/data log), the CPU
+// view reads what the CPU would (e.g. $FF on disabled RAM). False outside the view or the banks
+func (m *Memory) peek(v MemoryView, address Word) (uint8, bool) {
+	if v.Space == MEMORY_CPU {
+		return m.read(address), true
+	}
+	if b := m.byteAt(v, address); b != nil {
+		return *b, true
+	}
+	return 0, false
+}
+
+// poke changes an address of a view. ROM and external RAM bytes are patched, on the CPU view
+// those currently mapped (without switching banks or enabling RAM), the other addresses are
+// written as the CPU would (e.g. IO registers). False outside the view or the banks
+func (m *Memory) poke(v MemoryView, address Word, value uint8) bool {
+
+	if v.Space != MEMORY_CPU {
+		b := m.byteAt(v, address)
+		if b == nil {
+			return false
+		}
+		*b = value
+		return true
+	}
+
+	switch b := m.mappedByte(address); {
+	case b != nil:
+		*b = value
+	case !m.mbc.initialized() && address <= ROM_BANK_NN_END && (m.bootROM == nil || address >= BOOT_ROM_SIZE):
+		// no MBC, the ROM is read from mem
+		m.mem[address], m.rom[address] = value, value
+	default:
+		m.Write(address, value)
+	}
+	return true
+}
+
+// MemoryBanks number of ROM and external RAM banks of the cartridge (see MemoryView)
+func (g *GameBoy) MemoryBanks() (rom, ram int) {
+	return g.c.memory.banks()
+}
+
+// MappedBanks ROM bank mapped at 0x4000-0x7FFF and external RAM bank mapped at 0xA000-0xBFFF
+func (g *GameBoy) MappedBanks() (rom, ram int) {
+	return g.c.memory.bank(ROM_BANK_NN_START), g.c.memory.bank(RAM_BANK_START)
+}
+
+// PeekMemory reads an address of a view, without triggering the watch points or the code/data
+// log, false if the address is outside the view (or the cartridge banks)
+func (g *GameBoy) PeekMemory(v MemoryView, address uint16) (uint8, bool) {
+	return g.c.memory.peek(v, Word(address))
+}
+
+// PokeMemory changes an address of a view, ROM and external RAM bytes are patched, the other
+// addresses are written as the CPU would (see WriteMemory)
+func (g *GameBoy) PokeMemory(v MemoryView, address uint16, value uint8) bool {
+	return g.c.memory.poke(v, Word(address), value)
+}
+
+// LastWrite frames since an instruction last wrote to the address (CPU view), 0 during the last
+// frame, -1 if none since the first call, which starts tracking the writes
+func (g *GameBoy) LastWrite(address uint16) int {
+	m := g.c.memory
+	if m.written == nil {
+		m.written = make([]int, 0x10000)
+	}
+	if m.written[address] == 0 {
+		return -1
+	}
+	return m.frame - m.written[address]
+}
@@ -0,0 +1,102 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryViewROM MBC1 with 4 ROM banks and 4 RAM banks, each ROM bank filled with its number
+func memoryViewROM() []uint8 {
+	rom := make([]uint8, 4*ROM_BANK_SIZE)
+	for bank := 1; bank < 4; bank++ {
+		for i := range ROM_BANK_SIZE {
+			rom[bank*ROM_BANK_SIZE+i] = uint8(bank)
+		}
+	}
+	rom[CARTRIDGE_HEADER_TYPE], rom[CARTRIDGE_HEADER_ROM_SIZE], rom[CARTRIDGE_HEADER_RAM_SIZE] = 0x02, 0x01, 0x03
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x12, // 0100 LD A, $12
+		0xEA, 0x00, 0xC0, // 0102 LD [$C000], A
+		0x18, 0xFB, // 0105 JR -5
+	})
+	return rom
+}
+
+func TestMemoryView(t *testing.T) {
+
+	cpu, rom2, ram1 := MemoryView{}, MemoryView{Space: MEMORY_ROM, Bank: 2}, MemoryView{Space: MEMORY_RAM, Bank: 1}
+	assert.Equal(t, "CPU", cpu.String())
+	assert.Equal(t, "ROM bank $02", rom2.String())
+
+	t.Run("banks", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(memoryViewROM()))
+
+		rom, ram := g.MemoryBanks()
+		assert.Equal(t, [2]int{4, 4}, [2]int{rom, ram})
+		rom, ram = g.MappedBanks()
+		assert.Equal(t, [2]int{1, 0}, [2]int{rom, ram})
+
+		// a bank regardless of the one mapped
+		v, ok := g.PeekMemory(rom2, 0x4005)
+		assert.True(t, ok)
+		assert.Equal(t, uint8(2), v)
+		v, _ = g.PeekMemory(cpu, 0x4005)
+		assert.Equal(t, uint8(1), v)
+
+		for _, outside := range []struct {
+			view    MemoryView
+			address uint16
+		}{{rom2, 0x0100}, {MemoryView{Space: MEMORY_ROM, Bank: 4}, 0x4000}, {ram1, 0xC000}, {MemoryView{Space: MEMORY_RAM, Bank: 4}, 0xA000}} {
+			_, ok := g.PeekMemory(outside.view, outside.address)
+			assert.False(t, ok, outside)
+			assert.False(t, g.PokeMemory(outside.view, outside.address, 0), outside)
+		}
+
+		// patched, seen by the CPU once mapped
+		assert.True(t, g.PokeMemory(rom2, 0x4005, 0x99))
+		g.WriteMemory(0x2000, 2)
+		assert.Equal(t, uint8(0x99), g.ReadMemory(0x4005))
+		assert.True(t, g.PokeMemory(cpu, 0x4006, 0x98))
+		v, _ = g.PeekMemory(rom2, 0x4006)
+		assert.Equal(t, uint8(0x98), v)
+
+		// RAM disabled reads $FF on the CPU view
+		assert.True(t, g.PokeMemory(ram1, 0xA000, 0x42))
+		v, _ = g.PeekMemory(cpu, 0xA000)
+		assert.Equal(t, uint8(0xFF), v)
+		g.WriteMemory(0x0000, 0x0A)
+		g.WriteMemory(0x6000, 0x01)
+		g.WriteMemory(0x4000, 0x01)
+		v, _ = g.PeekMemory(cpu, 0xA000)
+		assert.Equal(t, uint8(0x42), v)
+
+		assert.True(t, g.PokeMemory(cpu, 0xC000, 0x77))
+		assert.Equal(t, uint8(0x77), g.ReadMemory(0xC000))
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(memoryViewROM()))
+
+		assert.Equal(t, -1, g.LastWrite(0xC000))
+		assert.NoError(t, g.RunFrames(3))
+		assert.Equal(t, 0, g.LastWrite(0xC000))
+		assert.Equal(t, -1, g.LastWrite(0xC001))
+
+		// the code is patched, the writes stop
+		assert.True(t, g.PokeMemory(cpu, 0x0103, 0x01))
+		assert.NoError(t, g.RunFrames(2))
+		assert.Equal(t, 2, g.LastWrite(0xC000))
+		assert.Equal(t, 0, g.LastWrite(0xC001))
+	})
+
+	t.Run("debugger", func(t *testing.T) {
+		_, out := runDebuggerROM(t, memoryViewROM(), Config{Step: true}, "poke C000 AB CD\nx C000 3\npoke 02:4000 55\nx 02:3FFF 2\npoke 05:4000 1\npoke C000 1FF\nq\n")
+		assert.Contains(t, out, "$C000: AB CD 00")
+		assert.Contains(t, out, "02:$3FFF: -- 55")
+		assert.Contains(t, out, "$4000 is outside the ROM bank $05\n")
+		assert.Contains(t, out, "invalid byte \"1FF\"\n")
+	})
+}
@@ -0,0 +1,273 @@
+package emulator
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// https://github.com/Gekkio/mooneye-test-suite
+	MOONEYE_ZIP = "../test-roms/mts-20240926-1737-443f6e1.zip"
+
+	// DMG boot ROM (not distributed), when present the boot_* tests run after the real boot sequence
+	MOONEYE_BOOT_ROM = "../test-roms/dmg_boot.bin"
+
+	// tests usually finish in less than a second, give up after 10 emulated seconds
+	MOONEYE_TIMEOUT_CYCLES = CLOCK_SPEED * 10
+
+	// the known failures (see mooneyeKnownFailures) are skipped, so that only regressions fail,
+	// MOONEYE_ALL=1 runs them too
+	MOONEYE_ALL = "MOONEYE_ALL"
+)
+
+var (
+	// model suffix, e.g. boot_div-dmgABCmgb, di_timing-GS
+	// https://github.com/Gekkio/mooneye-test-suite#test-naming
+	mooneyeModels = regexp.MustCompile(`-((?:dmg0|dmgABC|mgb|sgb2|sgb|cgb0|cgbABCDE|cgb|agb|ags|G|S|C|A)+)$`)
+	mooneyeModel  = regexp.MustCompile(`dmg0|dmgABC|mgb|sgb2|sgb|cgb0|cgbABCDE|cgb|agb|ags|G|S|C|A`)
+
+	// fibonacci numbers in B, C, D, E, H and L
+	mooneyePassed = CpuRegisters{B: 3, C: 5, D: 8, E: 13, H: 21, L: 34}
+)
+
+// mooneyeTargets model suffixes of the models the suite runs on (the CGB/AGB tests are under misc/)
+// https://github.com/Gekkio/mooneye-test-suite#test-naming
+var mooneyeTargets = map[string]Mode{
+	"dmgABC": DMG,
+	"G":      DMG,
+	"dmg0":   DMG0,
+	"mgb":    MGB,
+	"sgb":    SGB,
+	"S":      SGB,
+	"sgb2":   SGB2,
+}
+
+// mooneyeTarget returns the model to run the test on, the DMG (revision ABC) is preferred, tests
+// without a model suffix run on every model
+func mooneyeTarget(name string) (Mode, bool) {
+	suffix := mooneyeModels.FindStringSubmatch(strings.TrimSuffix(path.Base(name), ".gb"))
+	if suffix == nil {
+		return DMG, true
+	}
+
+	var (
+		target Mode
+		ok     bool
+	)
+	for _, model := range mooneyeModel.FindAllString(suffix[1], -1) {
+		if mode, supported := mooneyeTargets[model]; supported && (!ok || mode == DMG) {
+			target, ok = mode, true
+		}
+	}
+	return target, ok
+}
+
+// runMooneye runs the test ROM (after the boot ROM, if any) until the LD B,B breakpoint, returns the test result
+func runMooneye(rom, bootROM []uint8, model Mode) string {
+
+	g := NewGameBoy(Config{Silent: true, BootROM: bootROM, Model: model})
+	if err := g.LoadROM(rom); err != nil {
+		return "error: " + err.Error()
+	}
+
+	var regs CpuRegisters
+	met, err := g.RunUntil(func(g *GameBoy) bool {
+		var ok bool
+		regs, ok = g.SoftBreakpoint()
+		return ok
+	}, MOONEYE_TIMEOUT_CYCLES/CYCLES_PER_FRAME)
+
+	switch {
+	case err != nil:
+		return "error: " + err.Error()
+	case !met:
+		return "timeout"
+	case regs.B == mooneyePassed.B && regs.C == mooneyePassed.C && regs.D == mooneyePassed.D &&
+		regs.E == mooneyePassed.E && regs.H == mooneyePassed.H && regs.L == mooneyePassed.L:
+		return "pass"
+	case regs.B == 0x42 && regs.C == 0x42 && regs.D == 0x42 && regs.E == 0x42 && regs.H == 0x42 && regs.L == 0x42:
+		return "fail"
+	default:
+		return fmt.Sprintf("fail (B=%d C=%d D=%d E=%d H=%d L=%d)", regs.B, regs.C, regs.D, regs.E, regs.H, regs.L)
+	}
+}
+
+func TestMooneyeModels(t *testing.T) {
+	for name, expected := range map[string]Mode{
+		"acceptance/timer/tim00.gb":                     DMG,
+		"acceptance/boot_div-dmgABCmgb.gb":              DMG,
+		"acceptance/di_timing-GS.gb":                    DMG,
+		"acceptance/ppu/intr_2_mode0_timing_sprites.gb": DMG,
+		"acceptance/boot_div-dmg0.gb":                   DMG0,
+		"acceptance/boot_regs-mgb.gb":                   MGB,
+		"acceptance/boot_hwio-S.gb":                     SGB,
+		"acceptance/boot_regs-sgb2.gb":                  SGB2,
+	} {
+		model, ok := mooneyeTarget(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, model, name)
+	}
+
+	_, ok := mooneyeTarget("misc/boot_div-cgbABCDE.gb")
+	assert.False(t, ok)
+	_, ok = mooneyeTarget("acceptance/boot_regs-A.gb")
+	assert.False(t, ok)
+}
+
+func TestMooneye(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("mooneye test suite skipped in short mode")
+	}
+
+	archive, err := zip.OpenReader(MOONEYE_ZIP)
+	if err != nil {
+		t.Skipf("mooneye test suite not found: %s", err.Error())
+	}
+	defer archive.Close()
+
+	bootROM, err := os.ReadFile(MOONEYE_BOOT_ROM)
+	if err != nil {
+		bootROM = nil
+	}
+
+	skipKnown := os.Getenv(MOONEYE_ALL) == ""
+
+	var (
+		mu      sync.Mutex
+		results = map[string]string{}
+	)
+
+	t.Run("roms", func(t *testing.T) {
+		for _, file := range archive.File {
+
+			// acceptance/** and emulator-only/** tests of the supported models
+			name := strings.SplitN(file.Name, "/", 2)[1]
+			model, supported := mooneyeTarget(name)
+			if path.Ext(name) != ".gb" || !supported ||
+				!(strings.HasPrefix(name, "acceptance/") || strings.HasPrefix(name, "emulator-only/")) {
+				continue
+			}
+
+			t.Run(strings.TrimSuffix(name, ".gb"), func(t *testing.T) {
+				t.Parallel()
+
+				r, err := file.Open()
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer r.Close()
+
+				rom, err := io.ReadAll(r)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				var boot []uint8
+				if model == DMG && strings.HasPrefix(path.Base(name), "boot_") {
+					boot = bootROM
+				}
+
+				result := runMooneye(rom, boot, model)
+
+				mu.Lock()
+				results[name] = result
+				mu.Unlock()
+
+				switch {
+				case result == "pass" && mooneyeKnownFailures[name]:
+					t.Errorf("%s passes now, remove it from mooneyeKnownFailures", name)
+				case result == "pass":
+				case skipKnown && mooneyeKnownFailures[name]:
+					t.Skipf("known failure: %s", result)
+				default:
+					t.Errorf("%s: %s", name, result)
+				}
+			})
+		}
+	})
+
+	// pass/fail table
+	names := make([]string, 0, len(results))
+	passed := 0
+	for name, result := range results {
+		names = append(names, name)
+		if result == "pass" {
+			passed++
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("mooneye %d/%d passed\n", passed, len(results)))
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("  %-60s %s\n", name, results[name]))
+	}
+	t.Log(sb.String())
+}
+
+// mooneyeKnownFailures tests currently failing, skipped unless MOONEYE_ALL is set (see TestMooneye),
+// they fail once they pass so that the list is pruned
+var mooneyeKnownFailures = map[string]bool{
+	"acceptance/add_sp_e_timing.gb":                  true,
+	"acceptance/call_cc_timing.gb":                   true,
+	"acceptance/call_cc_timing2.gb":                  true,
+	"acceptance/call_timing.gb":                      true,
+	"acceptance/call_timing2.gb":                     true,
+	"acceptance/di_timing-GS.gb":                     true,
+	"acceptance/halt_ime0_ei.gb":                     true,
+	"acceptance/halt_ime0_nointr_timing.gb":          true,
+	"acceptance/halt_ime1_timing2-GS.gb":             true,
+	"acceptance/interrupts/ie_push.gb":               true,
+	"acceptance/intr_timing.gb":                      true,
+	"acceptance/jp_cc_timing.gb":                     true,
+	"acceptance/jp_timing.gb":                        true,
+	"acceptance/ld_hl_sp_e_timing.gb":                true,
+	"acceptance/oam_dma/sources-GS.gb":               true,
+	"acceptance/oam_dma_restart.gb":                  true,
+	"acceptance/oam_dma_start.gb":                    true,
+	"acceptance/oam_dma_timing.gb":                   true,
+	"acceptance/pop_timing.gb":                       true,
+	"acceptance/ppu/hblank_ly_scx_timing-GS.gb":      true,
+	"acceptance/ppu/intr_1_2_timing-GS.gb":           true,
+	"acceptance/ppu/intr_2_0_timing.gb":              true,
+	"acceptance/ppu/intr_2_mode0_timing.gb":          true,
+	"acceptance/ppu/intr_2_mode0_timing_sprites.gb":  true,
+	"acceptance/ppu/intr_2_mode3_timing.gb":          true,
+	"acceptance/ppu/intr_2_oam_ok_timing.gb":         true,
+	"acceptance/ppu/lcdon_timing-GS.gb":              true,
+	"acceptance/ppu/lcdon_write_timing-GS.gb":        true,
+	"acceptance/ppu/stat_irq_blocking.gb":            true,
+	"acceptance/ppu/stat_lyc_onoff.gb":               true,
+	"acceptance/ppu/vblank_stat_intr-GS.gb":          true,
+	"acceptance/push_timing.gb":                      true,
+	"acceptance/rapid_di_ei.gb":                      true,
+	"acceptance/ret_cc_timing.gb":                    true,
+	"acceptance/ret_timing.gb":                       true,
+	"acceptance/reti_timing.gb":                      true,
+	"acceptance/rst_timing.gb":                       true,
+	"acceptance/serial/boot_sclk_align-dmgABCmgb.gb": true,
+	"acceptance/timer/rapid_toggle.gb":               true,
+	"acceptance/timer/tim00.gb":                      true,
+	"acceptance/timer/tim00_div_trigger.gb":          true,
+	"acceptance/timer/tim01.gb":                      true,
+	"acceptance/timer/tim01_div_trigger.gb":          true,
+	"acceptance/timer/tim10.gb":                      true,
+	"acceptance/timer/tim10_div_trigger.gb":          true,
+	"acceptance/timer/tim11.gb":                      true,
+	"acceptance/timer/tim11_div_trigger.gb":          true,
+	"acceptance/timer/tima_reload.gb":                true,
+	"acceptance/timer/tima_write_reloading.gb":       true,
+	"acceptance/timer/tma_write_reloading.gb":        true,
+	"emulator-only/mbc1/multicart_rom_8Mb.gb":        true,
+}
@@ -0,0 +1,306 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Game Boy Printer commands
+// https://gbdev.io/pandocs/Gameboy_Printer.html
+const (
+	PRINTER_INIT   = 0x01
+	PRINTER_PRINT  = 0x02
+	PRINTER_DATA   = 0x04
+	PRINTER_STATUS = 0x0F
+)
+
+// Game Boy Printer status bits
+const (
+	PRINTER_STATUS_CHECKSUM_ERROR = 0x01
+	PRINTER_STATUS_BUSY           = 0x02
+	PRINTER_STATUS_FULL           = 0x04
+	PRINTER_STATUS_UNPROCESSED    = 0x08
+)
+
+const (
+	PRINTER_MAGIC_1 = 0x88
+	PRINTER_MAGIC_2 = 0x33
+
+	// answered on the byte after the checksum
+	PRINTER_ID = 0x81
+
+	// 20x18 tiles, a DATA packet holds 2 tile rows (a 160x16 strip)
+	PRINTER_WIDTH       = 160
+	PRINTER_BUFFER_SIZE = 0x2400
+
+	// STATUS packets answered as busy after a PRINT, the time it takes to print
+	PRINTER_BUSY_STATUS = 4
+)
+
+// packet fields, in order
+const (
+	printerMagic1 = iota
+	printerMagic2
+	printerCommand
+	printerCompression
+	printerLengthLow
+	printerLengthHigh
+	printerData
+	printerChecksumLow
+	printerChecksumHigh
+	printerAlive
+	printerStatus
+)
+
+// Printer Game Boy Printer, plugged into the serial port (external clock), each printed image
+// is written as a PNG file into the output directory
+// https://gbdev.io/pandocs/Gameboy_Printer.html
+type Printer struct {
+	dir string
+
+	// packet being received
+	field       int
+	command     uint8
+	compression bool
+	length      int
+	data        []uint8
+	checksum    uint16
+	sum         uint16
+
+	status uint8
+	busy   int     // STATUS packets left until the print finishes
+	buffer []uint8 // tile data received (DATA) since the last INIT/PRINT
+	image  []uint8 // printed since the last feed, the margins are only applied once printed
+	pages  int     // images written
+}
+
+func NewPrinter(dir string) *Printer {
+	return &Printer{dir: dir}
+}
+
+// transfer receives a byte of the packet, answering 0x00 except for the last 2 bytes (ID and
+// status)
+func (p *Printer) transfer(_ *SerialPort, data uint8) uint8 {
+
+	switch p.field {
+	case printerMagic1:
+		if data == PRINTER_MAGIC_1 {
+			p.field++
+		}
+		return 0x00
+	case printerMagic2:
+		if data == PRINTER_MAGIC_2 {
+			p.field++
+			p.sum = 0
+		} else {
+			p.field = printerMagic1
+		}
+		return 0x00
+	case printerCommand:
+		p.command = data
+	case printerCompression:
+		p.compression = data&0x1 > 0
+	case printerLengthLow:
+		p.length = int(data)
+	case printerLengthHigh:
+		p.length |= int(data) << 8
+		p.data = p.data[:0]
+		if p.length == 0 {
+			p.sum += uint16(data)
+			p.field = printerChecksumLow
+			return 0x00
+		}
+	case printerData:
+		p.data = append(p.data, data)
+		p.sum += uint16(data)
+		if len(p.data) < p.length {
+			return 0x00
+		}
+		p.field++
+		return 0x00
+	case printerChecksumLow:
+		p.checksum = uint16(data)
+		p.field++
+		return 0x00
+	case printerChecksumHigh:
+		p.checksum |= uint16(data) << 8
+		p.field++
+		return 0x00
+	case printerAlive:
+		p.field++
+		return PRINTER_ID
+	case printerStatus:
+		p.field = printerMagic1
+		p.run()
+		return p.status
+	}
+
+	p.sum += uint16(data)
+	p.field++
+	return 0x00
+}
+
+// run handles the packet received
+func (p *Printer) run() {
+
+	if p.sum != p.checksum {
+		p.status |= PRINTER_STATUS_CHECKSUM_ERROR
+		return
+	}
+	p.status &^= PRINTER_STATUS_CHECKSUM_ERROR
+
+	switch p.command {
+	case PRINTER_INIT:
+		p.buffer = p.buffer[:0]
+		p.status = 0
+		p.busy = 0
+	case PRINTER_DATA:
+		if len(p.data) == 0 {
+			// end of data
+			p.status |= PRINTER_STATUS_FULL
+			return
+		}
+		data := p.data
+		if p.compression {
+			data = decompressRLE(p.data)
+		}
+		p.buffer = append(p.buffer, data[:min(len(data), PRINTER_BUFFER_SIZE-len(p.buffer))]...)
+		p.status |= PRINTER_STATUS_UNPROCESSED
+		if len(p.buffer) == PRINTER_BUFFER_SIZE {
+			p.status |= PRINTER_STATUS_FULL
+		}
+	case PRINTER_PRINT:
+		if len(p.data) < 4 {
+			return
+		}
+		if err := p.print(p.data[1], p.data[2]); err != nil {
+			log.Printf("Error printing : %s\n", err.Error())
+		}
+		p.buffer = p.buffer[:0]
+		p.status = PRINTER_STATUS_BUSY
+		p.busy = PRINTER_BUSY_STATUS
+	case PRINTER_STATUS:
+		if p.busy > 0 {
+			if p.busy--; p.busy == 0 {
+				p.status &^= PRINTER_STATUS_BUSY
+			}
+		}
+	default:
+		log.Printf("Unknown printer command 0x%.2X\n", p.command)
+	}
+}
+
+// decompressRLE DATA packets compression, a control byte with bit 7 set repeats the next byte
+// (control & 0x7F) + 2 times, otherwise (control + 1) bytes follow as is
+func decompressRLE(data []uint8) []uint8 {
+	var out []uint8
+	for i := 0; i < len(data); {
+		control := data[i]
+		i++
+		if control&0x80 > 0 {
+			if i < len(data) {
+				for range int(control&0x7F) + 2 {
+					out = append(out, data[i])
+				}
+			}
+			i++
+		} else {
+			n := min(int(control)+1, len(data)-i)
+			out = append(out, data[i:i+n]...)
+			i += n
+		}
+	}
+	return out
+}
+
+// print renders the buffer with the palette, the margin before (upper nibble) and after (lower
+// nibble) is blank paper, a tile row per unit. Images are written once the paper is fed (margin
+// after), so consecutive prints without margins end up in a single image
+func (p *Printer) print(margins, palette uint8) error {
+
+	// default palette
+	if palette == 0 {
+		palette = 0xE4
+	}
+
+	p.image = append(p.image, make([]uint8, int(margins>>4)*PRINTER_WIDTH*8)...)
+
+	// 2bpp tiles, 20 tiles per row
+	rows := len(p.buffer) / (PRINTER_WIDTH / 8 * 16)
+	for y := range rows * 8 {
+		for x := range PRINTER_WIDTH {
+			tile := p.buffer[((y/8)*(PRINTER_WIDTH/8)+x/8)*16:]
+			bit := 7 - x%8
+			index := (tile[(y%8)*2]>>bit)&0x1 | ((tile[(y%8)*2+1]>>bit)&0x1)<<1
+			p.image = append(p.image, (palette>>(index*2))&0x3)
+		}
+	}
+
+	p.image = append(p.image, make([]uint8, int(margins&0xF)*PRINTER_WIDTH*8)...)
+
+	if margins&0xF == 0 {
+		return nil
+	}
+	return p.feed()
+}
+
+// feed writes the printed image into the next PNG file of the directory
+func (p *Printer) feed() error {
+
+	if len(p.image) == 0 {
+		return nil
+	}
+
+	img := image.NewGray(image.Rect(0, 0, PRINTER_WIDTH, len(p.image)/PRINTER_WIDTH))
+	for i, shade := range p.image {
+		img.SetGray(i%PRINTER_WIDTH, i/PRINTER_WIDTH, color.Gray{Y: 255 - shade*85})
+	}
+	p.image = nil
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return err
+	}
+
+	// next unused file name
+	var file string
+	for {
+		p.pages++
+		file = filepath.Join(p.dir, fmt.Sprintf("print-%.4d.png", p.pages))
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Printf("Printed %s\n", file)
+	return png.Encode(f, img)
+}
+
+func (p *Printer) poll(_ *SerialPort) {}
+
+func (p *Printer) sync(_ *SerialPort) {}
+
+// close feeds the paper, writing what was printed without a margin after
+func (p *Printer) close() error {
+	return p.feed()
+}
+
+// ConnectPrinter plugs a Game Boy Printer into the serial port, the printed images are written
+// into dir (print-0001.png, print-0002.png, ...)
+func (g *GameBoy) ConnectPrinter(dir string) {
+	if err := g.c.serial.plug(NewPrinter(dir)); err != nil {
+		log.Printf("Error unplugging the serial device : %s\n", err.Error())
+	}
+}
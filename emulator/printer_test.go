@@ -0,0 +1,156 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// printerPacket builds a packet (magic, header, data, checksum and the 2 bytes answered by the printer)
+func printerPacket(command uint8, compression bool, data ...uint8) []uint8 {
+	header := []uint8{command, 0, 0, 0}
+	if compression {
+		header[1] = 1
+	}
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(data)))
+
+	var sum uint16
+	for _, b := range append(header, data...) {
+		sum += uint16(b)
+	}
+
+	packet := append([]uint8{PRINTER_MAGIC_1, PRINTER_MAGIC_2}, header...)
+	packet = append(packet, data...)
+	packet = binary.LittleEndian.AppendUint16(packet, sum)
+	return append(packet, 0, 0)
+}
+
+// sendPrinter sends the packets to the printer, returning the last answer
+func sendPrinter(p *Printer, packets ...[]uint8) uint8 {
+	var answer uint8
+	for _, packet := range packets {
+		for _, b := range packet {
+			answer = p.transfer(nil, b)
+		}
+	}
+	return answer
+}
+
+// printerStrip a DATA packet (2 tile rows) in black, RLE compressed
+func printerStrip() []uint8 {
+	return printerPacket(PRINTER_DATA, true, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x80|122, 0xFF)
+}
+
+func TestPrinter(t *testing.T) {
+
+	t.Run("rle", func(t *testing.T) {
+		assert.Equal(t, []uint8{0x1, 0x2, 0x7, 0x7, 0x7, 0x3}, decompressRLE([]uint8{0x01, 0x1, 0x2, 0x81, 0x7, 0x00, 0x3}))
+	})
+
+	t.Run("status", func(t *testing.T) {
+		p := NewPrinter(t.TempDir())
+		assert.Equal(t, uint8(0x00), sendPrinter(p, printerPacket(PRINTER_INIT, false)))
+
+		// answers the ID on the byte before the status
+		packet := printerStrip()
+		assert.Equal(t, uint8(PRINTER_ID), sendPrinter(p, packet[:len(packet)-1]))
+		assert.Equal(t, uint8(PRINTER_STATUS_UNPROCESSED), sendPrinter(p, packet[len(packet)-1:]))
+		assert.Len(t, p.buffer, 640)
+
+		assert.Equal(t, uint8(PRINTER_STATUS_UNPROCESSED|PRINTER_STATUS_FULL), sendPrinter(p, printerPacket(PRINTER_DATA, false)))
+
+		// wrong checksum
+		packet = printerPacket(PRINTER_STATUS, false)
+		packet[6]++
+		assert.Equal(t, uint8(PRINTER_STATUS_CHECKSUM_ERROR), sendPrinter(p, packet)&PRINTER_STATUS_CHECKSUM_ERROR)
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		p := NewPrinter(t.TempDir())
+		sendPrinter(p, printerPacket(PRINTER_INIT, false), printerStrip())
+		assert.Equal(t, uint8(PRINTER_STATUS_BUSY), sendPrinter(p, printerPacket(PRINTER_PRINT, false, 1, 0x01, 0xE4, 0x40)))
+		for range PRINTER_BUSY_STATUS - 1 {
+			assert.Equal(t, uint8(PRINTER_STATUS_BUSY), sendPrinter(p, printerPacket(PRINTER_STATUS, false)))
+		}
+		assert.Equal(t, uint8(0x00), sendPrinter(p, printerPacket(PRINTER_STATUS, false)))
+	})
+
+	t.Run("margins", func(t *testing.T) {
+		dir := t.TempDir()
+		p := NewPrinter(dir)
+
+		// no margin after, printed on the same image
+		sendPrinter(p, printerPacket(PRINTER_INIT, false), printerStrip(), printerPacket(PRINTER_PRINT, false, 1, 0x10, 0xE4, 0x40))
+		sendPrinter(p, printerStrip(), printerPacket(PRINTER_PRINT, false, 1, 0x00, 0x1B, 0x40))
+		assert.NoFileExists(t, filepath.Join(dir, "print-0001.png"))
+
+		// fed once closed
+		assert.NoError(t, p.close())
+		f, err := os.Open(filepath.Join(dir, "print-0001.png"))
+		assert.NoError(t, err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		assert.NoError(t, err)
+		assert.Equal(t, 8+16+16, img.Bounds().Dy())
+
+		// blank margin, black strip and the inverted palette (white)
+		r, _, _, _ := img.At(0, 0).RGBA()
+		assert.Equal(t, uint32(0xFFFF), r)
+		r, _, _, _ = img.At(0, 8).RGBA()
+		assert.Equal(t, uint32(0), r)
+		r, _, _, _ = img.At(0, 24).RGBA()
+		assert.Equal(t, uint32(0xFFFF), r)
+	})
+
+	t.Run("serial", func(t *testing.T) {
+		var table []uint8
+		table = append(table, printerPacket(PRINTER_INIT, false)...)
+		table = append(table, printerStrip()...)
+		table = append(table, printerPacket(PRINTER_DATA, false)...)
+		table = append(table, printerPacket(PRINTER_PRINT, false, 1, 0x03, 0xE4, 0x40)...)
+		table = append(table, printerPacket(PRINTER_STATUS, false)...)
+
+		rom := make([]uint8, 0x8000)
+		copy(rom[CPU_START:], []uint8{
+			0x21, 0x00, 0x02, // LD HL, 0x0200
+			0x11, uint8(len(table)), 0x00, // LD DE, len
+			0x2A,       // LD A, [HL+]
+			0xE0, 0x01, // LDH [SB], A
+			0x3E, 0x81, // LD A, 0x81 (start, internal clock)
+			0xE0, 0x02, // LDH [SC], A
+			0xF0, 0x02, // LDH A, [SC]
+			0x87,       // ADD A, A (bit 7 into carry)
+			0x38, 0xFB, // JR C, -5 (wait for the transfer)
+			0x1B,       // DEC DE
+			0x7A,       // LD A, D
+			0xB3,       // OR E
+			0x20, 0xEF, // JR NZ, -17 (next byte)
+			0xF0, 0x01, // LDH A, [SB]
+			0xEA, 0x00, 0xC0, // LD [0xC000], A
+			0x18, 0xFE, // JR -2
+		})
+		copy(rom[0x200:], table)
+
+		dir := t.TempDir()
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.LoadROM(rom))
+		g.ConnectPrinter(dir)
+		assert.NoError(t, g.RunFrames(8))
+
+		// last status, still printing
+		assert.Equal(t, uint8(PRINTER_STATUS_BUSY), g.ReadMemory(0xC000))
+
+		f, err := os.Open(filepath.Join(dir, "print-0001.png"))
+		assert.NoError(t, err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		assert.NoError(t, err)
+		assert.Equal(t, PRINTER_WIDTH, img.Bounds().Dx())
+		assert.Equal(t, 16+3*8, img.Bounds().Dy())
+		assert.NoError(t, g.Close())
+	})
+}
@@ -0,0 +1,356 @@
+package emulator
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// M-cycles to dispatch an interrupt
+	// https://gbdev.io/pandocs/Interrupts.html#interrupt-handling
+	INTERRUPT_DISPATCH_CYCLES = 5
+
+	// deepest call stack tracked, the outermost frames are dropped past it
+	PROFILER_MAX_DEPTH = 256
+)
+
+// Profiler guest code profiler, attributes the M-cycles of each instruction to its address and
+// to the call stack tracked from CALL/RST, RET/RETI and the interrupts. Each routine is named by
+// its entry address (or label, see Symbols), the time spent halted goes to "(halted)"
+type Profiler struct {
+	frames    []profileFrame // call stack, the root frame first
+	root      *profileNode
+	functions map[string]uint64 // by name
+	locations map[profileLocation]uint64
+	samples   map[profileSampleKey]*profileSample
+	cycles    int64
+	banks     int // ROM, external RAM or WRAM banks, the most of them (sizes the mapping)
+}
+
+type profileFrame struct {
+	sp       Word // SP after pushing the return address, popped once SP is above it
+	function uint64
+	node     *profileNode
+}
+
+// profileNode call stack node, the call sites up to the root
+type profileNode struct {
+	parent   *profileNode
+	site     uint64 // location of the CALL/RST or the interrupted instruction
+	children map[uint64]*profileNode
+}
+
+type profileLocation struct {
+	address  uint32 // bank << 16 | address
+	function uint64
+}
+
+type profileSampleKey struct {
+	node     *profileNode
+	location uint64
+}
+
+type profileSample struct {
+	instructions, cycles int64
+}
+
+// NewProfiler the root frame is the routine of the first instruction profiled
+func NewProfiler() *Profiler {
+	return &Profiler{
+		root:      &profileNode{},
+		functions: make(map[string]uint64),
+		locations: make(map[profileLocation]uint64),
+		samples:   make(map[profileSampleKey]*profileSample),
+	}
+}
+
+// routine names a routine by its label or address (e.g. Main, $0150, 01:4000)
+func (p *Profiler) routine(c *Cpu, entry Word, interrupt string) uint64 {
+
+	name := c.debugger.label(c, entry)
+	if name == "" {
+		name = fmt.Sprintf("$%.4X", entry)
+		if romBankNN(entry) {
+			name = fmt.Sprintf("%.2X:%.4X", c.memory.bank(entry), entry)
+		}
+	}
+	if interrupt != "" {
+		name += " (" + interrupt + " interrupt)"
+	}
+	return p.function(name)
+}
+
+func (p *Profiler) function(name string) uint64 {
+	id, ok := p.functions[name]
+	if !ok {
+		id = uint64(len(p.functions) + 1)
+		p.functions[name] = id
+	}
+	return id
+}
+
+func (p *Profiler) location(c *Cpu, pc Word, function uint64) uint64 {
+	key := profileLocation{address: uint32(c.memory.bank(pc))<<16 | uint32(pc), function: function}
+	id, ok := p.locations[key]
+	if !ok {
+		id = uint64(len(p.locations) + 1)
+		p.locations[key] = id
+	}
+	return id
+}
+
+// top the innermost frame, the root one is created on the first instruction
+func (p *Profiler) top(c *Cpu, pc Word) *profileFrame {
+	if len(p.frames) == 0 {
+		p.frames = append(p.frames, profileFrame{function: p.routine(c, pc, ""), node: p.root})
+		rom, ram := c.memory.banks()
+		p.banks = max(rom, ram, WRAM_BANKS)
+	}
+	return &p.frames[len(p.frames)-1]
+}
+
+func (p *Profiler) add(node *profileNode, location uint64, instructions, cycles int64) {
+	key := profileSampleKey{node: node, location: location}
+	s, ok := p.samples[key]
+	if !ok {
+		s = &profileSample{}
+		p.samples[key] = s
+	}
+	s.instructions += instructions
+	s.cycles += cycles
+	p.cycles += cycles
+}
+
+func (n *profileNode) child(site uint64) *profileNode {
+	node, ok := n.children[site]
+	if !ok {
+		node = &profileNode{parent: n, site: site}
+		if n.children == nil {
+			n.children = make(map[uint64]*profileNode)
+		}
+		n.children[site] = node
+	}
+	return node
+}
+
+// push enters the routine at PC, called from the site location
+func (p *Profiler) push(c *Cpu, site uint64, interrupt string) {
+	node := p.frames[len(p.frames)-1].node.child(site)
+	p.frames = append(p.frames, profileFrame{sp: c.sp, function: p.routine(c, c.pc, interrupt), node: node})
+	if len(p.frames) > PROFILER_MAX_DEPTH {
+		p.frames = append(p.frames[:1], p.frames[2:]...)
+	}
+}
+
+// instruction attributes the instruction executed at pc, then follows the calls and returns (sp
+// is the stack pointer before the instruction)
+func (p *Profiler) instruction(c *Cpu, pc, sp Word) {
+
+	top := p.top(c, pc)
+	location := p.location(c, pc, top.function)
+	p.add(top.node, location, 1, int64(c.requiredCycles))
+
+	// CALL/RST taken
+	if !c.cbprefixed && isCall(c.opcode) && c.sp == sp-2 {
+		p.push(c, location, "")
+	}
+
+	// returned (or the return address was discarded)
+	for len(p.frames) > 1 && p.frames[len(p.frames)-1].sp < c.sp {
+		p.frames = p.frames[:len(p.frames)-1]
+	}
+}
+
+// interrupt enters the handler, c.previousPC is the interrupted instruction
+func (p *Profiler) interrupt(c *Cpu, serviced uint8) {
+	for bit, name := range interruptNames {
+		if serviced&(1<<bit) == 0 {
+			continue
+		}
+		top := p.top(c, c.previousPC)
+		p.push(c, p.location(c, c.previousPC, top.function), name)
+		handler := p.frames[len(p.frames)-1]
+		p.add(handler.node, p.location(c, c.pc, handler.function), 0, INTERRUPT_DISPATCH_CYCLES)
+		return
+	}
+}
+
+// halted attributes a M-cycle spent halted to "(halted)", called by the HALT instruction
+func (p *Profiler) halted(c *Cpu) {
+	halt := c.pc - 1
+	top := p.top(c, halt)
+	node := top.node.child(p.location(c, halt, top.function))
+	p.add(node, p.location(c, c.pc, p.function("(halted)")), 0, 1)
+}
+
+// Write writes the profile in the pprof format (gzipped protocol buffer), the sample values
+// are the instructions and M-cycles executed. The location addresses are bank << 16 | address
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+func (p *Profiler) Write(w io.Writer) error {
+
+	var b protobuf
+	index := map[string]int64{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		i, ok := index[s]
+		if !ok {
+			i = int64(len(table))
+			index[s] = i
+			table = append(table, s)
+		}
+		return i
+	}
+
+	// sample types
+	for _, t := range [][2]string{{"instructions", "count"}, {"cycles", "count"}} {
+		var v protobuf
+		v.int64(1, str(t[0]))
+		v.int64(2, str(t[1]))
+		b.message(1, v)
+	}
+
+	// samples, ordered for a stable output
+	keys := make([]profileSampleKey, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := p.stack(keys[i]), p.stack(keys[j])
+		for k := 0; k < len(si) && k < len(sj); k++ {
+			if si[k] != sj[k] {
+				return si[k] < sj[k]
+			}
+		}
+		return len(si) < len(sj)
+	})
+	for _, key := range keys {
+		s := p.samples[key]
+		var v protobuf
+		v.packed(1, p.stack(key))
+		v.packed(2, []uint64{uint64(s.instructions), uint64(s.cycles)})
+		b.message(2, v)
+	}
+
+	// mapping, the functions are already resolved, up to the last bank
+	var m protobuf
+	m.uint64(1, 1)
+	m.uint64(3, uint64(max(p.banks, 1))<<16)
+	m.int64(5, str("ROM"))
+	m.bool(7, true)
+	b.message(3, m)
+
+	// locations
+	locations := make([]profileLocation, len(p.locations))
+	for key, id := range p.locations {
+		locations[id-1] = key
+	}
+	for i, key := range locations {
+		var line, v protobuf
+		line.uint64(1, key.function)
+		v.uint64(1, uint64(i+1))
+		v.uint64(2, 1)
+		v.uint64(3, uint64(key.address))
+		v.message(4, line)
+		b.message(4, v)
+	}
+
+	// functions
+	functions := make([]string, len(p.functions))
+	for name, id := range p.functions {
+		functions[id-1] = name
+	}
+	for i, name := range functions {
+		var v protobuf
+		v.uint64(1, uint64(i+1))
+		v.int64(2, str(name))
+		v.int64(3, str(name))
+		b.message(5, v)
+	}
+
+	// period (a M-cycle), duration and default sample type
+	var period protobuf
+	period.int64(1, str("cycles"))
+	period.int64(2, str("count"))
+	b.int64(10, int64(float64(p.cycles)*4*1e9/CLOCK_SPEED)) // int64 overflows after ~37 minutes
+	b.message(11, period)
+	b.int64(12, 1)
+	b.int64(14, str("cycles"))
+
+	// the string table goes last, the fields above add to it
+	for _, s := range table {
+		b.string(6, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// stack locations of a sample, the leaf first
+func (p *Profiler) stack(key profileSampleKey) []uint64 {
+	stack := []uint64{key.location}
+	for node := key.node; node != nil && node.parent != nil; node = node.parent {
+		stack = append(stack, node.site)
+	}
+	return stack
+}
+
+// protobuf minimal protocol buffer encoder
+// https://protobuf.dev/programming-guides/encoding/
+type protobuf []byte
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protobuf) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protobuf) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protobuf) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protobuf) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protobuf) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protobuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protobuf) message(field int, m protobuf) {
+	b.bytes(field, m)
+}
+
+func (b *protobuf) packed(field int, values []uint64) {
+	var v protobuf
+	for _, n := range values {
+		v.varint(n)
+	}
+	b.bytes(field, v)
+}
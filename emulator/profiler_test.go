@@ -0,0 +1,161 @@
+package emulator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// profileROM calls a routine and halts until the VBlank interrupt, every frame
+func profileROM() []uint8 {
+	rom := make([]uint8, 0x8000)
+	rom[0x40] = 0xD9 // 0040 RETI
+	copy(rom[CPU_START:], []uint8{
+		0x3E, 0x01, // 0100 LD A, $01
+		0xE0, 0xFF, // 0102 LDH [IE], A
+		0x3E, 0x91, // 0104 LD A, $91
+		0xE0, 0x40, // 0106 LDH [LCDC], A
+		0xFB,             // 0108 EI
+		0xCD, 0x20, 0x01, // 0109 CALL $0120
+		0x76,       // 010C HALT
+		0x18, 0xFA, // 010D JR -6
+	})
+	copy(rom[0x120:], []uint8{
+		0x04, // 0120 INC B
+		0xC9, // 0121 RET
+	})
+	return rom
+}
+
+// profileFunctions the M-cycles and instructions attributed to each function, and its callers
+func profileFunctions(p *Profiler) (map[string]profileSample, map[string]map[string]bool) {
+
+	names := make(map[uint64]string)
+	for name, id := range p.functions {
+		names[id] = name
+	}
+	functions := make(map[uint64]uint64)
+	for key, id := range p.locations {
+		functions[id] = key.function
+	}
+
+	flat, callers := make(map[string]profileSample), make(map[string]map[string]bool)
+	for key, s := range p.samples {
+		name := names[functions[key.location]]
+		f := flat[name]
+		f.instructions += s.instructions
+		f.cycles += s.cycles
+		flat[name] = f
+		if key.node.parent != nil {
+			if callers[name] == nil {
+				callers[name] = make(map[string]bool)
+			}
+			callers[name][names[functions[key.node.site]]] = true
+		}
+	}
+	return flat, callers
+}
+
+func TestProfiler(t *testing.T) {
+
+	var out bytes.Buffer
+	g := NewGameBoy(Config{Silent: true, Profile: &out})
+	symbols, err := ParseSymbols(strings.NewReader("00:0040 VBlank\n00:0100 Main\n00:0120 Update\n"))
+	assert.NoError(t, err)
+	g.SetSymbols(symbols)
+	assert.NoError(t, g.LoadROM(profileROM()))
+	assert.NoError(t, g.RunFrames(10))
+
+	flat, callers := profileFunctions(g.c.profiler)
+
+	// a call and a VBlank interrupt per frame
+	frames := flat["Update"].instructions / 2
+	assert.GreaterOrEqual(t, frames, int64(9))
+	assert.Equal(t, profileSample{instructions: 2 * frames, cycles: 5 * frames}, flat["Update"])
+	assert.Equal(t, map[string]bool{"Main": true}, callers["Update"])
+
+	vblank := flat["VBlank (VBLANK interrupt)"]
+	assert.InDelta(t, frames, vblank.instructions, 1)
+	assert.Equal(t, vblank.instructions*(INTERRUPT_DISPATCH_CYCLES+4), vblank.cycles)
+	assert.True(t, callers["VBlank (VBLANK interrupt)"]["Main"])
+
+	// halted most of the frame, the M-cycles all accounted for
+	assert.Equal(t, map[string]bool{"Main": true}, callers["(halted)"])
+	assert.Greater(t, flat["(halted)"].cycles, 9*flat["Main"].cycles)
+	var total int64
+	for _, f := range flat {
+		total += f.cycles
+	}
+	assert.Equal(t, g.c.profiler.cycles, total)
+	assert.InDelta(t, 10*CYCLES_PER_FRAME/4, total, CYCLES_PER_FRAME/4)
+
+	// pprof profile, written by Close
+	assert.NoError(t, g.Close())
+	r, err := gzip.NewReader(&out)
+	assert.NoError(t, err)
+	profile, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	for _, s := range []string{"instructions", "cycles", "count", "Main", "Update", "VBlank (VBLANK interrupt)", "(halted)"} {
+		assert.True(t, bytes.Contains(profile, append([]byte{0x32, uint8(len(s))}, s...)), s)
+	}
+}
+
+// protobufFields decodes the varint (0) and length-delimited (2) fields of a message, by number
+func protobufFields(b []byte) map[int][]any {
+	fields := make(map[int][]any)
+	varint := func() uint64 {
+		var v uint64
+		for shift := 0; ; shift += 7 {
+			c := b[0]
+			b = b[1:]
+			v |= uint64(c&0x7F) << shift
+			if c < 0x80 {
+				return v
+			}
+		}
+	}
+	for len(b) > 0 {
+		key := varint()
+		if key&0x7 == 0 {
+			fields[int(key>>3)] = append(fields[int(key>>3)], varint())
+			continue
+		}
+		n := varint()
+		fields[int(key>>3)] = append(fields[int(key>>3)], b[:n])
+		b = b[n:]
+	}
+	return fields
+}
+
+func TestProfilerLimits(t *testing.T) {
+
+	// an hour of emulated time, on a 8 MiB ROM
+	p := NewProfiler()
+	p.cycles, p.banks = CLOCK_SPEED/4*3600, 512
+
+	var out bytes.Buffer
+	assert.NoError(t, p.Write(&out))
+	r, err := gzip.NewReader(&out)
+	assert.NoError(t, err)
+	profile, err := io.ReadAll(r)
+	assert.NoError(t, err)
+
+	fields := protobufFields(profile)
+	assert.Equal(t, []any{uint64(3600 * 1e9)}, fields[10])
+	mapping := protobufFields(fields[3][0].([]byte))
+	assert.Equal(t, []any{uint64(512 << 16)}, mapping[3])
+}
+
+func TestProtobuf(t *testing.T) {
+	var b, m protobuf
+	m.uint64(1, 300)
+	m.uint64(2, 0)
+	b.message(3, m)
+	b.packed(4, []uint64{1, 150})
+	b.string(5, "ab")
+	assert.Equal(t, protobuf{0x1A, 0x03, 0x08, 0xAC, 0x02, 0x22, 0x03, 0x01, 0x96, 0x01, 0x2A, 0x02, 'a', 'b'}, b)
+}
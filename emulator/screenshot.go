@@ -0,0 +1,73 @@
+package emulator
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+)
+
+// SHADES DMG shades (0-3) as gray levels, the same used by the dmg-acid2 reference image
+// https://github.com/mattcurrie/dmg-acid2#reference-image
+var SHADES = [4]color.Gray{{Y: 0xFF}, {Y: 0xAA}, {Y: 0x55}, {Y: 0x00}}
+
+// FrameImage converts a frame into a grayscale image (see SHADES)
+func FrameImage(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]Pixel) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, SCREEN_WIDTH, SCREEN_HEIGHT))
+	for y := 0; y < SCREEN_HEIGHT; y++ {
+		for x := 0; x < SCREEN_WIDTH; x++ {
+			// transparent pixels (100) are not drawn, the LCD shows the lightest shade
+			shade := frame[y][x]
+			if int(shade) >= len(SHADES) {
+				shade = 0
+			}
+			img.SetGray(x, y, SHADES[shade])
+		}
+	}
+	return img
+}
+
+// ColorFrameImage converts a CGB frame into a RGBA image
+func ColorFrameImage(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, SCREEN_WIDTH, SCREEN_HEIGHT))
+	for y := 0; y < SCREEN_HEIGHT; y++ {
+		for x := 0; x < SCREEN_WIDTH; x++ {
+			img.SetRGBA(x, y, frame[y][x].RGBA())
+		}
+	}
+	return img
+}
+
+// Screenshot returns the last rendered frame as a grayscale image
+func (g *GameBoy) Screenshot() *image.Gray {
+	return FrameImage(&g.video.videoMemory)
+}
+
+// ColorScreenshot returns the last rendered frame in CGB mode (or on the SGB models) as a RGBA image
+func (g *GameBoy) ColorScreenshot() *image.RGBA {
+	return ColorFrameImage(&g.video.colorMemory)
+}
+
+// WriteScreenshot encodes the last rendered frame as PNG, in color in CGB mode and on the SGB models
+func (g *GameBoy) WriteScreenshot(w io.Writer) error {
+	if g.c.memory.cgb || g.c.memory.sgb != nil {
+		return png.Encode(w, g.ColorScreenshot())
+	}
+	return png.Encode(w, g.Screenshot())
+}
+
+// SaveScreenshot writes the last rendered frame into a PNG file
+func (g *GameBoy) SaveScreenshot(file string) error {
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := g.WriteScreenshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
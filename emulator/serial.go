@@ -0,0 +1,306 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+const (
+	// m-cycles per bit, 8192 Hz (262144 Hz with the CGB fast clock)
+	// https://gbdev.io/pandocs/Serial_Data_Transfer_(Link_Cable).html#ff02--sc-serial-transfer-control
+	SERIAL_CLOCK      = 128
+	SERIAL_FAST_CLOCK = 4
+
+	// how long a Game Boy waits for the other end of the cable before giving up (0xFF received)
+	LINK_TIMEOUT = time.Second
+
+	// bytes sent kept for GameBoy.Serial, the oldest half is dropped once full (e.g. link cable
+	// or printer sessions, nobody reads them)
+	SERIAL_BUFFER_SIZE = 0x10000
+)
+
+// link cable messages, type, data and the m-cycle of the frame when sent
+const (
+	LINK_TRANSFER = 'T' // byte shifted out by the clock master
+	LINK_REPLY    = 'R' // byte shifted out by the external clock side
+	LINK_SYNC     = 'S' // frame boundary, keeps both Game Boys in lockstep
+
+	LINK_MESSAGE_SIZE = 6
+)
+
+// SerialPort the serial port (SB/SC), the clock master (internal clock) exchanges a byte with
+// the device plugged into the port (link cable, printer) once its 8 bits are clocked, without a
+// device 0xFF is received
+// https://gbdev.io/pandocs/Serial_Data_Transfer_(Link_Cable).html
+type SerialPort struct {
+	mem    *Memory
+	device serialDevice // plugged into the serial port, nil if none
+	bits   int          // bits left of the internal clock transfer
+	clock  int          // m-cycles since the last bit
+	cycles uint32       // m-cycles since the frame started
+	sent   []uint8      // bytes sent since the last GameBoy.Serial (up to SERIAL_BUFFER_SIZE)
+}
+
+func NewSerialPort(mem *Memory) *SerialPort {
+	return &SerialPort{mem: mem}
+}
+
+// sync runs every m-cycle (CPU speed), also while halted
+func (s *SerialPort) sync() {
+
+	s.cycles++
+
+	// transfers clocked by the other end
+	if s.device != nil {
+		s.device.poll(s)
+	}
+
+	sb := s.mem.Read(PORT_SERIAL_TRANSFER_SB)
+	sc := s.mem.Read(PORT_SERIAL_TRANSFER_SC)
+
+	// transfer enabled AND clock master
+	if sc&0x81 != 0x81 {
+		s.bits = 0
+		return
+	}
+
+	if s.bits == 0 {
+		s.record(sb)
+		s.bits = 8
+		s.clock = 0
+	}
+
+	period := SERIAL_CLOCK
+	if s.mem.cgb && sc&0x2 > 0 {
+		period = SERIAL_FAST_CLOCK
+	}
+
+	if s.clock++; s.clock < period {
+		return
+	}
+	s.clock = 0
+
+	if s.bits--; s.bits > 0 {
+		return
+	}
+
+	received := uint8(0xFF)
+	if s.device != nil {
+		received = s.device.transfer(s, sb)
+	}
+	s.complete(received)
+}
+
+// record keeps a byte sent for GameBoy.Serial, the latest ones if it isn't called
+func (s *SerialPort) record(data uint8) {
+	if len(s.sent) == SERIAL_BUFFER_SIZE {
+		s.sent = append(s.sent[:0], s.sent[SERIAL_BUFFER_SIZE/2:]...)
+	}
+	s.sent = append(s.sent, data)
+}
+
+// receive shifts in the byte clocked by the other Game Boy, returning the byte shifted out
+// (0xFF if no external clock transfer is enabled)
+func (s *SerialPort) receive(data uint8) uint8 {
+	if s.mem.Read(PORT_SERIAL_TRANSFER_SC)&0x81 != 0x80 {
+		return 0xFF
+	}
+	sb := s.mem.Read(PORT_SERIAL_TRANSFER_SB)
+	s.complete(data)
+	return sb
+}
+
+func (s *SerialPort) complete(data uint8) {
+	s.mem.Write(PORT_SERIAL_TRANSFER_SB, data)
+	s.mem.Write(PORT_SERIAL_TRANSFER_SC, s.mem.Read(PORT_SERIAL_TRANSFER_SC)&0x7F) // clear bit 7
+	// request SERIAL interruption
+	s.mem.Write(INTERRUPT_FLAG, s.mem.Read(INTERRUPT_FLAG)|0x8)
+}
+
+// frame runs once per frame, waits for the other Game Boy to reach the same frame
+func (s *SerialPort) frame() {
+	if s.device != nil {
+		s.device.sync(s)
+	}
+	s.cycles = 0
+}
+
+// plug replaces the device plugged into the serial port
+func (s *SerialPort) plug(device serialDevice) error {
+	var err error
+	if s.device != nil {
+		err = s.device.close()
+	}
+	s.device = device
+	return err
+}
+
+// serialDevice a device plugged into the serial port (link cable, printer)
+type serialDevice interface {
+	// transfer exchanges the byte clocked by the serial port (internal clock)
+	transfer(s *SerialPort, data uint8) uint8
+	// poll runs every m-cycle, the device may clock a transfer (external clock) through s.receive
+	poll(s *SerialPort)
+	// sync runs once per frame
+	sync(s *SerialPort)
+	close() error
+}
+
+// link one end of the link cable, only the emulation goroutine writes to the connection, the
+// messages from the other end are read (in order) in background
+type link struct {
+	conn     net.Conn
+	messages chan linkMessage
+	pending  *linkMessage // transfer received ahead of time, answered once the frame cycle is reached
+	syncs    int          // frames finished by the other Game Boy, not waited for yet
+	closed   chan struct{}
+}
+
+type linkMessage struct {
+	kind  uint8
+	data  uint8
+	cycle uint32
+}
+
+func newLink(conn net.Conn) *link {
+	l := &link{
+		conn:     conn,
+		messages: make(chan linkMessage, 16),
+		closed:   make(chan struct{}),
+	}
+	go l.read()
+	return l
+}
+
+func (l *link) read() {
+	defer close(l.closed)
+	buf := make([]uint8, LINK_MESSAGE_SIZE)
+	for {
+		if _, err := io.ReadFull(l.conn, buf); err != nil {
+			log.Printf("Link cable disconnected\n")
+			return
+		}
+		l.messages <- linkMessage{kind: buf[0], data: buf[1], cycle: binary.BigEndian.Uint32(buf[2:])}
+	}
+}
+
+func (l *link) send(kind, data uint8, cycle uint32) bool {
+	buf := make([]uint8, LINK_MESSAGE_SIZE)
+	buf[0], buf[1] = kind, data
+	binary.BigEndian.PutUint32(buf[2:], cycle)
+	_, err := l.conn.Write(buf)
+	return err == nil
+}
+
+func (l *link) close() error {
+	return l.conn.Close()
+}
+
+// answer replies to a transfer clocked by the other Game Boy
+func (l *link) answer(s *SerialPort, msg linkMessage) {
+	l.send(LINK_REPLY, s.receive(msg.data), s.cycles)
+}
+
+// wait handles the messages of the other Game Boy until done returns true, transfers are
+// answered right away (the other Game Boy is behind or also waiting)
+func (l *link) wait(s *SerialPort, done func(msg linkMessage) bool) {
+	if l.pending != nil {
+		l.answer(s, *l.pending)
+		l.pending = nil
+	}
+	timeout := time.After(LINK_TIMEOUT)
+	for {
+		select {
+		case msg := <-l.messages:
+			switch msg.kind {
+			case LINK_TRANSFER:
+				l.answer(s, msg)
+			case LINK_SYNC:
+				l.syncs++
+			}
+			if done(msg) {
+				return
+			}
+		case <-l.closed:
+			return
+		case <-timeout:
+			log.Printf("Link cable timeout\n")
+			return
+		}
+	}
+}
+
+// transfer sends the byte of the clock master and waits for the byte of the other Game Boy,
+// which answers once it reaches the same cycle of the frame
+func (l *link) transfer(s *SerialPort, data uint8) uint8 {
+	if !l.send(LINK_TRANSFER, data, s.cycles) {
+		return 0xFF
+	}
+	received := uint8(0xFF)
+	l.wait(s, func(msg linkMessage) bool {
+		if msg.kind == LINK_REPLY {
+			received = msg.data
+			return true
+		}
+		return false
+	})
+	return received
+}
+
+// poll answers the transfer clocked by the other Game Boy, if any, once the cycle of the frame
+// it was sent at is reached
+func (l *link) poll(s *SerialPort) {
+	for l.pending == nil {
+		select {
+		case msg := <-l.messages:
+			switch msg.kind {
+			case LINK_TRANSFER:
+				l.pending = &msg
+			case LINK_SYNC:
+				l.syncs++
+			}
+		default:
+			return
+		}
+	}
+	if s.cycles >= l.pending.cycle {
+		l.answer(s, *l.pending)
+		l.pending = nil
+	}
+}
+
+// sync waits for the other Game Boy to finish the same frame
+func (l *link) sync(s *SerialPort) {
+	if !l.send(LINK_SYNC, 0, s.cycles) {
+		return
+	}
+	if l.syncs == 0 {
+		l.wait(s, func(msg linkMessage) bool { return msg.kind == LINK_SYNC })
+	}
+	if l.syncs > 0 {
+		l.syncs--
+	}
+}
+
+// Connect plugs the link cable into the serial port, the other end of the connection must be
+// plugged into another Game Boy (see LinkCable), both run in lockstep from then on
+func (g *GameBoy) Connect(conn net.Conn) {
+	if err := g.c.serial.plug(newLink(conn)); err != nil {
+		log.Printf("Error unplugging the serial device : %s\n", err.Error())
+	}
+}
+
+// Disconnect unplugs the link cable (or the printer)
+func (g *GameBoy) Disconnect() error {
+	return g.c.serial.plug(nil)
+}
+
+// LinkCable connects two Game Boys of the same process, each must run on its own goroutine
+func LinkCable(a, b *GameBoy) {
+	c1, c2 := net.Pipe()
+	a.Connect(c1)
+	b.Connect(c2)
+}
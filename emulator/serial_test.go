@@ -0,0 +1,129 @@
+package emulator
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serialProgram starts a transfer of data (SC = sc) and stores the received byte at 0xC000
+func serialProgram(data, sc uint8) []uint8 {
+	return []uint8{
+		0x3E, data, // LD A, data
+		0xE0, 0x01, // LDH [SB], A
+		0x3E, sc, // LD A, sc
+		0xE0, 0x02, // LDH [SC], A
+		0xF0, 0x02, // LDH A, [SC]
+		0x87,       // ADD A, A (bit 7 into carry)
+		0x38, 0xFB, // JR C, -5 (wait for the transfer)
+		0xF0, 0x01, // LDH A, [SB]
+		0xEA, 0x00, 0xC0, // LD [0xC000], A
+		0x18, 0xFE, // JR -2
+	}
+}
+
+// runLinked runs both Game Boys (each on its own goroutine) for n frames
+func runLinked(t *testing.T, n int, gbs ...*GameBoy) {
+	var wg sync.WaitGroup
+	for _, g := range gbs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, g.RunFrames(n))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSerial(t *testing.T) {
+
+	t.Run("no cable", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t, serialProgram(0x42, 0x81)...)))
+		assert.NoError(t, g.RunFrame())
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(0xC000))
+		assert.Equal(t, []uint8{0x42}, g.Serial())
+		assert.Equal(t, uint8(0x8), g.ReadMemory(uint16(INTERRUPT_FLAG))&0x8)
+	})
+
+	t.Run("bytes sent are capped", func(t *testing.T) {
+		s := NewSerialPort(nil)
+		for i := range SERIAL_BUFFER_SIZE + 10 {
+			s.record(uint8(i))
+		}
+		assert.Len(t, s.sent, SERIAL_BUFFER_SIZE/2+10)
+		assert.Equal(t, uint8((SERIAL_BUFFER_SIZE+9)&0xFF), s.sent[len(s.sent)-1])
+	})
+
+	t.Run("external clock without cable", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, g.Load(writeTestROM(t, serialProgram(0x42, 0x80)...)))
+		assert.NoError(t, g.RunFrames(2))
+		assert.Equal(t, uint8(0x80), g.ReadMemory(uint16(PORT_SERIAL_TRANSFER_SC))&0x80)
+		assert.Empty(t, g.Serial())
+	})
+
+	t.Run("same process", func(t *testing.T) {
+		master := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, master.Load(writeTestROM(t, serialProgram(0x42, 0x81)...)))
+		slave := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, slave.Load(writeTestROM(t, serialProgram(0x99, 0x80)...)))
+
+		LinkCable(master, slave)
+		runLinked(t, 3, master, slave)
+
+		assert.Equal(t, uint8(0x99), master.ReadMemory(0xC000))
+		assert.Equal(t, uint8(0x42), slave.ReadMemory(0xC000))
+		assert.NoError(t, master.Close())
+		assert.NoError(t, slave.Close())
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+
+		accepted := make(chan net.Conn)
+		go func() {
+			conn, err := listener.Accept()
+			assert.NoError(t, err)
+			accepted <- conn
+		}()
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+
+		master := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, master.Load(writeTestROM(t, serialProgram(0x42, 0x81)...)))
+		master.Connect(conn)
+
+		slave := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, slave.Load(writeTestROM(t, serialProgram(0x99, 0x80)...)))
+		slave.Connect(<-accepted)
+
+		runLinked(t, 3, master, slave)
+
+		assert.Equal(t, uint8(0x99), master.ReadMemory(0xC000))
+		assert.Equal(t, uint8(0x42), slave.ReadMemory(0xC000))
+		assert.NoError(t, master.Disconnect())
+		assert.NoError(t, slave.Disconnect())
+	})
+
+	t.Run("both masters", func(t *testing.T) {
+		a := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, a.Load(writeTestROM(t, serialProgram(0x42, 0x81)...)))
+		b := NewGameBoy(Config{Silent: true})
+		assert.NoError(t, b.Load(writeTestROM(t, serialProgram(0x99, 0x81)...)))
+
+		LinkCable(a, b)
+		runLinked(t, 2, a, b)
+
+		// nobody listening on the external clock
+		assert.Equal(t, uint8(0xFF), a.ReadMemory(0xC000))
+		assert.Equal(t, uint8(0xFF), b.ReadMemory(0xC000))
+		assert.NoError(t, a.Close())
+		assert.NoError(t, b.Close())
+	})
+}
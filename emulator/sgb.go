@@ -0,0 +1,488 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"log"
+)
+
+const (
+	// SGB screen, the border surrounds the LCD
+	SGB_SCREEN_WIDTH  = 256
+	SGB_SCREEN_HEIGHT = 224
+	SGB_LCD_X         = (SGB_SCREEN_WIDTH - SCREEN_WIDTH) / 2
+	SGB_LCD_Y         = (SGB_SCREEN_HEIGHT - SCREEN_HEIGHT) / 2
+
+	// bytes per packet, a command takes 1-7 packets
+	SGB_PACKET_SIZE = 16
+
+	// bytes copied from the screen by the *_TRN commands
+	SGB_TRANSFER_SIZE = 0x1000
+
+	SGB_SYSTEM_PALETTES = 512
+	SGB_ATTR_FILES      = 45
+	SGB_ATTR_FILE_SIZE  = 90
+)
+
+// SGB commands
+// https://gbdev.io/pandocs/SGB_Command_Summary.html
+const (
+	SGB_PAL01    = 0x00
+	SGB_PAL23    = 0x01
+	SGB_PAL03    = 0x02
+	SGB_PAL12    = 0x03
+	SGB_ATTR_BLK = 0x04
+	SGB_ATTR_LIN = 0x05
+	SGB_ATTR_DIV = 0x06
+	SGB_ATTR_CHR = 0x07
+	SGB_PAL_SET  = 0x0A
+	SGB_PAL_TRN  = 0x0B
+	SGB_MLT_REQ  = 0x11
+	SGB_CHR_TRN  = 0x13
+	SGB_PCT_TRN  = 0x14
+	SGB_ATTR_TRN = 0x15
+	SGB_ATTR_SET = 0x16
+	SGB_MASK_EN  = 0x17
+)
+
+// SGB screen masks (MASK_EN)
+const (
+	SGB_MASK_CANCEL = iota
+	SGB_MASK_FREEZE
+	SGB_MASK_BLACK
+	SGB_MASK_COLOR0
+)
+
+// sgbDefaultPalette palette set by the SGB BIOS before the game sends its own
+var sgbDefaultPalette = [4]Color{0x67BF, 0x265B, 0x10B5, 0x2866}
+
+// Sgb Super Game Boy, receives command packets through the joypad port and colorizes the
+// LCD frames, surrounded by a border
+// https://gbdev.io/pandocs/SGB_Functions.html
+type Sgb struct {
+	mem *Memory
+
+	// the cartridge supports the SGB functions (packets are ignored otherwise)
+	enabled bool
+
+	// packet transfer
+	receiving bool
+	released  bool // P14 and P15 high since the last bit
+	bits      int  // bits received of the current packet
+	packet    [SGB_PACKET_SIZE]uint8
+	command   []uint8 // packets received of the current command
+
+	// multiplayer (MLT_REQ)
+	players int
+	player  uint8
+	joypad  uint8 // last P14/P15 written
+
+	// colorization
+	palettes    [4][4]Color
+	sysPalettes [SGB_SYSTEM_PALETTES][4]Color
+	attrFiles   [SGB_ATTR_FILES][SGB_ATTR_FILE_SIZE]uint8
+	attrMap     [SCREEN_HEIGHT / 8][SCREEN_WIDTH / 8]uint8 // palette of each 8x8 cell
+	mask        uint8
+
+	// border
+	borderTiles    [256][32]uint8 // 4bpp
+	borderMap      [32 * 28]uint16
+	borderPalettes [4][16]Color // palettes 4-7
+
+	screen [SGB_SCREEN_HEIGHT][SGB_SCREEN_WIDTH]Color
+}
+
+func NewSgb(mem *Memory) *Sgb {
+	s := &Sgb{mem: mem, players: 1, joypad: 0x30}
+	for i := range s.palettes {
+		s.palettes[i] = sgbDefaultPalette
+	}
+	return s
+}
+
+// sgbModel reports if the model is a Super Game Boy
+func sgbModel(mode Mode) bool {
+	return mode == SGB || mode == SGB2
+}
+
+// init enables the SGB functions if the cartridge supports them
+func (s *Sgb) init() {
+	s.enabled = s.mem.mem[CARTRIDGE_HEADER_SGB_FLAG] == 0x03 && s.mem.mem[CARTRIDGE_HEADER_OLD_LICENSEE] == 0x33
+}
+
+// writeJoypad receives the P14/P15 pulses written to the joypad port
+// https://gbdev.io/pandocs/SGB_Command_Packet.html
+func (s *Sgb) writeJoypad(value uint8) {
+
+	value &= 0x30
+
+	// next joypad on P15 rising edge (MLT_REQ)
+	if s.players > 1 && s.joypad&0x20 == 0 && value&0x20 > 0 {
+		s.player = (s.player + 1) % uint8(s.players)
+	}
+	s.joypad = value
+
+	if !s.enabled {
+		return
+	}
+
+	switch value {
+	case 0x00:
+		// reset pulse, starts a packet
+		s.receiving = true
+		s.released = false
+		s.bits = 0
+		s.packet = [SGB_PACKET_SIZE]uint8{}
+	case 0x30:
+		s.released = true
+	case 0x10, 0x20:
+		if !s.receiving || !s.released {
+			return
+		}
+		s.released = false
+
+		// stop bit, after 128 bits
+		if s.bits == SGB_PACKET_SIZE*8 {
+			s.receiving = false
+			if value == 0x20 {
+				s.receivePacket()
+			}
+			return
+		}
+
+		// P15 low = 1, P14 low = 0, LSB first
+		if value == 0x10 {
+			s.packet[s.bits/8] |= 1 << (s.bits % 8)
+		}
+		s.bits++
+	}
+}
+
+// receivePacket accumulates the packets of a command, running it once complete
+func (s *Sgb) receivePacket() {
+
+	s.command = append(s.command, s.packet[:]...)
+
+	length := int(s.command[0] & 0x7)
+	if length == 0 {
+		length = 1
+	}
+
+	if len(s.command) < length*SGB_PACKET_SIZE {
+		return
+	}
+
+	s.run(s.command)
+	s.command = nil
+}
+
+// joypadState returns the joypad state of the selected player (see MLT_REQ), only the
+// player 1 has buttons
+func (s *Sgb) joypadState(state uint8) uint8 {
+	if s.player != 0 {
+		return 0xFF
+	}
+	return state
+}
+
+func (s *Sgb) run(data []uint8) {
+
+	command := data[0] >> 3
+
+	switch command {
+	case SGB_PAL01:
+		s.setPalettes(data, 0, 1)
+	case SGB_PAL23:
+		s.setPalettes(data, 2, 3)
+	case SGB_PAL03:
+		s.setPalettes(data, 0, 3)
+	case SGB_PAL12:
+		s.setPalettes(data, 1, 2)
+	case SGB_ATTR_BLK:
+		s.attrBlock(data)
+	case SGB_ATTR_LIN:
+		s.attrLine(data)
+	case SGB_ATTR_DIV:
+		s.attrDivide(data)
+	case SGB_ATTR_CHR:
+		s.attrChar(data)
+	case SGB_PAL_SET:
+		s.paletteSet(data)
+	case SGB_PAL_TRN:
+		transfer := s.vramTransfer()
+		for p := range s.sysPalettes {
+			for c := range s.sysPalettes[p] {
+				s.sysPalettes[p][c] = sgbColor(transfer, p*8+c*2)
+			}
+		}
+	case SGB_ATTR_TRN:
+		transfer := s.vramTransfer()
+		for f := range s.attrFiles {
+			copy(s.attrFiles[f][:], transfer[f*SGB_ATTR_FILE_SIZE:])
+		}
+	case SGB_ATTR_SET:
+		s.applyAttrFile(data[1] & 0x3F)
+		if data[1]&0x40 > 0 {
+			s.mask = SGB_MASK_CANCEL
+		}
+	case SGB_MLT_REQ:
+		switch data[1] & 0x3 {
+		case 0x1:
+			s.players = 2
+		case 0x3:
+			s.players = 4
+		default:
+			s.players = 1
+		}
+		s.player = 0
+	case SGB_CHR_TRN:
+		transfer := s.vramTransfer()
+		first := int(data[1]&0x1) * 128
+		for t := range 128 {
+			copy(s.borderTiles[first+t][:], transfer[t*32:])
+		}
+	case SGB_PCT_TRN:
+		transfer := s.vramTransfer()
+		for i := range s.borderMap {
+			s.borderMap[i] = binary.LittleEndian.Uint16(transfer[i*2:])
+		}
+		for p := range s.borderPalettes {
+			for c := range s.borderPalettes[p] {
+				s.borderPalettes[p][c] = sgbColor(transfer, 0x800+p*32+c*2)
+			}
+		}
+	case SGB_MASK_EN:
+		s.mask = data[1] & 0x3
+	default:
+		log.Printf("Unsupported SGB command 0x%.2X\n", command)
+	}
+}
+
+// sgbColor reads a little-endian 15-bit color
+func sgbColor(data []uint8, offset int) Color {
+	return Color(binary.LittleEndian.Uint16(data[offset:])) & 0x7FFF
+}
+
+// setPalettes PAL01, PAL23, PAL03 and PAL12, the color 0 is shared by all palettes
+func (s *Sgb) setPalettes(data []uint8, p1, p2 int) {
+	color0 := sgbColor(data, 1)
+	for c := 1; c < 4; c++ {
+		s.palettes[p1][c] = sgbColor(data, 1+c*2)
+		s.palettes[p2][c] = sgbColor(data, 7+c*2)
+	}
+	for p := range s.palettes {
+		s.palettes[p][0] = color0
+	}
+}
+
+// attrBlock ATTR_BLK, palettes inside, on the border and outside of rectangles
+// https://gbdev.io/pandocs/SGB_Command_Attribute.html#sgb-command-04--attr_blk
+func (s *Sgb) attrBlock(data []uint8) {
+
+	// up to 18 sets, no more than the packets sent
+	for set := range min(int(data[1]), 18, (len(data)-2)/6) {
+
+		d := data[2+set*6:]
+		control, palettes := d[0]&0x7, d[1]
+		x1, y1, x2, y2 := int(d[2]), int(d[3]), int(d[4]), int(d[5])
+
+		inside := palettes & 0x3
+		border := (palettes >> 2) & 0x3
+		outside := (palettes >> 4) & 0x3
+
+		// only inside or outside set, the border takes its palette
+		switch control {
+		case 0x1:
+			control, border = 0x3, inside
+		case 0x4:
+			control, border = 0x6, outside
+		}
+
+		for y := range s.attrMap {
+			for x := range s.attrMap[y] {
+				switch {
+				case x > x1 && x < x2 && y > y1 && y < y2:
+					if control&0x1 > 0 {
+						s.attrMap[y][x] = inside
+					}
+				case x >= x1 && x <= x2 && y >= y1 && y <= y2:
+					if control&0x2 > 0 {
+						s.attrMap[y][x] = border
+					}
+				default:
+					if control&0x4 > 0 {
+						s.attrMap[y][x] = outside
+					}
+				}
+			}
+		}
+	}
+}
+
+// attrLine ATTR_LIN, palette of whole lines or columns
+func (s *Sgb) attrLine(data []uint8) {
+	for set := range min(int(data[1]), 110, len(data)-2) {
+		d := data[2+set]
+		line, palette := int(d&0x1F), (d>>5)&0x3
+		for i := range s.attrMap {
+			for j := range s.attrMap[i] {
+				if (d&0x80 > 0 && i == line) || (d&0x80 == 0 && j == line) {
+					s.attrMap[i][j] = palette
+				}
+			}
+		}
+	}
+}
+
+// attrDivide ATTR_DIV, splits the screen in two halves by a line
+func (s *Sgb) attrDivide(data []uint8) {
+	after, on, before := data[1]&0x3, (data[1]>>2)&0x3, (data[1]>>4)&0x3
+	line := int(data[2])
+	for y := range s.attrMap {
+		for x := range s.attrMap[y] {
+			pos := x
+			if data[1]&0x40 > 0 {
+				pos = y
+			}
+			switch {
+			case pos < line:
+				s.attrMap[y][x] = before
+			case pos == line:
+				s.attrMap[y][x] = on
+			default:
+				s.attrMap[y][x] = after
+			}
+		}
+	}
+}
+
+// attrChar ATTR_CHR, palettes of consecutive cells (2 bits each)
+func (s *Sgb) attrChar(data []uint8) {
+	x, y := int(data[1]), int(data[2])
+	count := min(int(binary.LittleEndian.Uint16(data[3:])), len(s.attrMap)*len(s.attrMap[0]))
+	vertical := data[5]&0x1 > 0
+
+	for i := 0; i < count && 6+i/4 < len(data); i++ {
+		if y < len(s.attrMap) && x < len(s.attrMap[0]) {
+			s.attrMap[y][x] = (data[6+i/4] >> (6 - 2*(i%4))) & 0x3
+		}
+
+		if vertical {
+			if y++; y == len(s.attrMap) {
+				y, x = 0, x+1
+			}
+		} else if x++; x == len(s.attrMap[0]) {
+			x, y = 0, y+1
+		}
+	}
+}
+
+// paletteSet PAL_SET, copies system palettes (PAL_TRN) into the palettes 0-3
+func (s *Sgb) paletteSet(data []uint8) {
+	for p := range s.palettes {
+		s.palettes[p] = s.sysPalettes[binary.LittleEndian.Uint16(data[1+p*2:])%SGB_SYSTEM_PALETTES]
+	}
+	for p := range s.palettes {
+		s.palettes[p][0] = s.palettes[0][0]
+	}
+	if data[9]&0x80 > 0 {
+		s.applyAttrFile(data[9] & 0x3F)
+	}
+	if data[9]&0x40 > 0 {
+		s.mask = SGB_MASK_CANCEL
+	}
+}
+
+// applyAttrFile copies an attribute file (ATTR_TRN) into the attribute map
+func (s *Sgb) applyAttrFile(file uint8) {
+	if int(file) >= SGB_ATTR_FILES {
+		return
+	}
+	for i := range len(s.attrMap) * len(s.attrMap[0]) {
+		b := s.attrFiles[file][i/4]
+		s.attrMap[i/len(s.attrMap[0])][i%len(s.attrMap[0])] = (b >> (6 - 2*(i%4))) & 0x3
+	}
+}
+
+// vramTransfer returns the 4KB displayed by the game (*_TRN), the tiles of the first 13
+// BG map rows (20 tiles each) in order
+// https://gbdev.io/pandocs/SGB_VRAM_Transfer.html
+func (s *Sgb) vramTransfer() []uint8 {
+
+	lcdc := s.mem.mem[LCDC_REGISTER]
+	bgMap := Word(VRAM_BACKGROUND_START)
+	if lcdc&0x8 > 0 {
+		bgMap = VRAM_WINDOW_START
+	}
+
+	transfer := make([]uint8, 0, SGB_TRANSFER_SIZE)
+	for t := range SGB_TRANSFER_SIZE / 16 {
+		tileNumber := s.mem.mem[bgMap+Word((t/20)*32+t%20)]
+		address := tileAddress(tileNumber, (lcdc&0x10)>>4)
+		transfer = append(transfer, s.mem.mem[address:address+16]...)
+	}
+	return transfer
+}
+
+// colorize applies the palettes of the attribute map to the LCD shades
+func (s *Sgb) colorize(frame *[SCREEN_HEIGHT][SCREEN_WIDTH]Pixel, colors *[SCREEN_HEIGHT][SCREEN_WIDTH]Color) {
+
+	if s.mask == SGB_MASK_FREEZE {
+		return
+	}
+
+	for y := range frame {
+		for x := range frame[y] {
+			shade := frame[y][x]
+			if shade > 3 {
+				shade = 0
+			}
+
+			switch s.mask {
+			case SGB_MASK_BLACK:
+				colors[y][x] = 0
+			case SGB_MASK_COLOR0:
+				colors[y][x] = s.palettes[0][0]
+			default:
+				colors[y][x] = s.palettes[s.attrMap[y/8][x/8]][shade]
+			}
+		}
+	}
+}
+
+// frame composes the border (PCT_TRN/CHR_TRN) and the colorized LCD
+func (s *Sgb) frame(colors *[SCREEN_HEIGHT][SCREEN_WIDTH]Color) *[SGB_SCREEN_HEIGHT][SGB_SCREEN_WIDTH]Color {
+
+	for y := range s.screen {
+		for x := range s.screen[y] {
+
+			entry := s.borderMap[(y/8)*32+x/8]
+			tile := s.borderTiles[entry&0xFF]
+
+			row, col := y%8, x%8
+			if entry&0x8000 > 0 {
+				row = 7 - row
+			}
+			if entry&0x4000 > 0 {
+				col = 7 - col
+			}
+
+			// 4 bit planes, 0-1 interleaved in the first 16 bytes and 2-3 in the last 16
+			bit := 7 - col
+			index := (tile[row*2]>>bit)&0x1 | ((tile[row*2+1]>>bit)&0x1)<<1 |
+				((tile[16+row*2]>>bit)&0x1)<<2 | ((tile[16+row*2+1]>>bit)&0x1)<<3
+
+			// color 0 is transparent, showing the backdrop
+			if index == 0 {
+				s.screen[y][x] = s.palettes[0][0]
+			} else {
+				s.screen[y][x] = s.borderPalettes[((entry>>10)&0x7)%4][index]
+			}
+		}
+	}
+
+	for y := range colors {
+		copy(s.screen[SGB_LCD_Y+y][SGB_LCD_X:], colors[y][:])
+	}
+
+	return &s.screen
+}
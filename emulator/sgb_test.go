@@ -0,0 +1,185 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSGB returns a SGB powered up with a SGB cartridge
+func newSGB(t *testing.T) *GameBoy {
+	rom := make([]uint8, 0x8000)
+	rom[CARTRIDGE_HEADER_SGB_FLAG] = 0x03
+	rom[CARTRIDGE_HEADER_OLD_LICENSEE] = 0x33
+
+	g := NewGameBoy(Config{Silent: true, Model: SGB})
+	assert.NoError(t, g.LoadROM(rom))
+	assert.NoError(t, g.init())
+	return g
+}
+
+// sendPacket pulses the joypad port like the games do, one packet per 16 bytes
+func sendPacket(g *GameBoy, data ...uint8) {
+	for len(data)%SGB_PACKET_SIZE != 0 {
+		data = append(data, 0)
+	}
+	for p := 0; p < len(data); p += SGB_PACKET_SIZE {
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x00)
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x30)
+		for _, b := range data[p : p+SGB_PACKET_SIZE] {
+			for bit := range 8 {
+				if b&(1<<bit) > 0 {
+					g.WriteMemory(uint16(PORT_JOYPAD), 0x10)
+				} else {
+					g.WriteMemory(uint16(PORT_JOYPAD), 0x20)
+				}
+				g.WriteMemory(uint16(PORT_JOYPAD), 0x30)
+			}
+		}
+		// stop bit
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x20)
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x30)
+	}
+}
+
+func TestSGB(t *testing.T) {
+
+	t.Run("pal01", func(t *testing.T) {
+		g := newSGB(t)
+		sendPacket(g, SGB_PAL01<<3|1,
+			0x1F, 0x00, // color 0
+			0x01, 0x00, 0x02, 0x00, 0x03, 0x00, // palette 0
+			0x04, 0x00, 0x05, 0x00, 0x06, 0x00, // palette 1
+		)
+		s := g.c.memory.sgb
+		assert.Equal(t, [4]Color{0x1F, 0x1, 0x2, 0x3}, s.palettes[0])
+		assert.Equal(t, [4]Color{0x1F, 0x4, 0x5, 0x6}, s.palettes[1])
+		assert.Equal(t, Color(0x1F), s.palettes[3][0])
+	})
+
+	t.Run("unsupported cartridge", func(t *testing.T) {
+		g := NewGameBoy(Config{Silent: true, Model: SGB})
+		assert.NoError(t, g.LoadROM(make([]uint8, 0x8000)))
+		assert.NoError(t, g.init())
+		sendPacket(g, SGB_MASK_EN<<3|1, SGB_MASK_BLACK)
+		assert.Equal(t, uint8(SGB_MASK_CANCEL), g.c.memory.sgb.mask)
+	})
+
+	t.Run("attr blk", func(t *testing.T) {
+		g := newSGB(t)
+		// inside palette 1, border palette 2, outside palette 3
+		sendPacket(g, SGB_ATTR_BLK<<3|1, 1, 0x7, 0x3<<4|0x2<<2|0x1, 2, 2, 5, 5)
+		s := g.c.memory.sgb
+		assert.Equal(t, uint8(1), s.attrMap[3][3])
+		assert.Equal(t, uint8(2), s.attrMap[2][4])
+		assert.Equal(t, uint8(2), s.attrMap[5][5])
+		assert.Equal(t, uint8(3), s.attrMap[0][0])
+		assert.Equal(t, uint8(3), s.attrMap[17][19])
+	})
+
+	t.Run("attr lin and div", func(t *testing.T) {
+		g := newSGB(t)
+		sendPacket(g, SGB_ATTR_DIV<<3|1, 0x40|0x1<<4|0x2<<2|0x3, 9)
+		s := g.c.memory.sgb
+		assert.Equal(t, uint8(1), s.attrMap[0][0])
+		assert.Equal(t, uint8(2), s.attrMap[9][0])
+		assert.Equal(t, uint8(3), s.attrMap[17][0])
+
+		// vertical line 4 palette 2, horizontal line 0 palette 3
+		sendPacket(g, SGB_ATTR_LIN<<3|1, 2, 0x2<<5|4, 0x80|0x3<<5|0)
+		assert.Equal(t, uint8(2), s.attrMap[10][4])
+		assert.Equal(t, uint8(3), s.attrMap[0][4])
+	})
+
+	t.Run("attr truncated", func(t *testing.T) {
+		g := newSGB(t)
+		s := g.c.memory.sgb
+
+		// a single packet with more sets than it holds, the sets sent are applied
+		sendPacket(g, SGB_ATTR_BLK<<3|1, 18, 0x1, 0x1, 0, 0, 19, 17)
+		assert.Equal(t, uint8(1), s.attrMap[5][5])
+		sendPacket(g, SGB_ATTR_LIN<<3|1, 110, 0x80|0x2<<5|3)
+		assert.Equal(t, uint8(2), s.attrMap[3][10])
+	})
+
+	t.Run("attr chr", func(t *testing.T) {
+		g := newSGB(t)
+		// from 18,0 left to right, wraps to the next row
+		sendPacket(g, SGB_ATTR_CHR<<3|1, 18, 0, 4, 0, 0, 0x1B)
+		s := g.c.memory.sgb
+		assert.Equal(t, uint8(0), s.attrMap[0][18])
+		assert.Equal(t, uint8(1), s.attrMap[0][19])
+		assert.Equal(t, uint8(2), s.attrMap[1][0])
+		assert.Equal(t, uint8(3), s.attrMap[1][1])
+	})
+
+	t.Run("pal trn and pal set", func(t *testing.T) {
+		g := newSGB(t)
+		fillTransfer(g, func(i int) uint8 { return uint8(i / 8) })
+		sendPacket(g, SGB_PAL_TRN<<3|1)
+		s := g.c.memory.sgb
+		assert.Equal(t, Color(0x0101), s.sysPalettes[1][2])
+
+		// attribute file 1, every cell palette 3
+		for i := range SGB_ATTR_FILE_SIZE {
+			s.attrFiles[1][i] = 0xFF
+		}
+		sendPacket(g, SGB_PAL_SET<<3|1, 2, 0, 3, 0, 4, 0, 5, 0, 0x80|0x1)
+		assert.Equal(t, Color(0x0505), s.palettes[3][1])
+		assert.Equal(t, Color(0x0202), s.palettes[3][0])
+		assert.Equal(t, uint8(3), s.attrMap[17][19])
+	})
+
+	t.Run("mlt req", func(t *testing.T) {
+		g := newSGB(t)
+		sendPacket(g, SGB_MLT_REQ<<3|1, 0x1)
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x30)
+		assert.Equal(t, uint8(0xFF), g.ReadMemory(uint16(PORT_JOYPAD)))
+
+		// next joypad on P15 rising edge
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x10)
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x30)
+		assert.Equal(t, uint8(0xFE), g.ReadMemory(uint16(PORT_JOYPAD)))
+
+		// only player 1 has buttons
+		g.c.memory.joypad = 0xEF
+		g.WriteMemory(uint16(PORT_JOYPAD), 0x10)
+		assert.Equal(t, uint8(0xDF), g.ReadMemory(uint16(PORT_JOYPAD)))
+	})
+
+	t.Run("border", func(t *testing.T) {
+		g := newSGB(t)
+
+		// tile 0 color 1 (plane 0) on the top left pixel
+		fillTransfer(g, func(i int) uint8 { return 0 })
+		g.c.memory.mem[0x8000] = 0x80
+		sendPacket(g, SGB_CHR_TRN<<3|1, 0)
+
+		// map entry 0 tile 0 palette 5, color 1 red
+		fillTransfer(g, func(i int) uint8 { return 0 })
+		g.c.memory.mem[0x8000] = 0x00
+		g.c.memory.mem[0x8001] = 0x5 << 2
+		g.c.memory.mem[0x8000+0x800+32+2] = 0x1F
+		sendPacket(g, SGB_PCT_TRN<<3|1)
+
+		sendPacket(g, SGB_PAL01<<3|1, 0xE0, 0x03)
+		g.video.videoMemory[0][0] = 0
+		g.video.draw()
+
+		frame := g.SGBFramebuffer()
+		assert.Equal(t, Color(0x1F), frame[0][0])
+		assert.Equal(t, Color(0x03E0), frame[0][1])
+		assert.Equal(t, Color(0x03E0), frame[SGB_LCD_Y][SGB_LCD_X])
+	})
+}
+
+// fillTransfer fills the tiles displayed by the BG map (VRAM transfer source)
+func fillTransfer(g *GameBoy, value func(i int) uint8) {
+	g.c.memory.mem[LCDC_REGISTER] = 0x91
+	for t := range 256 {
+		g.c.memory.mem[VRAM_BACKGROUND_START+(t/20)*32+t%20] = uint8(t)
+	}
+	for i := range SGB_TRANSFER_SIZE {
+		g.c.memory.mem[0x8000+i] = value(i)
+	}
+}
@@ -2,9 +2,6 @@ package emulator
 
 import (
 	"log"
-	"time"
-
-	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 const (
@@ -59,8 +56,8 @@ var noiseChannelDivisorTable = map[uint8]uint8{
 }
 
 type Sound struct {
-	stream rl.AudioStream
-	mem    memoryArea
+	sink AudioSink
+	mem  memoryArea
 
 	soundPowerOn bool
 
@@ -116,8 +113,9 @@ type Sound struct {
 	channels int
 }
 
-func NewSound(mem memoryArea, channels int) *Sound {
+func NewSound(mem memoryArea, channels int, sink AudioSink) *Sound {
 	return &Sound{
+		sink:     sink,
 		mem:      mem,
 		channels: channels,
 	}
@@ -132,10 +130,11 @@ const (
 
 func (s *Sound) init() error {
 
-	rl.InitAudioDevice()
-	rl.SetAudioStreamBufferSizeDefault(bufferSize)
-	s.stream = rl.LoadAudioStream(sampleRate, 32, 1)
-	rl.PlayAudioStream(s.stream)
+	return s.sink.Init(sampleRate, bufferSize)
+}
+
+// enableChannels enables the channels selected by the channels mask (bit 0 = CH1 ... bit 3 = CH4)
+func (s *Sound) enableChannels() {
 
 	if s.channels&0x1 > 0 {
 		log.Printf("ENABLING CHANNEL 1\n")
@@ -156,8 +155,6 @@ func (s *Sound) init() error {
 		log.Printf("ENABLING CHANNEL 4\n")
 		s.useSCH4 = true
 	}
-
-	return nil
 }
 
 /*
@@ -895,8 +892,7 @@ func (s *Sound) resetSCH4() {
  */
 
 func (s *Sound) stop() {
-	rl.UnloadAudioStream(s.stream)
-	rl.CloseAudioDevice()
+	s.sink.Close()
 }
 
 func (s *Sound) sync(tCycle int) {
@@ -1003,11 +999,9 @@ func (s *Sound) sync(tCycle int) {
 			mixbuf[i] = f
 		}
 
-		for !rl.IsAudioStreamProcessed(s.stream) {
-			time.Sleep(10 * time.Millisecond)
-		}
+		// enqueue on the audio device (may block until there is room)
+		s.sink.Play(mixbuf)
 
-		rl.UpdateAudioStream(s.stream, mixbuf)
 		s.sCH1Buf = s.sCH1Buf[:0]
 		s.sCH2Buf = s.sCH2Buf[:0]
 		s.sCH3Buf = s.sCH3Buf[:0]
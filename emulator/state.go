@@ -0,0 +1,561 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// save state file header, followed by the format version and the gob encoded machine state
+	STATE_MAGIC = "SHINYCART-STATE"
+
+	// bump whenever a field is added/removed from the state structs below
+	STATE_VERSION = uint32(5)
+
+	// number of save state slots (F1-F9)
+	STATE_SLOTS = 9
+)
+
+type cpuState struct {
+	PC              Word
+	SP              Word
+	PreviousPC      Word
+	Reg             Registers
+	IME             uint8
+	EnableEI        bool
+	RemainingCycles int
+	Opcode          uint8
+	RequiredCycles  int
+	SerialBits      int
+	SerialClock     int
+	ScheduledOAMDma int
+	OamDmaSource    int
+	HaltBug         bool
+	Halted          bool
+}
+
+type memoryState struct {
+	Mem        []uint8
+	Joypad     uint8
+	DMA        bool
+	ResetTimer bool
+	BootROM    []uint8 // nil once disabled (FF50)
+
+	// CGB mode
+	CGB             bool
+	VRAM1           []uint8
+	WRAM            []uint8
+	BgPalette       [PALETTE_RAM_SIZE]uint8
+	ObjPalette      [PALETTE_RAM_SIZE]uint8
+	HdmaSource      Word
+	HdmaDestination Word
+	HdmaBlocks      int
+	HdmaActive      bool
+}
+
+// mbcState holds the bank registers and RAM of any memory controller, each
+// controller only uses the fields it needs
+type mbcState struct {
+	RamEnabled  bool
+	RomSelected uint16
+	RamSelected uint8
+	Mode        uint8
+	RAM         []uint8
+
+	// MBC3 RTC
+	RtcSelected       uint8
+	RtcRegisters      map[uint8]uint8
+	RtcRegistersLatch map[uint8]uint8
+	Latch             uint8
+	Remaining         int
+	Halted            bool
+}
+
+type videoState struct {
+	Scanline       int
+	Scancolumn     int
+	Mode           uint8
+	Buffer         [][4]uint8 // y, x, tile, flags
+	Tick           int
+	Delay          int
+	NextMode       uint8
+	Disabled       bool
+	LastComparison bool
+	CurrentOamAddr Word
+	VideoMemory    [144][160]Pixel
+	ColorMemory    [144][160]Color
+}
+
+type timerState struct {
+	Overflow      bool
+	Counter       uint16
+	LastCycle     uint8
+	OverflowDelay int
+}
+
+type soundState struct {
+	SoundPowerOn bool
+	DivLastValue uint8
+
+	TimerSCH1          uint16
+	DutyPositionSCH1   uint8
+	FrameSeqStepSCH1   int
+	LengthCounterSCH1  int
+	DisableSCH1        bool
+	VolumeSCH1         int
+	VolumeTimerSCH1    int
+	SweepTimerSCH1     int
+	SweepEnableSCH1    bool
+	SweepShadowRegSCH1 uint16
+
+	TimerSCH2         uint16
+	DutyPositionSCH2  uint8
+	FrameSeqStepSCH2  int
+	LengthCounterSCH2 int
+	DisableSCH2       bool
+	VolumeSCH2        int
+	VolumeTimerSCH2   int
+
+	LengthCounterSCH3 int
+	TimerSCH3         uint16
+	WavePositionSCH3  uint8
+	FrameSeqStepSCH3  int
+	DisableSCH3       bool
+
+	LengthCounterSCH4 int
+	TimerSCH4         uint16
+	FrameSeqStepSCH4  int
+	DisableSCH4       bool
+	VolumeSCH4        int
+	VolumeTimerSCH4   int
+	LsfrSCH4          uint16
+}
+
+// sgbState SGB models only
+type sgbState struct {
+	Enabled        bool
+	Receiving      bool
+	Released       bool
+	Bits           int
+	Packet         [SGB_PACKET_SIZE]uint8
+	Command        []uint8
+	Players        int
+	Player         uint8
+	Joypad         uint8
+	Palettes       [4][4]Color
+	SysPalettes    [SGB_SYSTEM_PALETTES][4]Color
+	AttrFiles      [SGB_ATTR_FILES][SGB_ATTR_FILE_SIZE]uint8
+	AttrMap        [18][20]uint8
+	Mask           uint8
+	BorderTiles    [256][32]uint8
+	BorderMap      [32 * 28]uint16
+	BorderPalettes [4][16]Color
+}
+
+type gameBoyState struct {
+	// cartridge title and global checksum, used to refuse states from other ROMs
+	Cartridge []uint8
+
+	Cpu    cpuState
+	Memory memoryState
+	Mbc    *mbcState
+	Sgb    *sgbState
+	Video  videoState
+	Timer  timerState
+	Sound  soundState
+}
+
+// stateFile returns the save state file location for a ROM file and slot (game.gb -> game.ss1)
+func stateFile(romFile string, slot int) string {
+	return fmt.Sprintf("%s.ss%d", strings.TrimSuffix(romFile, filepath.Ext(romFile)), slot)
+}
+
+// cartridge identification
+// https://gbdev.io/pandocs/The_Cartridge_Header.html#0134-0143--title
+func (g *GameBoy) cartridge() []uint8 {
+	return bytes.Clone(g.c.memory.mem[0x0134:0x0150])
+}
+
+// SaveState writes a snapshot of the whole machine
+func (g *GameBoy) SaveState(w io.Writer) error {
+
+	if _, err := io.WriteString(w, STATE_MAGIC); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, STATE_VERSION); err != nil {
+		return err
+	}
+
+	state := gameBoyState{
+		Cartridge: g.cartridge(),
+		Cpu:       g.c.saveState(),
+		Memory:    g.c.memory.saveState(),
+		Video:     g.video.saveState(),
+		Timer:     g.timer.saveState(),
+		Sound:     g.sound.saveState(),
+	}
+
+	if g.c.memory.mbc.initialized() {
+		mbc := g.c.memory.mbc.controller.saveState()
+		state.Mbc = &mbc
+	}
+
+	if g.c.memory.sgb != nil {
+		sgb := g.c.memory.sgb.saveState()
+		state.Sgb = &sgb
+	}
+
+	return gob.NewEncoder(w).Encode(&state)
+}
+
+// LoadState restores a snapshot written by SaveState
+func (g *GameBoy) LoadState(r io.Reader) error {
+
+	magic := make([]byte, len(STATE_MAGIC))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+
+	if string(magic) != STATE_MAGIC {
+		return fmt.Errorf("not a save state file")
+	}
+
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return err
+	}
+
+	if version != STATE_VERSION {
+		return fmt.Errorf("unsupported save state version %d (expected %d)", version, STATE_VERSION)
+	}
+
+	var state gameBoyState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(state.Cartridge, g.cartridge()) {
+		return fmt.Errorf("save state belongs to another cartridge")
+	}
+
+	if len(state.Memory.Mem) != len(g.c.memory.mem) {
+		return fmt.Errorf("invalid memory size %d", len(state.Memory.Mem))
+	}
+
+	if (state.Mbc != nil) != g.c.memory.mbc.initialized() {
+		return fmt.Errorf("memory controller mismatch")
+	}
+
+	if (state.Sgb != nil) != (g.c.memory.sgb != nil) {
+		return fmt.Errorf("hardware model mismatch")
+	}
+
+	g.c.loadState(state.Cpu)
+	g.c.memory.loadState(state.Memory)
+	if state.Mbc != nil {
+		g.c.memory.mbc.controller.loadState(*state.Mbc)
+	}
+	if state.Sgb != nil {
+		g.c.memory.sgb.loadState(*state.Sgb)
+	}
+	g.video.loadState(state.Video)
+	g.timer.loadState(state.Timer)
+	g.sound.loadState(state.Sound)
+
+	return nil
+}
+
+func (g *GameBoy) saveStateSlot(slot int) error {
+	var buf bytes.Buffer
+	if err := g.SaveState(&buf); err != nil {
+		return err
+	}
+
+	file := stateFile(g.romFile, slot)
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Saved state to %s\n", file)
+	return nil
+}
+
+func (g *GameBoy) loadStateSlot(slot int) error {
+	file := stateFile(g.romFile, slot)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := g.LoadState(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded state from %s\n", file)
+	return nil
+}
+
+func (c *Cpu) saveState() cpuState {
+	return cpuState{
+		PC:              c.pc,
+		SP:              c.sp,
+		PreviousPC:      c.previousPC,
+		Reg:             c.reg,
+		IME:             c.ime,
+		EnableEI:        c.enableEI,
+		RemainingCycles: c.remainingCycles,
+		Opcode:          c.opcode,
+		RequiredCycles:  c.requiredCycles,
+		SerialBits:      c.serial.bits,
+		SerialClock:     c.serial.clock,
+		ScheduledOAMDma: c.scheduledOAMDma,
+		OamDmaSource:    c.oamDmaSource,
+		HaltBug:         c.haltBug,
+		Halted:          c.halted,
+	}
+}
+
+func (c *Cpu) loadState(s cpuState) {
+	c.pc = s.PC
+	c.sp = s.SP
+	c.previousPC = s.PreviousPC
+	c.reg = s.Reg
+	c.ime = s.IME
+	c.enableEI = s.EnableEI
+	c.remainingCycles = s.RemainingCycles
+	c.opcode = s.Opcode
+	c.requiredCycles = s.RequiredCycles
+	c.serial.bits = s.SerialBits
+	c.serial.clock = s.SerialClock
+	c.scheduledOAMDma = s.ScheduledOAMDma
+	c.oamDmaSource = s.OamDmaSource
+	c.haltBug = s.HaltBug
+	c.halted = s.Halted
+}
+
+func (m *Memory) saveState() memoryState {
+	return memoryState{
+		Mem:        bytes.Clone(m.mem),
+		Joypad:     m.joypad,
+		DMA:        m.dma,
+		ResetTimer: m.resetTimer,
+		BootROM:    bytes.Clone(m.bootROM),
+
+		CGB:             m.cgb,
+		VRAM1:           bytes.Clone(m.vram1),
+		WRAM:            bytes.Clone(m.wram),
+		BgPalette:       m.bgPalette,
+		ObjPalette:      m.objPalette,
+		HdmaSource:      m.hdma.source,
+		HdmaDestination: m.hdma.destination,
+		HdmaBlocks:      m.hdma.blocks,
+		HdmaActive:      m.hdma.active,
+	}
+}
+
+func (m *Memory) loadState(s memoryState) {
+	// the memory area is shared with the sound component, copy instead of replacing it
+	copy(m.mem, s.Mem)
+	m.joypad = s.Joypad
+	m.dma = s.DMA
+	m.resetTimer = s.ResetTimer
+	m.bootROM = s.BootROM
+
+	m.cgb = s.CGB
+	copy(m.vram1, s.VRAM1)
+	copy(m.wram, s.WRAM)
+	m.bgPalette = s.BgPalette
+	m.objPalette = s.ObjPalette
+	m.hdma = hdma{source: s.HdmaSource, destination: s.HdmaDestination, blocks: s.HdmaBlocks, active: s.HdmaActive}
+}
+
+func (s *Sgb) saveState() sgbState {
+	return sgbState{
+		Enabled:        s.enabled,
+		Receiving:      s.receiving,
+		Released:       s.released,
+		Bits:           s.bits,
+		Packet:         s.packet,
+		Command:        bytes.Clone(s.command),
+		Players:        s.players,
+		Player:         s.player,
+		Joypad:         s.joypad,
+		Palettes:       s.palettes,
+		SysPalettes:    s.sysPalettes,
+		AttrFiles:      s.attrFiles,
+		AttrMap:        s.attrMap,
+		Mask:           s.mask,
+		BorderTiles:    s.borderTiles,
+		BorderMap:      s.borderMap,
+		BorderPalettes: s.borderPalettes,
+	}
+}
+
+func (s *Sgb) loadState(st sgbState) {
+	s.enabled = st.Enabled
+	s.receiving = st.Receiving
+	s.released = st.Released
+	s.bits = st.Bits
+	s.packet = st.Packet
+	s.command = st.Command
+	s.players = st.Players
+	s.player = st.Player
+	s.joypad = st.Joypad
+	s.palettes = st.Palettes
+	s.sysPalettes = st.SysPalettes
+	s.attrFiles = st.AttrFiles
+	s.attrMap = st.AttrMap
+	s.mask = st.Mask
+	s.borderTiles = st.BorderTiles
+	s.borderMap = st.BorderMap
+	s.borderPalettes = st.BorderPalettes
+}
+
+func (v *Video) saveState() videoState {
+	buffer := make([][4]uint8, 0, len(v.buffer))
+	for _, s := range v.buffer {
+		buffer = append(buffer, [4]uint8{s.yPos, s.xPos, s.tile, s.flags})
+	}
+
+	return videoState{
+		Scanline:       v.scanline,
+		Scancolumn:     v.scancolumn,
+		Mode:           v.mode,
+		Buffer:         buffer,
+		Tick:           v.tick,
+		Delay:          v.delay,
+		NextMode:       v.nextMode,
+		Disabled:       v.disabled,
+		LastComparison: v.lastComparison,
+		CurrentOamAddr: v.currentOamAddr,
+		VideoMemory:    v.videoMemory,
+		ColorMemory:    v.colorMemory,
+	}
+}
+
+func (v *Video) loadState(s videoState) {
+	v.buffer = make([]Sprite, 0, len(s.Buffer))
+	for _, b := range s.Buffer {
+		v.buffer = append(v.buffer, Sprite{yPos: b[0], xPos: b[1], tile: b[2], flags: b[3]})
+	}
+
+	v.scanline = s.Scanline
+	v.scancolumn = s.Scancolumn
+	v.mode = s.Mode
+	v.tick = s.Tick
+	v.delay = s.Delay
+	v.nextMode = s.NextMode
+	v.disabled = s.Disabled
+	v.lastComparison = s.LastComparison
+	v.currentOamAddr = s.CurrentOamAddr
+	v.videoMemory = s.VideoMemory
+	v.colorMemory = s.ColorMemory
+}
+
+func (t *Timer) saveState() timerState {
+	return timerState{
+		Overflow:      t.overflow,
+		Counter:       t.counter,
+		LastCycle:     t.lastCycle,
+		OverflowDelay: t.overflowDelay,
+	}
+}
+
+func (t *Timer) loadState(s timerState) {
+	t.overflow = s.Overflow
+	t.counter = s.Counter
+	t.lastCycle = s.LastCycle
+	t.overflowDelay = s.OverflowDelay
+}
+
+func (s *Sound) saveState() soundState {
+	return soundState{
+		SoundPowerOn: s.soundPowerOn,
+		DivLastValue: s.divLastValue,
+
+		TimerSCH1:          s.timerSCH1,
+		DutyPositionSCH1:   s.dutyPositionSCH1,
+		FrameSeqStepSCH1:   s.frameSeqStepSCH1,
+		LengthCounterSCH1:  s.lengthCounterSCH1,
+		DisableSCH1:        s.disableSCH1,
+		VolumeSCH1:         s.volumeSCH1,
+		VolumeTimerSCH1:    s.volumeTimerSCH1,
+		SweepTimerSCH1:     s.sweepTimerSCH1,
+		SweepEnableSCH1:    s.sweepEnableSCH1,
+		SweepShadowRegSCH1: s.sweepShadowRegSCH1,
+
+		TimerSCH2:         s.timerSCH2,
+		DutyPositionSCH2:  s.dutyPositionSCH2,
+		FrameSeqStepSCH2:  s.frameSeqStepSCH2,
+		LengthCounterSCH2: s.lengthCounterSCH2,
+		DisableSCH2:       s.disableSCH2,
+		VolumeSCH2:        s.volumeSCH2,
+		VolumeTimerSCH2:   s.volumeTimerSCH2,
+
+		LengthCounterSCH3: s.lengthCounterSCH3,
+		TimerSCH3:         s.timerSCH3,
+		WavePositionSCH3:  s.wavePositionSCH3,
+		FrameSeqStepSCH3:  s.frameSeqStepSCH3,
+		DisableSCH3:       s.disableSCH3,
+
+		LengthCounterSCH4: s.lengthCounterSCH4,
+		TimerSCH4:         s.timerSCH4,
+		FrameSeqStepSCH4:  s.frameSeqStepSCH4,
+		DisableSCH4:       s.disableSCH4,
+		VolumeSCH4:        s.volumeSCH4,
+		VolumeTimerSCH4:   s.volumeTimerSCH4,
+		LsfrSCH4:          s.lsfrSCH4,
+	}
+}
+
+func (s *Sound) loadState(st soundState) {
+	s.soundPowerOn = st.SoundPowerOn
+	s.divLastValue = st.DivLastValue
+
+	s.timerSCH1 = st.TimerSCH1
+	s.dutyPositionSCH1 = st.DutyPositionSCH1
+	s.frameSeqStepSCH1 = st.FrameSeqStepSCH1
+	s.lengthCounterSCH1 = st.LengthCounterSCH1
+	s.disableSCH1 = st.DisableSCH1
+	s.volumeSCH1 = st.VolumeSCH1
+	s.volumeTimerSCH1 = st.VolumeTimerSCH1
+	s.sweepTimerSCH1 = st.SweepTimerSCH1
+	s.sweepEnableSCH1 = st.SweepEnableSCH1
+	s.sweepShadowRegSCH1 = st.SweepShadowRegSCH1
+
+	s.timerSCH2 = st.TimerSCH2
+	s.dutyPositionSCH2 = st.DutyPositionSCH2
+	s.frameSeqStepSCH2 = st.FrameSeqStepSCH2
+	s.lengthCounterSCH2 = st.LengthCounterSCH2
+	s.disableSCH2 = st.DisableSCH2
+	s.volumeSCH2 = st.VolumeSCH2
+	s.volumeTimerSCH2 = st.VolumeTimerSCH2
+
+	s.lengthCounterSCH3 = st.LengthCounterSCH3
+	s.timerSCH3 = st.TimerSCH3
+	s.wavePositionSCH3 = st.WavePositionSCH3
+	s.frameSeqStepSCH3 = st.FrameSeqStepSCH3
+	s.disableSCH3 = st.DisableSCH3
+
+	s.lengthCounterSCH4 = st.LengthCounterSCH4
+	s.timerSCH4 = st.TimerSCH4
+	s.frameSeqStepSCH4 = st.FrameSeqStepSCH4
+	s.disableSCH4 = st.DisableSCH4
+	s.volumeSCH4 = st.VolumeSCH4
+	s.volumeTimerSCH4 = st.VolumeTimerSCH4
+	s.lsfrSCH4 = st.LsfrSCH4
+
+	// drop pending (not yet mixed) samples
+	s.sCH1Buf = s.sCH1Buf[:0]
+	s.sCH2Buf = s.sCH2Buf[:0]
+	s.sCH3Buf = s.sCH3Buf[:0]
+	s.sCH4Buf = s.sCH4Buf[:0]
+}
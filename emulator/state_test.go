@@ -0,0 +1,83 @@
+package emulator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStateGameBoy() *GameBoy {
+	g := NewGameBoy(Config{Silent: true})
+	copy(g.c.memory.mem[0x0134:], "SHINYCART")
+	g.c.memory.mbc.controller = &mbc1{ramSupport: true, romSelected: 0x1}
+	g.c.memory.mbc.mem = g.c.memory.mem
+	return g
+}
+
+func TestState(t *testing.T) {
+
+	t.Run("round trip", func(t *testing.T) {
+		g := newStateGameBoy()
+		g.c.pc = 0x150
+		g.c.sp = 0xFFF0
+		g.c.reg.w16(reg_hl, 0xBEEF)
+		g.c.halted = true
+		g.c.memory.mem[0xC000] = 0x42
+		g.c.memory.mbc.controller.Write(g.c.memory.mem, 0x0000, 0xA)
+		g.c.memory.mbc.controller.Write(g.c.memory.mem, 0xA000, 0x24)
+		g.video.scanline = 100
+		g.video.buffer = []Sprite{{yPos: 1, xPos: 2, tile: 3, flags: 4}}
+		g.video.videoMemory[10][20] = 3
+		g.timer.counter = 0x1234
+		g.sound.volumeSCH2 = 7
+
+		var buf bytes.Buffer
+		assert.NoError(t, g.SaveState(&buf))
+
+		r := newStateGameBoy()
+		assert.NoError(t, r.LoadState(&buf))
+		assert.Equal(t, Word(0x150), r.c.pc)
+		assert.Equal(t, Word(0xFFF0), r.c.sp)
+		assert.Equal(t, Word(0xBEEF), r.c.reg.r16(reg_hl))
+		assert.True(t, r.c.halted)
+		assert.Equal(t, uint8(0x42), r.c.memory.mem[0xC000])
+		assert.Equal(t, uint8(0x24), r.c.memory.mbc.controller.Read(r.c.memory.mem, 0xA000))
+		assert.Equal(t, 100, r.video.scanline)
+		assert.Equal(t, []Sprite{{yPos: 1, xPos: 2, tile: 3, flags: 4}}, r.video.buffer)
+		assert.Equal(t, Pixel(3), r.video.videoMemory[10][20])
+		assert.Equal(t, uint16(0x1234), r.timer.counter)
+		assert.Equal(t, 7, r.sound.volumeSCH2)
+
+		// memory is still shared with the sound component
+		assert.Equal(t, &r.c.memory.mem[0], &r.sound.mem[0])
+	})
+
+	t.Run("another cartridge", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newStateGameBoy().SaveState(&buf))
+
+		r := newStateGameBoy()
+		copy(r.c.memory.mem[0x0134:], "OTHERCART")
+		assert.ErrorContains(t, r.LoadState(&buf), "another cartridge")
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		r := newStateGameBoy()
+		assert.Error(t, r.LoadState(bytes.NewBufferString("NOT A STATE FILE AT ALL")))
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newStateGameBoy().SaveState(&buf))
+		data := buf.Bytes()
+		data[len(STATE_MAGIC)] = 0xFF
+
+		r := newStateGameBoy()
+		assert.ErrorContains(t, r.LoadState(bytes.NewReader(data)), "unsupported save state version")
+	})
+
+	t.Run("slot file name", func(t *testing.T) {
+		assert.Equal(t, "roms/game.ss3", stateFile("roms/game.gb", 3))
+	})
+}
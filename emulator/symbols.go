@@ -0,0 +1,147 @@
+package emulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols labels of a symbol file, used by the debugger to name the addresses
+// https://rgbds.gbdev.io/sym/
+type Symbols struct {
+	labels []symbol // sorted by address
+	names  map[string]symbol
+}
+
+type symbol struct {
+	name    string
+	bank    int
+	address Word
+}
+
+// symbolFile returns the symbol file location for a ROM file (game.gb -> game.sym)
+func symbolFile(romFile string) string {
+	return strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".sym"
+}
+
+// ParseSymbols reads a symbol file, one "bank:address label" per line (e.g. 01:4000 Main.loop).
+// The WLA-DX files used by some test ROMs are accepted too, only their labels are read
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+
+	s := &Symbols{names: make(map[string]symbol)}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), ";")
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(line)
+			continue
+		}
+		if line == "" || section != "" && section != "[labels]" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		b, a, ok := strings.Cut(fields[0], ":")
+		if len(fields) != 2 || !ok {
+			return nil, fmt.Errorf("invalid symbol at line %d : %q", n, line)
+		}
+		bank, err1 := strconv.ParseUint(b, 16, 16)
+		address, err2 := strconv.ParseUint(a, 16, 16)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid symbol at line %d : %q", n, line)
+		}
+
+		sym := symbol{name: fields[1], bank: int(bank), address: Word(address)}
+		s.labels = append(s.labels, sym)
+		if _, ok := s.names[sym.name]; !ok {
+			s.names[sym.name] = sym
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(s.labels, func(i, j int) bool { return s.labels[i].address < s.labels[j].address })
+	return s, nil
+}
+
+// loadSymbols loads the symbol file, if any
+func loadSymbols(file string) (*Symbols, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymbols(f)
+}
+
+// lookup finds a label by name, its bank is only kept on the banked areas (ROM and external RAM)
+func (s *Symbols) lookup(name string) (int, Word, bool) {
+	if s == nil {
+		return 0, 0, false
+	}
+	sym, ok := s.names[name]
+	if !ok {
+		return 0, 0, false
+	}
+	if !bankedArea(sym.address) {
+		return -1, sym.address, true
+	}
+	return sym.bank, sym.address, true
+}
+
+// Label names an address as the closest label before it in the same memory area (e.g.
+// Main+$2), the first one listed on aliases, empty if there's none. The bank is only checked
+// on the banked areas (ROM and external RAM)
+func (s *Symbols) Label(bank int, addr uint16) string {
+	if s == nil {
+		return ""
+	}
+	address := Word(addr)
+
+	i := sort.Search(len(s.labels), func(i int) bool { return s.labels[i].address > address })
+	for i--; i >= 0 && symbolArea(s.labels[i].address) == symbolArea(address); i-- {
+		sym := s.labels[i]
+		if bankedArea(address) && sym.bank != bank {
+			continue
+		}
+		for i > 0 && s.labels[i-1].address == sym.address && s.labels[i-1].bank == sym.bank {
+			i--
+			sym = s.labels[i]
+		}
+		if sym.address == address {
+			return sym.name
+		}
+		return fmt.Sprintf("%s+$%X", sym.name, address-sym.address)
+	}
+	return ""
+}
+
+func bankedArea(address Word) bool {
+	return romBankNN(address) || externalRAMArea(address)
+}
+
+// symbolArea start of the memory area, labels don't extend past it
+// https://gbdev.io/pandocs/Memory_Map.html
+func symbolArea(address Word) Word {
+	for _, start := range []Word{0xFFFF, 0xFF80, 0xFF00, 0xFE00, 0xE000, 0xD000, 0xC000, 0xA000, 0x8000, 0x4000} {
+		if address >= start {
+			return start
+		}
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package emulator
 
 import (
 	"log"
+	"math/bits"
 	"time"
 )
 
@@ -22,6 +23,25 @@ var (
 	}
 )
 
+// powerUpDiv internal DIV counter when the boot ROM hands over to the cartridge, the upper byte
+// (DIV) as documented, the lower one as timed by the mooneye boot_div tests. The SGB boot ROM
+// also sends the cartridge header to the SNES, a M-cycle longer for each 0 bit (see sgbHeaderDiv)
+// https://gbdev.io/pandocs/Power_Up_Sequence.html#hardware-registers
+var powerUpDiv = map[Mode]uint16{
+	DMG0: 0x1834,
+	DMG:  0xABD0,
+	MGB:  0xABD0,
+	SGB:  0xD30C,
+	SGB2: 0xD30C,
+}
+
+// SGB boot ROM, cartridge header sent to the SNES
+// https://gbdev.io/pandocs/SGB_Functions.html
+const (
+	SGB_HEADER_START = 0x0104
+	SGB_HEADER_END   = 0x014F
+)
+
 type Timer struct {
 	c        *Cpu
 	overflow bool
@@ -201,4 +221,28 @@ func (t *Timer) sync(cycle int) {
 
 func (t *Timer) init() {
 
+	// the boot ROM starts with DIV at 0
+	if t.c.memory.bootROM != nil {
+		return
+	}
+
+	counter, ok := powerUpDiv[t.c.mode]
+	if !ok {
+		counter = powerUpDiv[DMG]
+	}
+	if sgbModel(t.c.mode) {
+		counter += t.sgbHeaderDiv()
+	}
+	t.counter = counter
+	t.c.memory.mem[PORT_DIV] = uint8((t.counter & 0xFF00) >> 8)
+}
+
+// sgbHeaderDiv T-cycles the SGB boot ROM takes to send the 0 bits of the cartridge header, which
+// are a M-cycle longer than the 1 bits
+func (t *Timer) sgbHeaderDiv() uint16 {
+	var zeros int
+	for address := Word(SGB_HEADER_START); address <= SGB_HEADER_END; address++ {
+		zeros += 8 - bits.OnesCount8(t.c.memory.mem[address])
+	}
+	return uint16(zeros * 4)
 }
@@ -0,0 +1,36 @@
+package emulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	// LY as read by the CPU while tracing, the reference logs are taken with the LCD stubbed
+	// https://github.com/robert/gameboy-doctor#preparing-your-emulator
+	TRACE_LY = 0x90
+)
+
+// newTrace buffers the trace log, reads of LY are stubbed (see TRACE_LY)
+func (c *Cpu) newTrace(w io.Writer) {
+	c.trace = bufio.NewWriter(w)
+	c.memory.stubLY = true
+}
+
+// traceInstruction logs the state before the instruction at PC, in the gameboy-doctor format
+// (e.g. A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02)
+func (c *Cpu) traceInstruction() {
+	pc := c.instructionAddress()
+	fmt.Fprintf(c.trace, "A:%.2X F:%.2X B:%.2X C:%.2X D:%.2X E:%.2X H:%.2X L:%.2X SP:%.4X PC:%.4X PCMEM:%.2X,%.2X,%.2X,%.2X\n",
+		c.reg.r8(reg_a), c.reg.r8(reg_f), c.reg.r8(reg_b), c.reg.r8(reg_c), c.reg.r8(reg_d), c.reg.r8(reg_e), c.reg.r8(reg_h), c.reg.r8(reg_l),
+		c.sp, pc, c.memory.Read(pc), c.memory.Read(pc+1), c.memory.Read(pc+2), c.memory.Read(pc+3))
+}
+
+// flushTrace writes the buffered trace lines
+func (c *Cpu) flushTrace() error {
+	if c.trace == nil {
+		return nil
+	}
+	return c.trace.Flush()
+}
@@ -0,0 +1,33 @@
+package emulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+
+	var out bytes.Buffer
+	g := NewGameBoy(Config{Silent: true, Trace: &out})
+	assert.NoError(t, g.LoadROM(debuggerROM()))
+	assert.NoError(t, g.RunFrames(1))
+	assert.NoError(t, g.Close())
+
+	// post-boot state, F:80 as the header checksum is 0
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, []string{
+		"A:01 F:80 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:3E,12,CD,10",
+		"A:12 F:80 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0102 PCMEM:CD,10,01,06",
+		"A:12 F:80 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFC PC:0110 PCMEM:3C,CB,37,C9",
+		"A:13 F:00 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFC PC:0111 PCMEM:CB,37,C9,00",
+		"A:31 F:00 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFC PC:0113 PCMEM:C9,00,00,00",
+		"A:31 F:00 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0105 PCMEM:06,34,EA,00",
+	}, lines[:6])
+
+	// the loop, up to the end of the frame
+	assert.Equal(t, "A:31 F:00 B:34 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:010A PCMEM:18,FE,00,00", lines[len(lines)-2])
+	assert.Equal(t, uint8(TRACE_LY), g.ReadMemory(LY_REGISTER))
+}
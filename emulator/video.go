@@ -2,12 +2,9 @@ package emulator
 
 import (
 	"fmt"
-	"image/color"
 	"log"
 	"sort"
 	"time"
-
-	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 type Pixel uint8
@@ -39,45 +36,17 @@ const (
 	LCD_REGISTER  = 0xFF41
 	LY_REGISTER   = 0xFF44
 	LYC_REGISTER  = 0xFF45
+	BGP_REGISTER  = 0xFF47
 )
 
-var palettes = map[int]map[Pixel]color.RGBA{
-	// default b/w
-	0: {
-		0: rl.RayWhite,
-		1: rl.LightGray,
-		2: rl.DarkGray,
-		3: rl.Black,
-	},
-	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Lime-Midori-810574708
-	1: {
-		0: rl.NewColor(224, 235, 175, 255),
-		1: rl.NewColor(170, 207, 83, 255),
-		2: rl.NewColor(123, 141, 66, 255),
-		3: rl.NewColor(71, 89, 80, 255),
-	},
-	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Pokemon-Pinball-Ver-882658817
-	2: {
-		0: rl.NewColor(232, 248, 184, 255),
-		1: rl.NewColor(160, 176, 80, 255),
-		2: rl.NewColor(120, 96, 48, 255),
-		3: rl.NewColor(24, 24, 32, 255),
-	},
-	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Green-Awakening-883049033
-	3: {
-		0: rl.NewColor(241, 255, 221, 255),
-		1: rl.NewColor(152, 219, 117, 255),
-		2: rl.NewColor(54, 112, 88, 255),
-		3: rl.NewColor(0, 11, 22, 255),
-	},
+// powerUpPPU M-cycles the PPU is ahead of the DMG one when the boot ROM hands over to the
+// cartridge, the boot ROMs run for different times (as timed by the mooneye boot_hwio tests)
+var powerUpPPU = map[Mode]int{
+	DMG0: 16460,
 }
 
 type Video struct {
-	w              int32
-	h              int32
-	internalWidth  int32
-	internalHeight int32
-	scaleFactor    int32
+	sink VideoSink
 
 	mem        *Memory
 	scanline   int
@@ -90,11 +59,17 @@ type Video struct {
 	nextMode       uint8
 	disabled       bool
 	lastComparison bool
-	palette        int
 
 	currentOamAddr Word
 
-	videoMemory [144][160]Pixel
+	videoMemory [SCREEN_HEIGHT][SCREEN_WIDTH]Pixel
+	colorMemory [SCREEN_HEIGHT][SCREEN_WIDTH]Color // CGB and SGB modes
+
+	sgb *Sgb // SGB models
+
+	// window line counter (CGB mode), advances only on the lines the window was drawn on
+	windowLine  int
+	windowDrawn bool
 
 	ts     int
 	t      time.Time
@@ -102,16 +77,12 @@ type Video struct {
 	total2 int
 }
 
-func (v *Video) init(width, height int32) {
-	v.internalWidth = 64
-	v.internalHeight = 32
-	v.w = width
-	v.h = height
-	v.scaleFactor = v.w / v.internalWidth
+func (v *Video) init() error {
 	v.t = time.Now()
-
-	rl.InitWindow(v.w, v.h, "GameBoy-DMG Emulator")
-	rl.SetTargetFPS(60)
+	if _, ok := v.sink.(SGBVideoSink); ok && v.sgb != nil {
+		return v.sink.Init(SGB_SCREEN_WIDTH, SGB_SCREEN_HEIGHT)
+	}
+	return v.sink.Init(SCREEN_WIDTH, SCREEN_HEIGHT)
 }
 
 func (v *Video) setMode(mode uint8) {
@@ -142,6 +113,11 @@ func (v *Video) setMode(mode uint8) {
 		v.t = time.Now()
 	}
 
+	// CGB HBlank DMA, a block per HBlank
+	if mode == 0 && v.mode == 3 && v.mem.Read(LCDC_REGISTER)&0x80 > 0 {
+		v.mem.hblankDMA()
+	}
+
 	// set mode
 	v.mode = mode & 0x3
 	v.mem.Write(LCD_REGISTER, (v.mem.Read(LCD_REGISTER)&0xFC)|v.mode)
@@ -233,7 +209,7 @@ func (v *Video) fetchWindow() (Pixel, Pixel, bool) {
 		}
 
 		pixel := tile[(xPos)%8]
-		palette := v.mem.Read(0xFF47)
+		palette := v.mem.Read(BGP_REGISTER)
 		color := palette & ((0x3) << (pixel * 2)) >> (pixel * 2)
 		return Pixel(color), pixel, true
 	}
@@ -296,7 +272,7 @@ func (v *Video) fetchBackground() (Pixel, Pixel) {
 	}
 
 	pixel := tile[(scx+x)%8]
-	palette := v.mem.Read(0xFF47)
+	palette := v.mem.Read(BGP_REGISTER)
 	color := palette & ((0x3) << (pixel * 2)) >> (pixel * 2)
 	return Pixel(color), pixel
 }
@@ -333,32 +309,25 @@ func (v *Video) fetchTile(tileNumber, mode, size uint8) Tile {
 	return tile
 }
 
-func (v *Video) draw() {
-
-	rl.BeginDrawing()
-	rl.ClearBackground(palettes[v.palette][0])
-	defer rl.EndDrawing()
-
-	colors := palettes[v.palette]
-
-	// Draw
-	for y := 0; y < 144; y++ {
-		for x := 0; x < 160; x++ {
-			var (
-				scaleFactory = int32(4)
-				posX         = int32(x) * scaleFactory
-				posY         = int32(y) * scaleFactory
-			)
-			pixel := v.videoMemory[y][x]
-
-			color := colors[pixel]
-			if pixel == 100 {
-				color = rl.ColorAlpha(color, 0)
-			}
+func (v *Video) close() {
+	v.sink.Close()
+}
 
-			rl.DrawRectangle(posX, posY, scaleFactory, scaleFactory, color)
+// draw presents the current frame, in color if both the sink and the cartridge support it,
+// SGB frames are colorized by the SGB palettes and surrounded by the border
+func (v *Video) draw() {
+	if v.sgb != nil {
+		v.sgb.colorize(&v.videoMemory, &v.colorMemory)
+		if sink, ok := v.sink.(SGBVideoSink); ok {
+			sink.DrawSGB(v.sgb.frame(&v.colorMemory))
+			return
 		}
 	}
+	if sink, ok := v.sink.(ColorVideoSink); ok && (v.mem.cgb || v.sgb != nil) {
+		sink.DrawColor(&v.colorMemory)
+		return
+	}
+	v.sink.Draw(&v.videoMemory)
 }
 
 func (v *Video) checkInterruption(resetCondition bool) {
@@ -413,6 +382,7 @@ func (v *Video) scan(c *Cpu) {
 			log.Printf("DISABLING PPU\n")
 			v.scanline = 0
 			v.scancolumn = 0
+			v.windowLine = 0
 			v.setMode(0)
 			v.mem.Write(LY_REGISTER, uint8(v.scanline))
 			v.disabled = true
@@ -448,6 +418,7 @@ func (v *Video) scan(c *Cpu) {
 			v.scancolumn = 0
 			v.nextMode = 2
 		} else {
+			v.windowLine = 0
 			v.nextMode = 1
 		}
 	}
@@ -489,9 +460,12 @@ func (v *Video) scan(c *Cpu) {
 			// reset oam address counter
 			v.currentOamAddr = 0
 
-			sort.SliceStable(v.buffer, func(i, j int) bool {
-				return v.buffer[i].xPos > v.buffer[j].xPos
-			})
+			// CGB mode priority is the OAM order
+			if !v.mem.cgb {
+				sort.SliceStable(v.buffer, func(i, j int) bool {
+					return v.buffer[i].xPos > v.buffer[j].xPos
+				})
+			}
 
 			// drawing
 			v.setMode(3)
@@ -505,91 +479,109 @@ func (v *Video) scan(c *Cpu) {
 
 		// 4 dots per m-cycle
 		for range 4 {
-			bgPx, obgPx := v.fetchBackground()
-			bgWd, obgWd, hasWindow := v.fetchWindow()
-
-			// default is to display BG or Window, (can be overriden by sprites below)
-			if hasWindow {
-				v.videoMemory[v.scanline][v.scancolumn] = bgWd
+			if v.mem.cgb {
+				v.renderCGB()
 			} else {
-				v.videoMemory[v.scanline][v.scancolumn] = bgPx
+				v.renderDMG()
+			}
+
+			v.scancolumn++
+			if v.scancolumn == 160 {
+				// reset buffer
+				v.buffer = make([]Sprite, 0)
+				v.nextWindowLine()
+				// advance LY
+				v.advanceLy(c)
+				v.delay = 4
+				v.nextMode = 0
+				v.scancolumn = 0
 			}
+		}
+	}
+}
 
-			for _, o := range v.buffer {
+// nextWindowLine advances the window line counter at the end of a line the window was drawn on
+func (v *Video) nextWindowLine() {
+	if v.windowDrawn {
+		v.windowLine++
+		v.windowDrawn = false
+	}
+}
 
-				if v.scancolumn >= int(o.xPos) && int(o.xPos+8) > v.scancolumn {
+// renderDMG renders the pixel at the current scan position
+func (v *Video) renderDMG() {
+	bgPx, obgPx := v.fetchBackground()
+	bgWd, obgWd, hasWindow := v.fetchWindow()
 
-					// obj is disabled
-					lcdc := v.mem.Read(LCDC_REGISTER)
-					if lcdc&0x2 == 0 {
-						continue
-					}
+	// default is to display BG or Window, (can be overriden by sprites below)
+	if hasWindow {
+		v.videoMemory[v.scanline][v.scancolumn] = bgWd
+	} else {
+		v.videoMemory[v.scanline][v.scancolumn] = bgPx
+	}
 
-					sprite := v.fetchTile(o.tile, 1, v.height())
+	for _, o := range v.buffer {
 
-					// vertical flip
-					if o.flags&0x40 > 0 {
-						cmp := sprite
-						for fy := range v.height() {
-							sprite[(v.height()-1)-fy] = cmp[fy]
-						}
-					}
+		if v.scancolumn >= int(o.xPos) && int(o.xPos+8) > v.scancolumn {
 
-					// horizontal flip
-					if o.flags&0x20 > 0 {
-						cmp := sprite
-						for fy := range v.height() {
-							for fx := range 8 {
-								sprite[fy][7-fx] = cmp[fy][fx]
-							}
-						}
-					}
+			// obj is disabled
+			lcdc := v.mem.Read(LCDC_REGISTER)
+			if lcdc&0x2 == 0 {
+				continue
+			}
 
-					py := (v.scanline - int(o.yPos)) % int(v.height())
-					px := (v.scancolumn - int(o.xPos)) % 8
+			sprite := v.fetchTile(o.tile, 1, v.height())
 
-					objPx := sprite[py][px]
+			// vertical flip
+			if o.flags&0x40 > 0 {
+				cmp := sprite
+				for fy := range v.height() {
+					sprite[(v.height()-1)-fy] = cmp[fy]
+				}
+			}
 
-					if objPx != 0x0 {
-						// OBP0
-						addr := Word(0xFF48)
+			// horizontal flip
+			if o.flags&0x20 > 0 {
+				cmp := sprite
+				for fy := range v.height() {
+					for fx := range 8 {
+						sprite[fy][7-fx] = cmp[fy][fx]
+					}
+				}
+			}
 
-						// OBP1
-						if o.flags&0x10 > 0 {
-							addr = 0xFF49
-						}
+			py := (v.scanline - int(o.yPos)) % int(v.height())
+			px := (v.scancolumn - int(o.xPos)) % 8
 
-						pixel := sprite[py][px]
+			objPx := sprite[py][px]
 
-						// BG-OVER-OBJ priority
-						bgOverObj := o.flags&0x80 > 0
+			if objPx != 0x0 {
+				// OBP0
+				addr := Word(0xFF48)
 
-						// obj color palette
-						palette := v.mem.Read(addr)
+				// OBP1
+				if o.flags&0x10 > 0 {
+					addr = 0xFF49
+				}
 
-						// apply palette
-						color := Pixel(palette & ((0x3) << (pixel * 2)) >> (pixel * 2))
+				pixel := sprite[py][px]
 
-						// bg over obj AND bg original color > 0
-						if !bgOverObj || ((!hasWindow && obgPx == 0) || (hasWindow && obgWd == 0)) {
-							v.videoMemory[v.scanline][v.scancolumn] = Pixel(color)
-						}
+				// BG-OVER-OBJ priority
+				bgOverObj := o.flags&0x80 > 0
 
-						// stop process
-						break
-					}
+				// obj color palette
+				palette := v.mem.Read(addr)
+
+				// apply palette
+				color := Pixel(palette & ((0x3) << (pixel * 2)) >> (pixel * 2))
+
+				// bg over obj AND bg original color > 0
+				if !bgOverObj || ((!hasWindow && obgPx == 0) || (hasWindow && obgWd == 0)) {
+					v.videoMemory[v.scanline][v.scancolumn] = Pixel(color)
 				}
-			}
 
-			v.scancolumn++
-			if v.scancolumn == 160 {
-				// reset buffer
-				v.buffer = make([]Sprite, 0)
-				// advance LY
-				v.advanceLy(c)
-				v.delay = 4
-				v.nextMode = 0
-				v.scancolumn = 0
+				// stop process
+				break
 			}
 		}
 	}
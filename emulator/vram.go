@@ -0,0 +1,271 @@
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VRAM viewers
+// https://gbdev.io/pandocs/Tile_Data.html
+const (
+	TILE_DATA_START = 0x8000
+	TILE_DATA_TILES = 384 // 0x8000-0x97FF
+
+	// tile data image, tiles per row (16x24 tiles)
+	TILE_DATA_COLUMNS = 16
+
+	// tile map side, in tiles
+	TILE_MAP_SIZE = 32
+
+	// OAM entries, 4 bytes each
+	OAM_SPRITES = 40
+
+	// sprites image, sprites per row (8x5 sprites)
+	OAM_COLUMNS = 8
+)
+
+// tile map overlays, the area shown by the background (SCX/SCY) and by the window (WX/WY)
+var (
+	VIEWPORT_COLOR = color.RGBA{R: 0xFF, A: 0xFF}
+	WINDOW_COLOR   = color.RGBA{B: 0xFF, A: 0xFF}
+)
+
+// shadeColor applies a DMG palette register (BGP, OBP0, OBP1) to a color index
+func shadeColor(palette, pixel uint8) color.RGBA {
+	shade := SHADES[(palette>>(pixel*2))&0x3]
+	return color.RGBA{R: shade.Y, G: shade.Y, B: shade.Y, A: 0xFF}
+}
+
+// bgPixelColor color of a background color index, BGP or a CGB background palette (0-7)
+func (g *GameBoy) bgPixelColor(palette, pixel uint8) color.RGBA {
+	if g.c.memory.cgb {
+		return g.c.memory.bgColor(palette, pixel).RGBA()
+	}
+	return shadeColor(g.c.memory.read(BGP_REGISTER), pixel)
+}
+
+// TileData draws the 384 tiles of a VRAM bank (bank 1 only in CGB mode), 16 tiles per row in
+// the 0x8000 order, with BGP or the CGB background palette 0
+func (g *GameBoy) TileData(bank uint8) *image.RGBA {
+
+	img := image.NewRGBA(image.Rect(0, 0, TILE_DATA_COLUMNS*8, TILE_DATA_TILES/TILE_DATA_COLUMNS*8))
+	for tile := 0; tile < TILE_DATA_TILES; tile++ {
+		address := Word(TILE_DATA_START + tile*16)
+		x, y := tile%TILE_DATA_COLUMNS*8, tile/TILE_DATA_COLUMNS*8
+		for row := 0; row < 8; row++ {
+			for col := 0; col < 8; col++ {
+				img.SetRGBA(x+col, y+row, g.bgPixelColor(0, g.video.tilePixel(bank, address, row, col)))
+			}
+		}
+	}
+	return img
+}
+
+// TileMap draws a 32x32 tile map (VRAM_BACKGROUND_START or VRAM_WINDOW_START) as the PPU
+// addresses the tiles (LCDC bit 4), with the CGB attributes in CGB mode. The area shown on the
+// LCD is outlined when the map is in use, by the background (VIEWPORT_COLOR, wraps around) and
+// by the window (WINDOW_COLOR)
+// https://gbdev.io/pandocs/Tile_Maps.html
+func (g *GameBoy) TileMap(tileMap Word) *image.RGBA {
+
+	lcdc := g.c.memory.read(LCDC_REGISTER)
+	mode := (lcdc & 0x10) >> 4
+
+	size := TILE_MAP_SIZE * 8
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if g.c.memory.cgb {
+				pixel, attrs := g.video.cgbMapPixel(tileMap, x, y)
+				img.SetRGBA(x, y, g.bgPixelColor(attrs&0x7, pixel))
+				continue
+			}
+			tileNumber := g.c.memory.vram(0, tileMap+Word(x/8+TILE_MAP_SIZE*(y/8)))
+			img.SetRGBA(x, y, g.bgPixelColor(0, g.video.tilePixel(0, tileAddress(tileNumber, mode), y%8, x%8)))
+		}
+	}
+
+	// background viewport (LCDC bit 3), wraps around the map
+	if mapArea(lcdc&0x8 > 0) == tileMap {
+		scy, scx := int(g.c.memory.read(0xFF42)), int(g.c.memory.read(0xFF43))
+		outline(img, scx, scy, SCREEN_WIDTH, SCREEN_HEIGHT, VIEWPORT_COLOR)
+	}
+
+	// window (LCDC bits 5 and 6), from the top-left tile up to the LCD right and bottom edges
+	wy, wx := int(g.c.memory.read(0xFF4A)), int(g.c.memory.read(0xFF4B))-7
+	if lcdc&0x20 > 0 && mapArea(lcdc&0x40 > 0) == tileMap && wx < SCREEN_WIDTH && wy < SCREEN_HEIGHT {
+		outline(img, 0, 0, SCREEN_WIDTH-max(wx, 0), SCREEN_HEIGHT-wy, WINDOW_COLOR)
+	}
+
+	return img
+}
+
+// mapArea tile map selected by a LCDC bit
+func mapArea(high bool) Word {
+	if high {
+		return VRAM_WINDOW_START
+	}
+	return VRAM_BACKGROUND_START
+}
+
+// outline draws the border of a rectangle, wrapping around the image
+func outline(img *image.RGBA, x, y, width, height int, c color.RGBA) {
+	size := img.Bounds().Size()
+	set := func(px, py int) {
+		img.SetRGBA(px%size.X, py%size.Y, c)
+	}
+	for i := 0; i < width; i++ {
+		set(x+i, y)
+		set(x+i, y+height-1)
+	}
+	for i := 0; i < height; i++ {
+		set(x, y+i)
+		set(x+width-1, y+i)
+	}
+}
+
+// OAM reads the 40 OAM entries, the positions as on screen (Y - 16, X - 8)
+// https://gbdev.io/pandocs/OAM.html
+func (g *GameBoy) OAM() [OAM_SPRITES]Sprite {
+	var sprites [OAM_SPRITES]Sprite
+	for i := range sprites {
+		address := Word(OAM_MEMORY_START + i*4)
+		sprites[i] = Sprite{
+			yPos:  g.c.memory.read(address) - 16,
+			xPos:  g.c.memory.read(address+1) - 8,
+			tile:  g.c.memory.read(address + 2),
+			flags: g.c.memory.read(address + 3),
+		}
+	}
+	return sprites
+}
+
+// WriteOAM writes a table of the OAM entries, with the attributes decoded (the CGB bank and
+// palette in CGB mode, OBP0/OBP1 otherwise)
+// https://gbdev.io/pandocs/OAM.html#byte-3--attributesflags
+func (g *GameBoy) WriteOAM(w io.Writer) error {
+
+	if _, err := fmt.Fprintln(w, " #    Y    X  TILE  PRIORITY  FLIP  PALETTE"); err != nil {
+		return err
+	}
+
+	for i, s := range g.OAM() {
+		priority := "OBJ"
+		if s.flags&0x80 > 0 {
+			priority = "BG"
+		}
+		flip := []byte("--")
+		if s.flags&0x20 > 0 {
+			flip[0] = 'X'
+		}
+		if s.flags&0x40 > 0 {
+			flip[1] = 'Y'
+		}
+		palette := fmt.Sprintf("OBP%d", (s.flags&0x10)>>4)
+		if g.c.memory.cgb {
+			palette = fmt.Sprintf("OBJ%d VRAM%d", s.flags&0x7, (s.flags&0x8)>>3)
+		}
+
+		if _, err := fmt.Fprintf(w, "%2d  %3d  %3d   $%.2X  %-8s  %s    %s\n", i, int(s.yPos+16)-16, int(s.xPos+8)-8, s.tile, priority, flip, palette); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sprites draws the 40 OAM entries, 8 per row, flipped and with their palette as on screen. The
+// transparent pixels (color 0) are transparent, cells are 8x16 in both object sizes
+func (g *GameBoy) Sprites() *image.RGBA {
+
+	height := int(g.video.height())
+	img := image.NewRGBA(image.Rect(0, 0, OAM_COLUMNS*8, OAM_SPRITES/OAM_COLUMNS*16))
+
+	for i, s := range g.OAM() {
+		x, y := i%OAM_COLUMNS*8, i/OAM_COLUMNS*16
+
+		// 8x16 objects ignore the tile index bit 0
+		tile := s.tile
+		if height == 16 {
+			tile &= 0xFE
+		}
+		bank := uint8(0)
+		if g.c.memory.cgb {
+			bank = (s.flags & 0x8) >> 3
+		}
+
+		for row := 0; row < height; row++ {
+			for col := 0; col < 8; col++ {
+				r, c := row, col
+				if s.flags&0x40 > 0 {
+					r = height - 1 - row
+				}
+				if s.flags&0x20 > 0 {
+					c = 7 - col
+				}
+				pixel := g.video.tilePixel(bank, tileAddress(tile, 1), r, c)
+				if pixel == 0 {
+					continue
+				}
+				switch {
+				case g.c.memory.cgb:
+					img.SetRGBA(x+col, y+row, g.c.memory.objColor(s.flags&0x7, pixel).RGBA())
+				case s.flags&0x10 > 0:
+					img.SetRGBA(x+col, y+row, shadeColor(g.c.memory.read(0xFF49), pixel))
+				default:
+					img.SetRGBA(x+col, y+row, shadeColor(g.c.memory.read(0xFF48), pixel))
+				}
+			}
+		}
+	}
+	return img
+}
+
+// SaveVRAM writes the VRAM viewers into a directory: tiles.png (and tiles1.png, VRAM bank 1 in
+// CGB mode), tilemap_9800.png, tilemap_9C00.png, sprites.png and oam.txt
+func (g *GameBoy) SaveVRAM(dir string) error {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	images := map[string]image.Image{
+		"tiles.png":        g.TileData(0),
+		"tilemap_9800.png": g.TileMap(VRAM_BACKGROUND_START),
+		"tilemap_9C00.png": g.TileMap(VRAM_WINDOW_START),
+		"sprites.png":      g.Sprites(),
+	}
+	if g.c.memory.cgb {
+		images["tiles1.png"] = g.TileData(1)
+	}
+	for name, img := range images {
+		if err := savePNG(filepath.Join(dir, name), img); err != nil {
+			return err
+		}
+	}
+
+	var oam strings.Builder
+	if err := g.WriteOAM(&oam); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "oam.txt"), []byte(oam.String()), 0644)
+}
+
+func savePNG(file string, img image.Image) error {
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
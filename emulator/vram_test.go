@@ -0,0 +1,78 @@
+package emulator
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVRAMViewers(t *testing.T) {
+
+	g := NewGameBoy(Config{Silent: true})
+	assert.NoError(t, g.LoadROM(make([]uint8, 0x8000)))
+
+	// tile 1 all color 1, tile 0 blank
+	for i := 0; i < 16; i += 2 {
+		g.c.memory.mem[0x8010+i] = 0xFF
+	}
+	g.c.memory.mem[VRAM_BACKGROUND_START] = 1
+	g.c.memory.mem[VRAM_WINDOW_START+1] = 1
+
+	// background on 9800 (unsigned tiles), window on 9C00 at 80, 100
+	g.c.memory.mem[LCDC_REGISTER] = 0xF1
+	g.c.memory.mem[BGP_REGISTER] = 0xE4
+	g.c.memory.mem[0xFF42], g.c.memory.mem[0xFF43] = 200, 120 // SCY, SCX
+	g.c.memory.mem[0xFF4A], g.c.memory.mem[0xFF4B] = 100, 87  // WY, WX
+
+	// object 0 at 20, 10, flipped horizontally with OBP1, object 1 off screen
+	copy(g.c.memory.mem[OAM_MEMORY_START:], []uint8{26, 28, 1, 0x30, 0, 0, 0, 0x80})
+	g.c.memory.mem[0xFF49] = 0x1C
+
+	light, white := shadeColor(0xE4, 1), shadeColor(0xE4, 0)
+
+	tiles := g.TileData(0)
+	assert.Equal(t, [2]int{128, 192}, [2]int{tiles.Bounds().Dx(), tiles.Bounds().Dy()})
+	assert.Equal(t, white, tiles.RGBAAt(7, 7))
+	assert.Equal(t, light, tiles.RGBAAt(8, 0))
+	assert.Equal(t, light, tiles.RGBAAt(15, 7))
+
+	// the viewport wraps around the map
+	background := g.TileMap(VRAM_BACKGROUND_START)
+	assert.Equal(t, light, background.RGBAAt(1, 1))
+	assert.Equal(t, white, background.RGBAAt(9, 1))
+	assert.Equal(t, VIEWPORT_COLOR, background.RGBAAt(120, 200))
+	assert.Equal(t, VIEWPORT_COLOR, background.RGBAAt((120+159)%256, (200+143)%256))
+	assert.Equal(t, white, background.RGBAAt(79, 43))
+
+	window := g.TileMap(VRAM_WINDOW_START)
+	assert.Equal(t, light, window.RGBAAt(9, 1))
+	assert.Equal(t, WINDOW_COLOR, window.RGBAAt(0, 0))
+	assert.Equal(t, WINDOW_COLOR, window.RGBAAt(79, 43))
+	assert.Equal(t, white, window.RGBAAt(80, 44))
+	assert.NotEqual(t, VIEWPORT_COLOR, window.RGBAAt(120, 200))
+
+	oam := g.OAM()
+	assert.Equal(t, Sprite{yPos: 10, xPos: 20, tile: 1, flags: 0x30}, oam[0])
+
+	var table strings.Builder
+	assert.NoError(t, g.WriteOAM(&table))
+	lines := strings.Split(table.String(), "\n")
+	assert.Equal(t, OAM_SPRITES+2, len(lines))
+	assert.Equal(t, " 0   10   20   $01  OBJ       X-    OBP1", lines[1])
+	assert.Equal(t, " 1  -16   -8   $00  BG        --    OBP0", lines[2])
+
+	sprites := g.Sprites()
+	assert.Equal(t, shadeColor(0x1C, 1), sprites.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{}, sprites.RGBAAt(8, 0))
+
+	dir := filepath.Join(t.TempDir(), "vram")
+	assert.NoError(t, g.SaveVRAM(dir))
+	for _, name := range []string{"tiles.png", "tilemap_9800.png", "tilemap_9C00.png", "sprites.png", "oam.txt"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+	}
+}
@@ -0,0 +1,37 @@
+package frontend
+
+import (
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Audio raylib audio stream, implements emulator.AudioSink
+type Audio struct {
+	stream rl.AudioStream
+}
+
+func NewAudio() *Audio {
+	return &Audio{}
+}
+
+func (a *Audio) Init(sampleRate, bufferSize int) error {
+	rl.InitAudioDevice()
+	rl.SetAudioStreamBufferSizeDefault(int32(bufferSize))
+	a.stream = rl.LoadAudioStream(uint32(sampleRate), 32, 1)
+	rl.PlayAudioStream(a.stream)
+	return nil
+}
+
+func (a *Audio) Play(samples []float32) {
+	for !rl.IsAudioStreamProcessed(a.stream) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rl.UpdateAudioStream(a.stream, samples)
+}
+
+func (a *Audio) Close() {
+	rl.UnloadAudioStream(a.stream)
+	rl.CloseAudioDevice()
+}
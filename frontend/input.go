@@ -0,0 +1,66 @@
+package frontend
+
+import (
+	"github.com/Dudssource/shiny-cart/emulator"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// keyboard layout
+var buttons = map[int32]emulator.Button{
+	rl.KeyQ:     emulator.BUTTON_START,
+	rl.KeyW:     emulator.BUTTON_SELECT,
+	rl.KeyS:     emulator.BUTTON_B,
+	rl.KeyA:     emulator.BUTTON_A,
+	rl.KeyDown:  emulator.BUTTON_DOWN,
+	rl.KeyUp:    emulator.BUTTON_UP,
+	rl.KeyLeft:  emulator.BUTTON_LEFT,
+	rl.KeyRight: emulator.BUTTON_RIGHT,
+}
+
+// Input raylib keyboard, implements emulator.InputSource (requires the Video window)
+type Input struct{}
+
+func NewInput() *Input {
+	return &Input{}
+}
+
+func (i *Input) Buttons() emulator.Button {
+
+	// typing into the memory editor
+	if editing {
+		return 0
+	}
+
+	var pressed emulator.Button
+	for key, button := range buttons {
+		if rl.IsKeyDown(key) {
+			pressed |= button
+		}
+	}
+	return pressed
+}
+
+func (i *Input) Hotkey() emulator.Hotkey {
+
+	// pause (debugger)
+	if rl.IsKeyPressed(rl.KeyP) {
+		return emulator.HOTKEY_PAUSE
+	}
+
+	// save states (F1-F9 saves, SHIFT+F1-F9 loads)
+	for slot := 0; slot < emulator.STATE_SLOTS; slot++ {
+		if !rl.IsKeyPressed(rl.KeyF1 + int32(slot)) {
+			continue
+		}
+		if rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift) {
+			return emulator.HOTKEY_LOAD_STATE + emulator.Hotkey(slot)
+		}
+		return emulator.HOTKEY_SAVE_STATE + emulator.Hotkey(slot)
+	}
+
+	return emulator.HOTKEY_NONE
+}
+
+func (i *Input) Closed() bool {
+	return rl.WindowShouldClose()
+}
@@ -0,0 +1,200 @@
+package frontend
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+
+	"github.com/Dudssource/shiny-cart/emulator"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	MEMORY_ROW_BYTES   = 16
+	MEMORY_LINE_HEIGHT = VIEWER_FONT_SIZE + 3
+
+	// writes highlighted for a second, fading out
+	MEMORY_HIGHLIGHT_FRAMES = 60
+)
+
+var (
+	memoryWritten = rl.NewColor(255, 220, 64, 255)
+	memoryCursor  = rl.NewColor(64, 96, 160, 255)
+)
+
+// editing the memory editor has the keyboard, the joypad keys are ignored (see Input.Buttons)
+var editing bool
+
+// memoryViewer memory viewer/editor, the CPU view or a ROM/RAM bank (see emulator.MemoryView)
+type memoryViewer struct {
+	view   emulator.MemoryView
+	top    int // address of the first row
+	cursor int // address edited
+	nibble bool
+	value  uint8 // high nibble typed
+}
+
+// draw draws a hexdump of the view, the bytes written by the last frames are highlighted
+func (m *memoryViewer) draw(g *emulator.GameBoy, x, y, height int32) {
+
+	rows := int(height-y)/MEMORY_LINE_HEIGHT - 3
+	hexX := x + 6*VIEWER_FONT_ADVANCE
+	top := y + 3*MEMORY_LINE_HEIGHT
+
+	m.input(g, hexX, top, rows)
+
+	banks, ramBanks := g.MemoryBanks()
+	rom, ram := g.MappedBanks()
+	label(x, y, fmt.Sprintf("MEMORY %s, mapped ROM $%.2X/%d RAM $%.2X/%d", m.view, rom, banks, ram, ramBanks))
+	label(x, y+MEMORY_LINE_HEIGHT, "TAB view  [ ] bank  PGUP/PGDN/WHEEL scroll  CLICK edit  ENTER done")
+
+	// writes are tracked on the CPU addresses, the bank views show those of the mapped banks
+	mapped := m.view.Space == emulator.MEMORY_CPU ||
+		m.view.Space == emulator.MEMORY_ROM && (m.view.Bank == 0 || m.view.Bank == rom) ||
+		m.view.Space == emulator.MEMORY_RAM && m.view.Bank == ram
+
+	_, last := m.view.Range()
+	for row := 0; row < rows && m.top+row*MEMORY_ROW_BYTES <= int(last); row++ {
+		address := m.top + row*MEMORY_ROW_BYTES
+		rowY := top + int32(row)*MEMORY_LINE_HEIGHT
+		label(x, rowY, fmt.Sprintf("%.4X", address))
+
+		ascii := make([]byte, 0, MEMORY_ROW_BYTES)
+		for i := 0; i < MEMORY_ROW_BYTES; i++ {
+			a := uint16(address + i)
+			byteX := hexX + int32(i*3)*VIEWER_FONT_ADVANCE
+
+			v, ok := g.PeekMemory(m.view, a)
+			text := fmt.Sprintf("%.2X", v)
+			if !ok {
+				text = "--"
+			}
+			if ok && v >= 0x20 && v < 0x7F {
+				ascii = append(ascii, v)
+			} else {
+				ascii = append(ascii, '.')
+			}
+
+			c := rl.RayWhite
+			if frames := g.LastWrite(a); mapped && frames >= 0 && frames < MEMORY_HIGHLIGHT_FRAMES {
+				c = fade(memoryWritten, rl.RayWhite, float32(frames)/MEMORY_HIGHLIGHT_FRAMES)
+			}
+			if editing && int(a) == m.cursor {
+				rl.DrawRectangle(byteX-1, rowY-1, 2*VIEWER_FONT_ADVANCE+1, MEMORY_LINE_HEIGHT, memoryCursor)
+				if m.nibble {
+					text = fmt.Sprintf("%X_", m.value>>4)
+				}
+			}
+			drawText(byteX, rowY, text, c)
+		}
+		label(hexX+int32(MEMORY_ROW_BYTES*3)*VIEWER_FONT_ADVANCE, rowY, string(ascii))
+	}
+}
+
+// input scrolls, switches the view and edits the byte under the cursor
+func (m *memoryViewer) input(g *emulator.GameBoy, hexX, top int32, rows int) {
+
+	first, last := m.view.Range()
+	page := rows * MEMORY_ROW_BYTES
+
+	// views, CPU -> mapped ROM bank -> mapped RAM bank (if any)
+	banks, ramBanks := g.MemoryBanks()
+	rom, ram := g.MappedBanks()
+	switch {
+	case rl.IsKeyPressed(rl.KeyTab):
+		switch {
+		case m.view.Space == emulator.MEMORY_CPU:
+			m.view = emulator.MemoryView{Space: emulator.MEMORY_ROM, Bank: rom}
+		case m.view.Space == emulator.MEMORY_ROM && ramBanks > 0:
+			m.view = emulator.MemoryView{Space: emulator.MEMORY_RAM, Bank: min(ram, ramBanks-1)}
+		default:
+			m.view = emulator.MemoryView{Space: emulator.MEMORY_CPU}
+		}
+		m.top, editing = -1, false
+	case rl.IsKeyPressed(rl.KeyLeftBracket) && m.view.Space != emulator.MEMORY_CPU && m.view.Bank > 0:
+		m.view.Bank--
+		m.top, editing = -1, false
+	case rl.IsKeyPressed(rl.KeyRightBracket) && m.view.Space == emulator.MEMORY_ROM && m.view.Bank < banks-1,
+		rl.IsKeyPressed(rl.KeyRightBracket) && m.view.Space == emulator.MEMORY_RAM && m.view.Bank < ramBanks-1:
+		m.view.Bank++
+		m.top, editing = -1, false
+	}
+	if m.top < 0 {
+		first, last = m.view.Range()
+		m.top = int(first)
+	}
+
+	// scrolling
+	shift := rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+	switch {
+	case rl.IsKeyPressed(rl.KeyPageUp) && shift:
+		m.top -= 0x1000
+	case rl.IsKeyPressed(rl.KeyPageDown) && shift:
+		m.top += 0x1000
+	case rl.IsKeyPressed(rl.KeyPageUp):
+		m.top -= page
+	case rl.IsKeyPressed(rl.KeyPageDown):
+		m.top += page
+	}
+	m.top -= int(rl.GetMouseWheelMove()) * 4 * MEMORY_ROW_BYTES
+
+	// click on a byte to edit it
+	if rl.IsMouseButtonPressed(rl.MouseButtonLeft) {
+		p := rl.GetMousePosition()
+		col := int(p.X-float32(hexX)) / (3 * VIEWER_FONT_ADVANCE)
+		row := int(p.Y-float32(top)) / MEMORY_LINE_HEIGHT
+		editing = p.X >= float32(hexX) && p.Y >= float32(top) && col < MEMORY_ROW_BYTES && row < rows
+		m.cursor, m.nibble = m.top+row*MEMORY_ROW_BYTES+col, false
+	}
+
+	if editing {
+		switch {
+		// Escape closes the window (raylib exit key)
+		case rl.IsKeyPressed(rl.KeyEnter):
+			editing = false
+		case rl.IsKeyPressed(rl.KeyLeft):
+			m.cursor, m.nibble = m.cursor-1, false
+		case rl.IsKeyPressed(rl.KeyRight):
+			m.cursor, m.nibble = m.cursor+1, false
+		case rl.IsKeyPressed(rl.KeyUp):
+			m.cursor, m.nibble = m.cursor-MEMORY_ROW_BYTES, false
+		case rl.IsKeyPressed(rl.KeyDown):
+			m.cursor, m.nibble = m.cursor+MEMORY_ROW_BYTES, false
+		}
+
+		// hexadecimal digits, poked once both nibbles are typed
+		for ch := rl.GetCharPressed(); ch > 0; ch = rl.GetCharPressed() {
+			digit, err := strconv.ParseUint(string(rune(ch)), 16, 8)
+			if err != nil {
+				continue
+			}
+			if !m.nibble {
+				m.value, m.nibble = uint8(digit<<4), true
+				continue
+			}
+			g.PokeMemory(m.view, uint16(m.cursor), m.value|uint8(digit))
+			m.cursor, m.nibble = m.cursor+1, false
+		}
+
+		// the cursor stays in the view, scrolled into sight
+		m.cursor = max(int(first), min(m.cursor, int(last)))
+		switch {
+		case m.cursor < m.top:
+			m.top = m.cursor
+		case m.cursor >= m.top+page:
+			m.top = m.cursor - page + MEMORY_ROW_BYTES
+		}
+	}
+
+	// rows aligned, within the view
+	m.top = max(int(first), min(m.top, int(last)+1-page))
+	m.top -= (m.top - int(first)) % MEMORY_ROW_BYTES
+}
+
+// fade blends from a color into another, t from 0 to 1
+func fade(from, to color.RGBA, t float32) color.RGBA {
+	blend := func(a, b uint8) uint8 {
+		return uint8(float32(a) + (float32(b)-float32(a))*t)
+	}
+	return color.RGBA{R: blend(from.R, to.R), G: blend(from.G, to.G), B: blend(from.B, to.B), A: 0xFF}
+}
@@ -0,0 +1,135 @@
+package frontend
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/Dudssource/shiny-cart/emulator"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	// window pixels per LCD pixel
+	SCALE_FACTOR = 4
+)
+
+var palettes = map[int]map[emulator.Pixel]color.RGBA{
+	// default b/w
+	0: {
+		0: rl.RayWhite,
+		1: rl.LightGray,
+		2: rl.DarkGray,
+		3: rl.Black,
+	},
+	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Lime-Midori-810574708
+	1: {
+		0: rl.NewColor(224, 235, 175, 255),
+		1: rl.NewColor(170, 207, 83, 255),
+		2: rl.NewColor(123, 141, 66, 255),
+		3: rl.NewColor(71, 89, 80, 255),
+	},
+	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Pokemon-Pinball-Ver-882658817
+	2: {
+		0: rl.NewColor(232, 248, 184, 255),
+		1: rl.NewColor(160, 176, 80, 255),
+		2: rl.NewColor(120, 96, 48, 255),
+		3: rl.NewColor(24, 24, 32, 255),
+	},
+	// https://www.deviantart.com/thewolfbunny64/art/Game-Boy-Palette-Green-Awakening-883049033
+	3: {
+		0: rl.NewColor(241, 255, 221, 255),
+		1: rl.NewColor(152, 219, 117, 255),
+		2: rl.NewColor(54, 112, 88, 255),
+		3: rl.NewColor(0, 11, 22, 255),
+	},
+}
+
+// Video raylib window, implements emulator.VideoSink, emulator.ColorVideoSink and
+// emulator.SGBVideoSink
+type Video struct {
+	colors        map[emulator.Pixel]color.RGBA
+	width, height int     // LCD size
+	viewer        *viewer // VRAM viewers, if enabled
+}
+
+func NewVideo(palette int) (*Video, error) {
+	colors, ok := palettes[palette]
+	if !ok {
+		return nil, fmt.Errorf("invalid color palette %d", palette)
+	}
+	return &Video{colors: colors}, nil
+}
+
+func (v *Video) Init(width, height int) error {
+	v.width, v.height = width, height
+	rl.InitWindow(int32(width*SCALE_FACTOR), int32(height*SCALE_FACTOR), "GameBoy-DMG Emulator")
+	rl.SetTargetFPS(60)
+	return nil
+}
+
+func (v *Video) Draw(frame *[emulator.SCREEN_HEIGHT][emulator.SCREEN_WIDTH]emulator.Pixel) {
+
+	rl.BeginDrawing()
+	rl.ClearBackground(v.colors[0])
+	defer rl.EndDrawing()
+
+	// Draw
+	for y := 0; y < emulator.SCREEN_HEIGHT; y++ {
+		for x := 0; x < emulator.SCREEN_WIDTH; x++ {
+			var (
+				posX = int32(x) * SCALE_FACTOR
+				posY = int32(y) * SCALE_FACTOR
+			)
+			pixel := frame[y][x]
+
+			color := v.colors[pixel]
+			if pixel == 100 {
+				color = rl.ColorAlpha(color, 0)
+			}
+
+			rl.DrawRectangle(posX, posY, SCALE_FACTOR, SCALE_FACTOR, color)
+		}
+	}
+
+	v.drawViewer()
+}
+
+// DrawColor draws a CGB frame, the color palette is not used
+func (v *Video) DrawColor(frame *[emulator.SCREEN_HEIGHT][emulator.SCREEN_WIDTH]emulator.Color) {
+	v.drawColors(emulator.SCREEN_WIDTH, emulator.SCREEN_HEIGHT, func(x, y int) emulator.Color {
+		return frame[y][x]
+	})
+}
+
+// DrawSGB draws a SGB frame (LCD and border), the color palette is not used
+func (v *Video) DrawSGB(frame *[emulator.SGB_SCREEN_HEIGHT][emulator.SGB_SCREEN_WIDTH]emulator.Color) {
+	v.drawColors(emulator.SGB_SCREEN_WIDTH, emulator.SGB_SCREEN_HEIGHT, func(x, y int) emulator.Color {
+		return frame[y][x]
+	})
+}
+
+func (v *Video) drawColors(width, height int, pixel func(x, y int) emulator.Color) {
+
+	rl.BeginDrawing()
+	rl.ClearBackground(rl.White)
+	defer rl.EndDrawing()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var (
+				posX = int32(x) * SCALE_FACTOR
+				posY = int32(y) * SCALE_FACTOR
+			)
+			rl.DrawRectangle(posX, posY, SCALE_FACTOR, SCALE_FACTOR, pixel(x, y).RGBA())
+		}
+	}
+
+	v.drawViewer()
+}
+
+func (v *Video) Close() {
+	if v.viewer != nil {
+		v.viewer.close()
+	}
+	rl.CloseWindow()
+}
@@ -0,0 +1,145 @@
+package frontend
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/Dudssource/shiny-cart/emulator"
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// VRAM and memory viewers, drawn on a panel to the right of the LCD
+const (
+	VIEWER_NONE = iota
+	VIEWER_TILES
+	VIEWER_TILE_MAPS
+	VIEWER_OAM
+	VIEWER_MEMORY
+	VIEWERS
+
+	// panel width, in window pixels
+	VIEWER_WIDTH = 536
+
+	// F10 cycles through the viewers
+	VIEWER_KEY = rl.KeyF10
+
+	VIEWER_FONT_SIZE    = 10
+	VIEWER_FONT_ADVANCE = 7
+)
+
+var viewerBackground = rl.NewColor(32, 32, 40, 255)
+
+// viewer VRAM and memory viewers of a GameBoy (see Video.ShowViewers)
+type viewer struct {
+	g        *emulator.GameBoy
+	current  int
+	textures map[string]rl.Texture2D
+	memory   memoryViewer
+}
+
+// ShowViewers enables the VRAM viewers (tiles, tile maps and OAM) and the memory viewer/editor
+// of the GameBoy on the window, VIEWER_KEY cycles through them
+func (v *Video) ShowViewers(g *emulator.GameBoy) {
+	v.viewer = &viewer{g: g, textures: make(map[string]rl.Texture2D)}
+}
+
+// drawViewer draws the current viewer, between rl.BeginDrawing and rl.EndDrawing
+func (v *Video) drawViewer() {
+
+	if v.viewer == nil {
+		return
+	}
+	vw := v.viewer
+
+	// the window grows to show the panel
+	if rl.IsKeyPressed(VIEWER_KEY) {
+		vw.current = (vw.current + 1) % VIEWERS
+		width := v.width * SCALE_FACTOR
+		if vw.current != VIEWER_NONE {
+			width += VIEWER_WIDTH
+		}
+		rl.SetWindowSize(width, v.height*SCALE_FACTOR)
+	}
+	editing = editing && vw.current == VIEWER_MEMORY
+	if vw.current == VIEWER_NONE {
+		return
+	}
+
+	x, y := int32(v.width*SCALE_FACTOR), int32(0)
+	rl.DrawRectangle(x, y, VIEWER_WIDTH, int32(v.height*SCALE_FACTOR), viewerBackground)
+	x, y = x+8, y+8
+
+	switch vw.current {
+	case VIEWER_TILES:
+		// both VRAM banks in CGB mode
+		for bank := uint8(0); bank == 0 || bank == 1 && vw.g.CGB(); bank++ {
+			label(x, y, fmt.Sprintf("TILES $8000-$97FF (VRAM%d)", bank))
+			tiles := vw.texture(fmt.Sprintf("tiles%d", bank), vw.g.TileData(bank))
+			rl.DrawTextureEx(tiles, rl.NewVector2(float32(x), float32(y+14)), 0, 2, rl.White)
+			x += tiles.Width*2 + 8
+		}
+
+	case VIEWER_TILE_MAPS:
+		legend := y + 14 + 256 + 8
+		rl.DrawText("VIEWPORT (SCX/SCY)", x, legend, VIEWER_FONT_SIZE, emulator.VIEWPORT_COLOR)
+		rl.DrawText("WINDOW (WX/WY)", x+140, legend, VIEWER_FONT_SIZE, emulator.WINDOW_COLOR)
+		for _, tileMap := range []emulator.Word{emulator.VRAM_BACKGROUND_START, emulator.VRAM_WINDOW_START} {
+			label(x, y, fmt.Sprintf("TILE MAP $%.4X", tileMap))
+			tiles := vw.texture(fmt.Sprintf("map%X", tileMap), vw.g.TileMap(tileMap))
+			rl.DrawTexture(tiles, x, y+14, rl.White)
+			x += tiles.Width + 8
+		}
+
+	case VIEWER_OAM:
+		label(x, y, "OBJECTS")
+		sprites := vw.texture("sprites", vw.g.Sprites())
+		rl.DrawTextureEx(sprites, rl.NewVector2(float32(x), float32(y+14)), 0, 3, rl.White)
+
+		var table strings.Builder
+		vw.g.WriteOAM(&table)
+		for i, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+			label(x+sprites.Width*3+8, y+int32(i)*(VIEWER_FONT_SIZE+3), line)
+		}
+
+	case VIEWER_MEMORY:
+		vw.memory.draw(vw.g, x, y, int32(v.height*SCALE_FACTOR))
+	}
+}
+
+func label(x, y int32, text string) {
+	drawText(x, y, text, rl.RayWhite)
+}
+
+// drawText draws a text with a fixed advance, the default font isn't monospaced (tables)
+func drawText(x, y int32, text string, c color.RGBA) {
+	for i, r := range text {
+		rl.DrawText(string(r), x+int32(i)*VIEWER_FONT_ADVANCE, y, VIEWER_FONT_SIZE, c)
+	}
+}
+
+// texture uploads the image, the texture is created once and then updated
+func (vw *viewer) texture(name string, img *image.RGBA) rl.Texture2D {
+
+	t, ok := vw.textures[name]
+	if !ok {
+		t = rl.LoadTextureFromImage(rl.NewImageFromImage(img))
+		vw.textures[name] = t
+		return t
+	}
+
+	size := img.Bounds().Size()
+	pixels := make([]color.RGBA, size.X*size.Y)
+	for i := range pixels {
+		pixels[i] = img.RGBAAt(i%size.X, i/size.X)
+	}
+	rl.UpdateTexture(t, pixels)
+	return t
+}
+
+func (vw *viewer) close() {
+	for _, t := range vw.textures {
+		rl.UnloadTexture(t)
+	}
+}
@@ -3,27 +3,63 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Dudssource/shiny-cart/emulator"
 )
 
+// window the frontend window (see window.go), with the VRAM and memory viewers
+type window interface {
+	emulator.VideoSink
+	ShowViewers(g *emulator.GameBoy)
+}
+
 func main() {
 	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime | log.LUTC)
+
+	// subcommands
+	if len(os.Args) > 1 {
+		if command, ok := map[string]func([]string) error{
+			"disasm":   disasmCommand,
+			"coverage": coverageCommand,
+		}[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	fmt.Println("GB Classic Emulator")
 
 	flag.Args()
 	file := flag.String("f", "", "ROM `file` location")
 	debug := flag.Bool("d", false, "Debug mode")
-	step := flag.Bool("s", false, "Step mode")
+	step := flag.Bool("s", false, "Step mode (starts stopped in the debugger, commands are read from the terminal)")
 	silent := flag.Bool("m", false, "Silent mode")
 	profiling := flag.Bool("p", false, "Profiling mode")
-	breakPoints := flag.String("b", "", "Break points")
+	breakPoints := flag.String("b", "", "Break points, separated by ';' (e.g. \"PC=150 && A==3; write C000-C0FF; irq vblank\")")
 	palette := flag.Int("c", 3, "Color palette")
 	interval := flag.Duration("t", 500*time.Millisecond, "Machine cycle interval")
 	channels := flag.Int("h", 0xF, "Sound Channels")
+	headless := flag.Bool("headless", HEADLESS_BUILD, "Headless mode (no window, audio or keyboard)")
+	frames := flag.Int("frames", 0, "Number of frames to run in headless mode (0 = until STOP)")
+	screenshot := flag.String("screenshot", "", "Save the last frame as PNG `file` (headless mode)")
+	vram := flag.String("vram", "", "Save the VRAM tiles, tile maps and OAM into the `directory` (headless mode)")
+	model := flag.String("model", "DMG", "Hardware `model` (DMG0, DMG, MGB, SGB, SGB2, CGB, AGB or AGS)")
+	bootROM := flag.String("bootrom", "", "DMG/MGB boot ROM `file` (256 bytes), runs before the cartridge")
+	linkListen := flag.String("link-listen", "", "Wait for the link cable of another emulator on the TCP `address`")
+	printer := flag.String("printer", "", "Plug a Game Boy Printer into the serial port, printed images are saved into the `directory`")
+	linkConnect := flag.String("link-connect", "", "Connect the link cable to the emulator listening on the TCP `address`")
+	cdl := flag.Bool("cdl", false, "Log how the ROM bytes are accessed into <rom>.cdl (see the coverage command)")
+	trace := flag.String("trace", "", "Write the gameboy-doctor CPU trace log into the `file`")
+	profile := flag.String("profile", "", "Write the guest code profile (pprof format) into the `file`, see go tool pprof")
+	gdb := flag.String("gdb", "", "Serve the GDB remote serial protocol on the TCP `address` (e.g. localhost:2345)")
 	flag.Parse()
 
 	// validate args
@@ -33,14 +69,141 @@ func main() {
 		return
 	}
 
+	// boot ROM, skipped (post-boot state) if none
+	var boot []uint8
+	if *bootROM != "" {
+		data, err := os.ReadFile(*bootROM)
+		if err != nil {
+			panic(err)
+		}
+		boot = data
+	}
+
+	// frontend (raylib window, audio device and keyboard), none in headless mode
+	var (
+		win   window
+		video emulator.VideoSink
+		audio emulator.AudioSink
+		input emulator.InputSource
+	)
+
+	if !*headless {
+		w, a, i, err := openWindow(*palette)
+		if err != nil {
+			panic(err)
+		}
+		win, video, audio, input = w, w, a, i
+	}
+
+	// CPU trace log
+	var traceLog io.Writer
+	if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		traceLog = f
+	}
+
+	// guest code profile
+	var profileOutput io.Writer
+	if *profile != "" {
+		f, err := os.Create(*profile)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		profileOutput = f
+	}
+
+	// debugger commands from the terminal, headless runs (e.g. scripts, CI) keep stdin unless
+	// started on the step mode
+	var debugger io.Reader
+	if !*headless || *step {
+		debugger = os.Stdin
+	}
+
 	// emulator
-	g := emulator.NewGameBoy(*debug, *step, *silent, *profiling, *breakPoints, *palette, *channels)
+	g := emulator.NewGameBoy(emulator.Config{
+		Debug:       *debug,
+		Step:        *step,
+		Silent:      *silent,
+		Profiling:   *profiling,
+		BreakPoints: *breakPoints,
+		Channels:    *channels,
+		Model:       emulator.Mode(strings.ToUpper(*model)),
+		BootROM:     boot,
+		Video:       video,
+		Audio:       audio,
+		Input:       input,
+		Debugger:    debugger,
+		Trace:       traceLog,
+		CodeDataLog: *cdl,
+		Profile:     profileOutput,
+	})
 
 	// load ROM
 	if err := g.Load(*file); err != nil {
 		panic(err)
 	}
 
+	// link cable
+	if *linkListen != "" {
+		listener, err := net.Listen("tcp", *linkListen)
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Waiting for the link cable on %s\n", listener.Addr())
+		conn, err := listener.Accept()
+		if err != nil {
+			panic(err)
+		}
+		listener.Close()
+		g.Connect(conn)
+	} else if *linkConnect != "" {
+		conn, err := net.Dial("tcp", *linkConnect)
+		if err != nil {
+			panic(err)
+		}
+		g.Connect(conn)
+	} else if *printer != "" {
+		g.ConnectPrinter(*printer)
+	}
+
+	// GDB remote serial protocol
+	if *gdb != "" {
+		addr, err := g.ListenGDB(*gdb)
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Waiting for GDB clients on %s\n", addr)
+	}
+
+	// headless run
+	if *headless {
+		if err := g.RunFrames(*frames); err != nil {
+			panic(err)
+		}
+		if *screenshot != "" {
+			if err := g.SaveScreenshot(*screenshot); err != nil {
+				panic(err)
+			}
+		}
+		if *vram != "" {
+			if err := g.SaveVRAM(*vram); err != nil {
+				panic(err)
+			}
+		}
+		if err := g.Close(); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// VRAM viewers (F10)
+	win.ShowViewers(g)
+
 	// game Loop
 	if err := g.Loop(*interval); err != nil {
 		panic(err)
@@ -0,0 +1,20 @@
+//go:build !headless
+
+package main
+
+import (
+	"github.com/Dudssource/shiny-cart/emulator"
+	"github.com/Dudssource/shiny-cart/frontend"
+)
+
+// HEADLESS_BUILD built with the raylib frontend, -headless is optional
+const HEADLESS_BUILD = false
+
+// openWindow opens the raylib window, audio device and keyboard
+func openWindow(palette int) (window, emulator.AudioSink, emulator.InputSource, error) {
+	v, err := frontend.NewVideo(palette)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return v, frontend.NewAudio(), frontend.NewInput(), nil
+}
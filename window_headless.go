@@ -0,0 +1,17 @@
+//go:build headless
+
+package main
+
+import (
+	"errors"
+
+	"github.com/Dudssource/shiny-cart/emulator"
+)
+
+// HEADLESS_BUILD built without the raylib frontend (go build -tags headless), no cgo, GL or X11
+// libraries needed, it always runs headless
+const HEADLESS_BUILD = true
+
+func openWindow(palette int) (window, emulator.AudioSink, emulator.InputSource, error) {
+	return nil, nil, nil, errors.New("built without a window (headless tag), run with -headless")
+}